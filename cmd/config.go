@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crud-without-db/internal/repository/cached"
+	"crud-without-db/internal/service"
+	"crud-without-db/pkg/config"
+	"crud-without-db/pkg/db"
+	"crud-without-db/pkg/events"
+	"crud-without-db/pkg/grpcapi"
+	"crud-without-db/pkg/logger"
+	"crud-without-db/pkg/outbox"
+	"crud-without-db/pkg/ratelimit"
+	"crud-without-db/pkg/rest"
+	"crud-without-db/pkg/webhook"
+	"fmt"
+	"strings"
+)
+
+// validateConfig checks the values parsed by the packages they configure,
+// which config.Validate leaves out, and lists every problem at once like it
+func validateConfig(c *config.Config) error {
+	var errs []config.FieldError
+	check := func(err error, field string) {
+		if err != nil {
+			errs = append(errs, config.FieldError{Field: field, Message: err.Error()})
+		}
+	}
+
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := rest.NewTrustedProxies([]string{proxy}); err != nil {
+			check(fmt.Errorf("invalid IP or CIDR %q", proxy), "server.trusted_proxies")
+		}
+	}
+
+	check(rest.ValidateCORSOrigins(c.CORS.AllowedOrigins, c.CORS.AllowCredentials), "cors.allowed_origins")
+	for route, origins := range c.CORS.Routes {
+		check(rest.ValidateCORSOrigins(strings.Fields(origins), c.CORS.AllowCredentials), "cors.routes."+route)
+	}
+
+	if c.RateLimit.Enabled {
+		checkLimit := func(field, limit string) {
+			if _, err := ratelimit.ParseLimit(limit); err != nil {
+				check(fmt.Errorf("invalid limit %q, expected <requests>/<period>", limit), field)
+			}
+		}
+		checkLimit("rate_limit.default", c.RateLimit.Default)
+		for route, limit := range c.RateLimit.Routes {
+			checkLimit("rate_limit.routes."+route, limit)
+		}
+		for _, source := range c.RateLimit.KeyBy {
+			switch source {
+			case rest.KeyByAPIKey, rest.KeyByJWTSubject, rest.KeyByIP:
+			default:
+				check(fmt.Errorf("unknown key source %q", source), "rate_limit.key_by")
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return &config.ValidationError{Fields: errs}
+	}
+	return nil
+}
+
+// databaseConfig returns the database connection configuration
+func databaseConfig(c *config.Config) *db.Config {
+	return &db.Config{
+		Host:            c.Database.Host,
+		Port:            c.Database.Port,
+		User:            c.Database.User,
+		Password:        c.Database.Password,
+		DBName:          c.Database.Name,
+		SSLMode:         c.Database.SSLMode,
+		MaxOpenConns:    c.Database.MaxOpenConns,
+		MaxIdleConns:    c.Database.MaxIdleConns,
+		ConnMaxLifetime: c.Database.ConnMaxLifetime,
+		ConnMaxIdleTime: c.Database.ConnMaxIdleTime,
+		Retry: db.RetryConfig{
+			InitialInterval: c.Database.Retry.InitialInterval,
+			MaxInterval:     c.Database.Retry.MaxInterval,
+			MaxWait:         c.Database.Retry.MaxWait,
+		},
+		Replicas:            c.Database.Replicas.Hosts,
+		HealthCheckInterval: c.Database.Replicas.HealthCheckInterval,
+	}
+}
+
+// grpcServerConfig returns the gRPC server configuration
+func grpcServerConfig(c *config.Config) grpcapi.Config {
+	return grpcapi.Config{
+		Reflection: c.GRPC.Reflection,
+	}
+}
+
+// eventBrokerConfig returns the change event broker configuration
+func eventBrokerConfig(c *config.Config) events.Config {
+	return events.Config{
+		ReplaySize:       c.Events.ReplaySize,
+		SubscriberBuffer: c.Events.SubscriberBuffer,
+	}
+}
+
+// usersCacheConfig returns the users cache configuration
+func usersCacheConfig(c *config.Config) cached.Config {
+	return cached.Config{
+		Size:        c.Cache.Size,
+		TTL:         c.Cache.TTL,
+		NegativeTTL: c.Cache.NegativeTTL,
+		ListSize:    c.Cache.ListSize,
+		ListTTL:     c.Cache.ListTTL,
+	}
+}
+
+// outboxRelayConfig returns the outbox relay configuration
+func outboxRelayConfig(c *config.Config) outbox.Config {
+	return outbox.Config{
+		PollInterval: c.Outbox.PollInterval,
+		BatchSize:    c.Outbox.BatchSize,
+		Retention:    c.Outbox.Retention,
+	}
+}
+
+// webhookDispatcherConfig returns the webhook delivery configuration
+func webhookDispatcherConfig(c *config.Config) webhook.Config {
+	return webhook.Config{
+		PollInterval:   c.Webhooks.PollInterval,
+		BatchSize:      c.Webhooks.BatchSize,
+		MaxAttempts:    c.Webhooks.MaxAttempts,
+		InitialBackoff: c.Webhooks.InitialBackoff,
+		MaxBackoff:     c.Webhooks.MaxBackoff,
+		Timeout:        c.Webhooks.Timeout,
+	}
+}
+
+// avatarsConfig returns the avatar upload limits and thumbnail size
+func avatarsConfig(c *config.Config) service.AvatarsConfig {
+	return service.AvatarsConfig{
+		MaxSize:       c.Avatars.MaxSize,
+		MaxPixels:     c.Avatars.MaxPixels,
+		ThumbnailSize: c.Avatars.ThumbnailSize,
+	}
+}
+
+// corsPolicy returns the cross-origin policy for the HTTP server
+func corsPolicy(c *config.Config) rest.CORSConfig {
+	routes := make(map[string][]string, len(c.CORS.Routes))
+	for route, origins := range c.CORS.Routes {
+		routes[route] = strings.Fields(origins)
+	}
+
+	return rest.CORSConfig{
+		AllowedOrigins:   c.CORS.AllowedOrigins,
+		AllowedMethods:   c.CORS.AllowedMethods,
+		AllowedHeaders:   c.CORS.AllowedHeaders,
+		ExposedHeaders:   c.CORS.ExposedHeaders,
+		AllowCredentials: c.CORS.AllowCredentials,
+		MaxAge:           c.CORS.MaxAge,
+		Routes:           routes,
+	}
+}
+
+// rateLimiterConfig returns rate limits for the HTTP middleware, limits are
+// expected to be checked by validateConfig
+func rateLimiterConfig(c *config.Config) rest.RateLimitConfig {
+	rateLimit := rest.RateLimitConfig{
+		Routes: make(map[string]ratelimit.Limit, len(c.RateLimit.Routes)),
+		KeyBy:  c.RateLimit.KeyBy,
+	}
+	rateLimit.Default, _ = ratelimit.ParseLimit(c.RateLimit.Default)
+	for route, value := range c.RateLimit.Routes {
+		rateLimit.Routes[route], _ = ratelimit.ParseLimit(value)
+	}
+	return rateLimit
+}
+
+// loggerConfig returns the logger configuration
+func loggerConfig(c *config.Config) *logger.Config {
+	outputs := make([]logger.OutputConfig, 0, len(c.Log.Outputs))
+	for _, output := range c.Log.Outputs {
+		if output == "file" {
+			outputs = append(outputs, logger.OutputConfig{
+				Type:        output,
+				Format:      c.Log.File.Format,
+				Path:        c.Log.File.Path,
+				MaxSizeMB:   c.Log.File.MaxSizeMB,
+				RotateEvery: c.Log.File.RotateEvery,
+				MaxBackups:  c.Log.File.MaxBackups,
+				MaxAge:      c.Log.File.MaxAge,
+			})
+			continue
+		}
+		outputs = append(outputs, logger.OutputConfig{Type: output, Format: c.Log.Format})
+	}
+
+	return &logger.Config{
+		Level:      c.Log.Level,
+		Components: c.Log.Components,
+		Format:     c.Log.Format,
+		TimeFormat: c.Log.TimeFormat,
+		AppName:    c.Log.AppName,
+		Outputs:    outputs,
+		Sampling: logger.SamplingConfig{
+			Components: c.Log.Sampling.Components,
+			Burst:      c.Log.Sampling.Burst,
+			Period:     c.Log.Sampling.Period,
+			Every:      c.Log.Sampling.Every,
+		},
+	}
+}
@@ -1,28 +1,32 @@
-// @title CRUD API with PostgreSQL
-// @version 1.0
-// @description This is a CRUD application with PostgreSQL database.
-// @host
-// @BasePath /
-// @schemes http
 package main
 
 import (
 	"context"
-	_ "crud-without-db/docs"
+	"crud-without-db/internal/repository/cached"
+	"crud-without-db/internal/repository/memory"
 	"crud-without-db/internal/repository/psql"
 	"crud-without-db/internal/service"
+	"crud-without-db/pkg/blob"
+	"crud-without-db/pkg/config"
 	"crud-without-db/pkg/db"
+	"crud-without-db/pkg/events"
+	"crud-without-db/pkg/gql"
+	"crud-without-db/pkg/grpcapi"
 	"crud-without-db/pkg/logger"
+	"crud-without-db/pkg/openapi"
+	"crud-without-db/pkg/outbox"
+	"crud-without-db/pkg/ratelimit"
 	"crud-without-db/pkg/rest"
-	"github.com/gorilla/handlers"
+	"crud-without-db/pkg/webhook"
+	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog/log"
-	httpSwagger "github.com/swaggo/http-swagger"
+	httpSwagger "github.com/swaggo/http-swagger/v2"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 )
 
 func main() {
@@ -32,64 +36,255 @@ func main() {
 		log.Debug().Err(err).Msg("No .env file found, using system environment variables")
 	}
 
+	// Load configuration: defaults, config file, environment and flags
+	args := os.Args[1:]
+	printConfig := len(args) > 0 && args[0] == "print-config"
+	if printConfig {
+		args = args[1:]
+	}
+
+	cfg, err := config.Load(args)
+	if err == nil {
+		err = validateConfig(cfg)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, "\nUsage: crud-without-db [print-config] [flags]")
+		config.Usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	// Print effective configuration with secrets masked and exit
+	if printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize logger
-	logConfig := logger.NewConfigFromEnv()
-	logger.InitLogger(logConfig)
+	if err := logger.InitLogger(loggerConfig(cfg)); err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize logger")
+	}
+	defer logger.Close()
 
 	mainLogger := logger.GetLogger("main")
 	mainLogger.Info().Msg("Starting CRUD API application")
 
-	// Initialize database connection
-	dbConfig := db.NewConfigFromEnv()
-	database, err := db.NewPostgresConnection(dbConfig)
-	if err != nil {
-		mainLogger.Fatal().Err(err).Msg("Failed to connect to database")
+	// Initialize the users repository, in memory for development and demos
+	dbConfig := databaseConfig(cfg)
+	var database *db.Cluster
+	var usersRepo service.UsersRepository
+	var attributesRepo service.AttributesRepository
+	var groupsRepo service.GroupsRepository
+	var addressesRepo service.AddressesRepository
+	if cfg.Database.Backend == "memory" {
+		mainLogger.Warn().Msg("Using the in-memory users backend, data is lost on restart")
+		memoryUsers := memory.NewUsers()
+		usersRepo = memoryUsers
+		attributesRepo = memory.NewAttributes(memoryUsers)
+		groupsRepo = memory.NewGroups(memoryUsers)
+		addressesRepo = memory.NewAddresses(memoryUsers)
+	} else {
+		database, err = db.NewCluster(dbConfig)
+		if err != nil {
+			mainLogger.Fatal().Err(err).Msg("Failed to connect to database")
+		}
+		defer database.Close()
+
+		// Initialize repository with database connection
+		psqlUsers := psql.NewUsers(database)
+
+		// Initialize database schema
+		if err := psqlUsers.InitSchema(); err != nil {
+			mainLogger.Fatal().Err(err).Msg("Failed to initialize database schema")
+		}
+		usersRepo = psqlUsers
+
+		// Definitions of the custom attributes users may have
+		psqlAttributes := psql.NewAttributes(database)
+		if err := psqlAttributes.InitSchema(); err != nil {
+			mainLogger.Fatal().Err(err).Msg("Failed to initialize attributes schema")
+		}
+		attributesRepo = psqlAttributes
+
+		// Groups of users, memberships are removed with their users
+		psqlGroups := psql.NewGroups(database)
+		if err := psqlGroups.InitSchema(); err != nil {
+			mainLogger.Fatal().Err(err).Msg("Failed to initialize groups schema")
+		}
+		groupsRepo = psqlGroups
+
+		// Postal addresses, deleted with their users
+		psqlAddresses := psql.NewAddresses(database)
+		if err := psqlAddresses.InitSchema(); err != nil {
+			mainLogger.Fatal().Err(err).Msg("Failed to initialize addresses schema")
+		}
+		addressesRepo = psqlAddresses
 	}
-	defer database.Close()
+	attributesService := service.NewAttributes(attributesRepo)
+	addressesService := service.NewAddresses(addressesRepo)
+
+	// Publish user changes to in-process subscribers (SSE and gRPC watchers)
+	broker := events.NewBroker(eventBrokerConfig(cfg))
+	defer broker.Close()
+
+	var webhooksService *service.Webhooks
+	if database != nil {
+		// Changes are recorded in the outbox in their own transaction
+		outboxRepo := psql.NewOutbox(database)
+		if err := outboxRepo.InitSchema(); err != nil {
+			mainLogger.Fatal().Err(err).Msg("Failed to initialize outbox schema")
+		}
+
+		// Deliver user events to webhook subscriptions through a durable queue
+		if cfg.Webhooks.Enabled {
+			webhooksRepo := psql.NewWebhooks(database)
+			if err := webhooksRepo.InitSchema(); err != nil {
+				mainLogger.Fatal().Err(err).Msg("Failed to initialize webhooks schema")
+			}
+			webhooksService = service.NewWebhooks(webhooksRepo)
+
+			dispatchCtx, stopDispatch := context.WithCancel(context.Background())
+			defer stopDispatch()
+			go webhook.NewDispatcher(webhooksRepo, nil, webhookDispatcherConfig(cfg)).Run(dispatchCtx)
+		}
 
-	// Initialize repository with database connection
-	usersRepo := psql.NewUsers(database)
+		// Relay outbox events to the configured publishers
+		var publishers []outbox.Publisher
+		for _, name := range cfg.Outbox.Publishers {
+			switch name {
+			case "log":
+				publishers = append(publishers, outbox.NewLogPublisher())
+			case "webhook":
+				publishers = append(publishers, outbox.NewWebhookPublisher(webhooksService))
+			case "file":
+				filePublisher, err := outbox.NewFilePublisher(cfg.Outbox.FilePath)
+				if err != nil {
+					mainLogger.Fatal().Err(err).Msg("Failed to create outbox file publisher")
+				}
+				defer filePublisher.Close()
+				publishers = append(publishers, filePublisher)
+			}
+		}
+		relayCtx, stopRelay := context.WithCancel(context.Background())
+		defer stopRelay()
+		go outbox.NewRelay(outboxRepo, publishers, outboxRelayConfig(cfg)).Run(relayCtx)
+	}
 
-	// Initialize database schema
-	if err := usersRepo.InitSchema(); err != nil {
-		mainLogger.Fatal().Err(err).Msg("Failed to initialize database schema")
+	// Cache reads in process, writes and detected changes invalidate it
+	var usersStore service.UsersRepository = usersRepo
+	var changeSinks []service.ChangePublisher
+	var usersCache *cached.Users
+	if cfg.Cache.Enabled {
+		usersCache = cached.NewUsers(usersRepo, usersCacheConfig(cfg))
+		usersStore = usersCache
+		changeSinks = append(changeSinks, usersCache)
 	}
 
-	// Initialize service and handler
-	usersService := service.NewUsers(usersRepo)
-	handler := rest.NewHandler(usersService)
+	// Initialize service and handler. With the listener every change, also
+	// those made in SQL or by other instances, arrives as a notification;
+	// otherwise the service publishes the changes it makes itself.
+	var usersEvents service.EventPublisher = broker
+	if cfg.Events.Listen && database != nil {
+		usersEvents = nil
+		changes := service.NewUserChanges(usersRepo, append(changeSinks, broker)...)
+		listenCtx, stopListen := context.WithCancel(context.Background())
+		defer stopListen()
+		go db.NewListener(dbConfig, service.UsersChangesChannel, changes).Run(listenCtx)
+	}
+	usersService := service.NewUsers(usersStore, usersEvents, attributesService)
+	handler := rest.NewHandler(usersService, broker, addressesService)
 	router := handler.InitRouter()
+	apiDoc := handler.OpenAPI()
 
-	// Enhanced CORS configuration for Swagger UI
-	corsHandler := handlers.CORS(
-		// Allow all origins for development - in production, specify your domain
-		handlers.AllowedOrigins([]string{"*"}),
-		// Allow all necessary HTTP methods
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD"}),
-		// Allow all necessary headers
-		handlers.AllowedHeaders([]string{
-			"Accept",
-			"Accept-Language",
-			"Content-Type",
-			"Content-Language",
-			"Origin",
-			"Authorization",
-			"X-Requested-With",
-			"X-HTTP-Method-Override",
-		}),
-		// Allow credentials if needed
-		handlers.AllowCredentials(),
-		// Expose headers that might be needed
-		handlers.ExposedHeaders([]string{"Content-Length", "Content-Type"}),
-		// Cache preflight requests for 24 hours
-		handlers.MaxAge(86400),
-	)
-
-	// Apply CORS middleware to the router
-	router.Use(corsHandler)
-
-	// Add Swagger UI route with custom configuration
-	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
+	// Limit request rates per client
+	if cfg.RateLimit.Enabled {
+		proxies, err := rest.NewTrustedProxies(cfg.Server.TrustedProxies)
+		if err != nil {
+			mainLogger.Fatal().Err(err).Msg("Invalid trusted proxies")
+		}
+
+		var store ratelimit.Store
+		switch cfg.RateLimit.Store {
+		case "postgres":
+			pgStore := ratelimit.NewPostgresStore(database.Primary())
+			if err := pgStore.InitSchema(); err != nil {
+				mainLogger.Fatal().Err(err).Msg("Failed to initialize rate limit schema")
+			}
+			cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+			defer stopCleanup()
+			go pgStore.RunCleanup(cleanupCtx, cfg.RateLimit.CleanupInterval)
+			store = pgStore
+		default:
+			memStore := ratelimit.NewMemoryStore(cfg.RateLimit.CleanupInterval)
+			defer memStore.Close()
+			store = memStore
+		}
+
+		router.Use(rest.NewRateLimiter(store, rateLimiterConfig(cfg), proxies).Middleware)
+	}
+
+	// Validate requests against the OpenAPI document
+	if cfg.OpenAPI.ValidateRequests || cfg.OpenAPI.ValidateResponses {
+		validator := rest.NewValidator(apiDoc, cfg.OpenAPI.ValidateResponses, cfg.OpenAPI.MaxBodySize)
+		// Protected routes authenticate before their input is validated
+		if cfg.Admin.Token != "" {
+			validator.Authenticate(rest.AdminTokenScheme, rest.BearerAuth(cfg.Admin.Token))
+		}
+		router.Use(validator.Middleware)
+	}
+
+	// Route reads of recently writing clients to the primary
+	router.Use(rest.ReadYourWritesMiddleware(cfg.Database.Replicas.StickyWindow))
+
+	// Serve GraphQL over the same users service
+	graphqlHandler, err := gql.NewHandler(usersService)
+	if err != nil {
+		mainLogger.Fatal().Err(err).Msg("Failed to build GraphQL schema")
+	}
+	router.Handle("/graphql", graphqlHandler).Methods("POST")
+
+	// Register admin endpoints (runtime log level control)
+	adminHandler := rest.NewAdminHandler(cfg.Admin.Token)
+	if usersCache != nil {
+		adminHandler.AddStats("users_cache", func() interface{} { return usersCache.Stats() })
+	}
+	adminHandler.InitRoutes(router)
+
+	// Manage webhook subscriptions, authenticated like the admin endpoints
+	if webhooksService != nil {
+		rest.NewWebhookHandler(cfg.Admin.Token, webhooksService).InitRoutes(router, apiDoc)
+	}
+
+	// Organize users into groups
+	rest.NewGroupHandler(service.NewGroups(groupsRepo)).InitRoutes(router, apiDoc)
+
+	// Postal addresses as a sub-resource of users
+	rest.NewAddressHandler(addressesService).InitRoutes(router, apiDoc)
+
+	// Profile pictures of users, stored as files. Avatars of deleted users
+	// are removed on their deletion events.
+	avatarStore, err := blob.NewFileStore(cfg.Avatars.Dir)
+	if err != nil {
+		mainLogger.Fatal().Err(err).Msg("Failed to create avatar storage")
+	}
+	avatarsService := service.NewAvatars(avatarStore, usersService, avatarsConfig(cfg))
+	avatarCleanupCtx, stopAvatarCleanup := context.WithCancel(context.Background())
+	defer stopAvatarCleanup()
+	go avatarsService.RunCleanup(avatarCleanupCtx, broker)
+	rest.NewAvatarHandler(avatarsService, cfg.Avatars.CacheMaxAge).InitRoutes(router, apiDoc)
+
+	// Define custom user attributes, authenticated like the admin endpoints
+	rest.NewAttributeHandler(cfg.Admin.Token, attributesService).InitRoutes(router, apiDoc)
+
+	// Live user updates over WebSocket, authenticated like the admin endpoints
+	wsHandler, err := rest.NewWebSocketHandler(cfg.Admin.Token, broker, cfg.CORS.AllowedOrigins)
+	if err != nil {
+		mainLogger.Fatal().Err(err).Msg("Invalid WebSocket configuration")
+	}
+	wsHandler.InitRoutes(router)
 
 	// Add a health endpoint
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -98,165 +293,82 @@ func main() {
 		w.Write([]byte(`{"status": "healthy", "database": "connected", "cors": "enabled"}`))
 	}).Methods("GET", "OPTIONS")
 
-	// Dynamic swagger.json endpoint that uses the current request host
-	router.HandleFunc("/swagger/doc.json", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+	// Serve the OpenAPI document generated from the route table and Swagger UI
+	router.HandleFunc("/swagger/doc.json", rest.DocHandler(apiDoc)).Methods("GET")
+	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
-		// Get the host from the request
-		host := r.Host
-		if host == "" {
-			host = "localhost:3000" // fallback
-		}
+	// Refuse to start when routes and the document disagree
+	if err := openapi.Verify(apiDoc, router, "/swagger", "/admin", "/health", "/graphql", "/ws"); err != nil {
+		mainLogger.Fatal().Err(err).Msg("OpenAPI document is out of sync")
+	}
+
+	// CORS wraps the router so that preflight requests are answered before routing
+	cors, err := rest.NewCORS(corsPolicy(cfg), router)
+	if err != nil {
+		mainLogger.Fatal().Err(err).Msg("Invalid CORS configuration")
+	}
 
-		// Create dynamic swagger JSON with current host
-		swaggerJSON := `{
-    "schemes": ["http"],
-    "swagger": "2.0",
-    "info": {
-        "description": "This is a CRUD application with PostgreSQL database.",
-        "title": "CRUD API with PostgreSQL",
-        "contact": {},
-        "version": "1.0"
-    },
-    "host": "` + host + `",
-    "basePath": "/",
-    "paths": {
-        "/users": {
-            "get": {
-                "description": "Get a list of all users",
-                "produces": ["application/json"],
-                "tags": ["users"],
-                "summary": "Get all users",
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "array",
-                            "items": {"$ref": "#/definitions/domain.User"}
-                        }
-                    }
-                }
-            },
-            "post": {
-                "description": "Create a new user",
-                "consumes": ["application/json"],
-                "produces": ["application/json"],
-                "tags": ["users"],
-                "summary": "Create a new user",
-                "parameters": [{
-                    "description": "Create user",
-                    "name": "user",
-                    "in": "body",
-                    "required": true,
-                    "schema": {"$ref": "#/definitions/domain.User"}
-                }],
-                "responses": {
-                    "201": {
-                        "description": "Created",
-                        "schema": {"$ref": "#/definitions/domain.User"}
-                    }
-                }
-            }
-        },
-        "/users/{id}": {
-            "get": {
-                "description": "Get a user by their ID",
-                "produces": ["application/json"],
-                "tags": ["users"],
-                "summary": "Get a user by ID",
-                "parameters": [{
-                    "type": "integer",
-                    "description": "User ID",
-                    "name": "id",
-                    "in": "path",
-                    "required": true
-                }],
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {"$ref": "#/definitions/domain.User"}
-                    }
-                }
-            },
-            "put": {
-                "description": "Update a user by their ID",
-                "consumes": ["application/json"],
-                "produces": ["application/json"],
-                "tags": ["users"],
-                "summary": "Update a user",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Update user",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
-                        "schema": {"$ref": "#/definitions/domain.User"}
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {"$ref": "#/definitions/domain.User"}
-                    }
-                }
-            },
-            "delete": {
-                "description": "Delete a user by their ID",
-                "produces": ["application/json"],
-                "tags": ["users"],
-                "summary": "Delete a user",
-                "parameters": [{
-                    "type": "integer",
-                    "description": "User ID",
-                    "name": "id",
-                    "in": "path",
-                    "required": true
-                }],
-                "responses": {
-                    "204": {"description": "No Content"}
-                }
-            }
-        }
-    },
-    "definitions": {
-        "domain.User": {
-            "type": "object",
-            "properties": {
-                "age": {"type": "integer"},
-                "id": {"type": "integer"},
-                "name": {"type": "string"},
-                "sex": {"type": "string"}
-            }
-        }
-    }
-}`
-
-		w.Write([]byte(swaggerJSON))
-	}).Methods("GET")
-
-	// Initialize & run server
 	srv := &http.Server{
-		Addr:    ":3000",
-		Handler: router,
+		Addr:    cfg.Server.Addr,
+		Handler: cors.Handler(router),
+	}
+
+	// Serve the gRPC API on its own port
+	var grpcServer *grpcapi.Server
+	if cfg.GRPC.Enabled {
+		lis, err := net.Listen("tcp", cfg.GRPC.Addr)
+		if err != nil {
+			mainLogger.Fatal().Err(err).Str("address", cfg.GRPC.Addr).Msg("Failed to listen for gRPC")
+		}
+
+		grpcServer = grpcapi.NewServer(usersService, broker, grpcServerConfig(cfg))
+		go func() {
+			mainLogger.Info().Str("address", cfg.GRPC.Addr).Msg("gRPC server starting")
+			if err := grpcServer.Serve(lis); err != nil {
+				mainLogger.Fatal().Err(err).Msg("Failed to start gRPC server")
+			}
+		}()
 	}
 
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start a goroutine to handle shutdown
+	// Reload logger configuration on SIGHUP
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 	go func() {
+		for range hupChan {
+			mainLogger.Info().Msg("Received SIGHUP, reloading logger configuration")
+			if err := godotenv.Overload(); err != nil {
+				mainLogger.Debug().Err(err).Msg("No .env file found, using system environment variables")
+			}
+			reloaded, err := config.Load(args)
+			if err != nil {
+				mainLogger.Error().Err(err).Msg("Failed to reload configuration")
+				continue
+			}
+			logger.Reload(loggerConfig(reloaded))
+		}
+	}()
+
+	// Start a goroutine to handle shutdown, both servers share the timeout
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
 		sig := <-sigChan
 		mainLogger.Info().Str("signal", sig.String()).Msg("Received shutdown signal")
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 		defer cancel()
+		// End event streams first, they would otherwise keep both servers waiting
+		broker.Close()
+		if grpcServer != nil {
+			if err := grpcServer.Shutdown(ctx); err != nil {
+				mainLogger.Error().Err(err).Msg("gRPC server shutdown failed")
+			} else {
+				mainLogger.Info().Msg("gRPC server shut down gracefully")
+			}
+		}
 		if err := srv.Shutdown(ctx); err != nil {
 			mainLogger.Error().Err(err).Msg("Server shutdown failed")
 		} else {
@@ -266,13 +378,15 @@ func main() {
 
 	// Start the server
 	mainLogger.Info().
-		Str("address", ":3000").
+		Str("address", cfg.Server.Addr).
 		Str("db_host", dbConfig.Host).
 		Int("db_port", dbConfig.Port).
 		Str("db_name", dbConfig.DBName).
+		Strs("db_replicas", dbConfig.Replicas).
 		Msg("Server starting")
 
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		mainLogger.Fatal().Err(err).Msg("Failed to start server")
 	}
+	<-shutdownDone
 }
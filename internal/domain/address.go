@@ -0,0 +1,128 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrAddressNotFound = errors.New("address not found")
+
+// postalCodes are the postal code formats of countries, after Normalize
+var postalCodes = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^[0-9]{4}$`),
+	"AU": regexp.MustCompile(`^[0-9]{4}$`),
+	"BE": regexp.MustCompile(`^[0-9]{4}$`),
+	"BR": regexp.MustCompile(`^[0-9]{5}-?[0-9]{3}$`),
+	"CA": regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY][0-9][A-Z] ?[0-9][A-Z][0-9]$`),
+	"CH": regexp.MustCompile(`^[0-9]{4}$`),
+	"CN": regexp.MustCompile(`^[0-9]{6}$`),
+	"CZ": regexp.MustCompile(`^[0-9]{3} ?[0-9]{2}$`),
+	"DE": regexp.MustCompile(`^[0-9]{5}$`),
+	"DK": regexp.MustCompile(`^[0-9]{4}$`),
+	"ES": regexp.MustCompile(`^[0-9]{5}$`),
+	"FI": regexp.MustCompile(`^[0-9]{5}$`),
+	"FR": regexp.MustCompile(`^[0-9]{5}$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}[0-9][A-Z0-9]? ?[0-9][A-Z]{2}$`),
+	"IE": regexp.MustCompile(`^[A-Z][0-9][0-9W] ?[A-Z0-9]{4}$`),
+	"IN": regexp.MustCompile(`^[1-9][0-9]{5}$`),
+	"IT": regexp.MustCompile(`^[0-9]{5}$`),
+	"JP": regexp.MustCompile(`^[0-9]{3}-?[0-9]{4}$`),
+	"MX": regexp.MustCompile(`^[0-9]{5}$`),
+	"NL": regexp.MustCompile(`^[1-9][0-9]{3} ?[A-Z]{2}$`),
+	"NO": regexp.MustCompile(`^[0-9]{4}$`),
+	"NZ": regexp.MustCompile(`^[0-9]{4}$`),
+	"PL": regexp.MustCompile(`^[0-9]{2}-[0-9]{3}$`),
+	"PT": regexp.MustCompile(`^[0-9]{4}-[0-9]{3}$`),
+	"RU": regexp.MustCompile(`^[0-9]{6}$`),
+	"SE": regexp.MustCompile(`^[0-9]{3} ?[0-9]{2}$`),
+	"US": regexp.MustCompile(`^[0-9]{5}(-[0-9]{4})?$`),
+}
+
+// withoutPostalCodes are countries that don't use postal codes
+var withoutPostalCodes = map[string]bool{
+	"AE": true, "AG": true, "AO": true, "BS": true, "BZ": true, "FJ": true,
+	"HK": true, "KI": true, "QA": true, "TV": true, "UG": true, "ZW": true,
+}
+
+var (
+	countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+	// anyPostalCode is the format of countries without a known one
+	anyPostalCode = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{1,9}$`)
+)
+
+// Address is a postal address of a user. Every user with addresses has
+// exactly one default address.
+type Address struct {
+	ID         int64     `json:"id" openapi:"required,readOnly"`
+	UserID     int64     `json:"user_id" openapi:"required,readOnly"`
+	Label      string    `json:"label,omitempty" openapi:"maxLength=50" description:"Like \"Home\" or \"Office\""`
+	Line1      string    `json:"line1" openapi:"required,minLength=1,maxLength=200"`
+	Line2      string    `json:"line2,omitempty" openapi:"maxLength=200"`
+	City       string    `json:"city" openapi:"required,minLength=1,maxLength=100"`
+	Region     string    `json:"region,omitempty" openapi:"maxLength=100" description:"State, province or county"`
+	PostalCode string    `json:"postal_code,omitempty" openapi:"maxLength=16" description:"Checked against the format of the country, must be empty in countries without postal codes"`
+	Country    string    `json:"country" openapi:"required,minLength=2,maxLength=2" description:"ISO 3166-1 alpha-2 code"`
+	Default    bool      `json:"default" description:"Making an address the default unsets the previous one; the first address of a user is always the default"`
+	CreatedAt  time.Time `json:"created_at" openapi:"required,readOnly"`
+	UpdatedAt  time.Time `json:"updated_at" openapi:"required,readOnly"`
+}
+
+// Normalize trims the fields, upper cases the country and postal code and
+// collapses the spaces of the postal code
+func (a *Address) Normalize() {
+	a.Label = strings.TrimSpace(a.Label)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	a.Line2 = strings.TrimSpace(a.Line2)
+	a.City = strings.TrimSpace(a.City)
+	a.Region = strings.TrimSpace(a.Region)
+	a.PostalCode = strings.ToUpper(strings.Join(strings.Fields(a.PostalCode), " "))
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+}
+
+func (a Address) Validate() error {
+	var violations []FieldViolation
+	add := func(field, description string) {
+		violations = append(violations, FieldViolation{Field: field, Description: description})
+	}
+	length := func(field, value string, min, max int) {
+		if n := utf8.RuneCountInString(value); n < min || n > max {
+			if min == 0 {
+				add(field, fmt.Sprintf("must be at most %d characters long", max))
+			} else {
+				add(field, fmt.Sprintf("must be between %d and %d characters long", min, max))
+			}
+		}
+	}
+
+	length("label", a.Label, 0, 50)
+	length("line1", a.Line1, 1, 200)
+	length("line2", a.Line2, 0, 200)
+	length("city", a.City, 1, 100)
+	length("region", a.Region, 0, 100)
+
+	switch {
+	case !countryCode.MatchString(a.Country):
+		add("country", "must be an ISO 3166-1 alpha-2 code like US")
+	case withoutPostalCodes[a.Country]:
+		if a.PostalCode != "" {
+			add("postal_code", "must be empty, "+a.Country+" has no postal codes")
+		}
+	case postalCodes[a.Country] != nil:
+		if a.PostalCode == "" {
+			add("postal_code", "is required in "+a.Country)
+		} else if !postalCodes[a.Country].MatchString(a.PostalCode) {
+			add("postal_code", "is not a valid postal code in "+a.Country)
+		}
+	case a.PostalCode != "" && !anyPostalCode.MatchString(a.PostalCode):
+		add("postal_code", "must be 2 to 10 letters, digits, spaces or dashes")
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Entity: "address", Violations: violations}
+	}
+	return nil
+}
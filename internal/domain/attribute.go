@@ -0,0 +1,216 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrAttributeNotFound = errors.New("attribute not found")
+	// ErrAttributeInUse is returned when deleting an attribute users have
+	ErrAttributeInUse = errors.New("attribute in use")
+)
+
+type AttributeType string
+
+const (
+	AttributeString  AttributeType = "string"
+	AttributeInteger AttributeType = "integer"
+	AttributeNumber  AttributeType = "number"
+	AttributeBoolean AttributeType = "boolean"
+)
+
+var attributeName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// AttributeDefinition declares a custom user attribute and the rules its
+// values follow. Rules that don't apply to the type must be empty.
+type AttributeDefinition struct {
+	Name        string        `json:"name" openapi:"required,readOnly" description:"Lower case letters, digits and underscores"`
+	Type        AttributeType `json:"type" openapi:"required,enum=string|integer|number|boolean"`
+	Description string        `json:"description,omitempty" openapi:"maxLength=1000"`
+	Required    bool          `json:"required" description:"Users must have a value, existing users on their next update"`
+	// Minimum and Maximum bound integers and numbers
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+	// MinLength, MaxLength, Pattern and Enum restrict strings
+	MinLength *int      `json:"min_length,omitempty" openapi:"minimum=0"`
+	MaxLength *int      `json:"max_length,omitempty" openapi:"minimum=1"`
+	Pattern   string    `json:"pattern,omitempty" description:"Regular expression (RE2 syntax) strings must match"`
+	Enum      []string  `json:"enum,omitempty"`
+	CreatedAt time.Time `json:"created_at" openapi:"required,readOnly"`
+	UpdatedAt time.Time `json:"updated_at" openapi:"required,readOnly"`
+}
+
+// Validate checks the definition itself
+func (d AttributeDefinition) Validate() error {
+	var violations []FieldViolation
+	add := func(field, description string) {
+		violations = append(violations, FieldViolation{Field: field, Description: description})
+	}
+
+	if !attributeName.MatchString(d.Name) {
+		add("name", "must start with a lower case letter followed by at most 62 lower case letters, digits or underscores")
+	}
+	if utf8.RuneCountInString(d.Description) > 1000 {
+		add("description", "must be at most 1000 characters long")
+	}
+
+	numeric := d.Type == AttributeInteger || d.Type == AttributeNumber
+	switch d.Type {
+	case AttributeString, AttributeInteger, AttributeNumber, AttributeBoolean:
+	default:
+		add("type", "must be one of string, integer, number, boolean")
+	}
+
+	if !numeric && (d.Minimum != nil || d.Maximum != nil) {
+		add("minimum", "only applies to integer and number attributes")
+	}
+	if d.Minimum != nil && d.Maximum != nil && *d.Minimum > *d.Maximum {
+		add("maximum", "must not be less than minimum")
+	}
+
+	if d.Type != AttributeString && (d.MinLength != nil || d.MaxLength != nil || d.Pattern != "" || len(d.Enum) > 0) {
+		add("type", "must be string for min_length, max_length, pattern and enum")
+	}
+	if d.MinLength != nil && *d.MinLength < 0 {
+		add("min_length", "must not be negative")
+	}
+	if d.MaxLength != nil && *d.MaxLength < 1 {
+		add("max_length", "must be positive")
+	}
+	if d.MinLength != nil && d.MaxLength != nil && *d.MinLength > *d.MaxLength {
+		add("max_length", "must not be less than min_length")
+	}
+	if d.Pattern != "" {
+		if _, err := regexp.Compile(d.Pattern); err != nil {
+			add("pattern", "must be a valid regular expression")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Entity: "attribute", Violations: violations}
+	}
+	return nil
+}
+
+// ValidateAttributes checks attribute values against their definitions,
+// reporting undefined attributes and missing required ones. Values are as
+// decoded from JSON: strings, float64 numbers and bools.
+func ValidateAttributes(definitions map[string]AttributeDefinition, attributes map[string]interface{}) []FieldViolation {
+	var violations []FieldViolation
+	add := func(name, description string) {
+		violations = append(violations, FieldViolation{Field: "attributes." + name, Description: description})
+	}
+
+	for _, name := range sortedKeys(attributes) {
+		definition, ok := definitions[name]
+		if !ok {
+			add(name, "is not a defined attribute")
+			continue
+		}
+		if problem := definition.check(attributes[name]); problem != "" {
+			add(name, problem)
+		}
+	}
+
+	for _, name := range sortedKeys(definitions) {
+		if _, ok := attributes[name]; !ok && definitions[name].Required {
+			add(name, "is required")
+		}
+	}
+
+	return violations
+}
+
+// check returns what is wrong with a value, or "" when it is valid
+func (d AttributeDefinition) check(value interface{}) string {
+	switch d.Type {
+	case AttributeString:
+		s, ok := value.(string)
+		if !ok {
+			return "must be a string"
+		}
+		n := utf8.RuneCountInString(s)
+		if d.MinLength != nil && n < *d.MinLength {
+			return fmt.Sprintf("must be at least %d characters long", *d.MinLength)
+		}
+		if d.MaxLength != nil && n > *d.MaxLength {
+			return fmt.Sprintf("must be at most %d characters long", *d.MaxLength)
+		}
+		if d.Pattern != "" {
+			if re, err := regexp.Compile(d.Pattern); err == nil && !re.MatchString(s) {
+				return "must match pattern " + d.Pattern
+			}
+		}
+		if len(d.Enum) > 0 && !contains(d.Enum, s) {
+			return fmt.Sprintf("must be one of %v", d.Enum)
+		}
+	case AttributeInteger, AttributeNumber:
+		f, ok := value.(float64)
+		if !ok || d.Type == AttributeInteger && f != math.Trunc(f) {
+			return d.typeProblem()
+		}
+		if d.Minimum != nil && f < *d.Minimum {
+			return "must be at least " + strconv.FormatFloat(*d.Minimum, 'f', -1, 64)
+		}
+		if d.Maximum != nil && f > *d.Maximum {
+			return "must be at most " + strconv.FormatFloat(*d.Maximum, 'f', -1, 64)
+		}
+	case AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return "must be a boolean"
+		}
+	}
+	return ""
+}
+
+// ParseValue converts a query parameter to a value of the attribute's type
+func (d AttributeDefinition) ParseValue(raw string) (interface{}, error) {
+	switch d.Type {
+	case AttributeInteger, AttributeNumber:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil || d.Type == AttributeInteger && f != math.Trunc(f) {
+			return nil, errors.New(d.typeProblem())
+		}
+		return f, nil
+	case AttributeBoolean:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		return b, nil
+	default:
+		return raw, nil
+	}
+}
+
+func (d AttributeDefinition) typeProblem() string {
+	if d.Type == AttributeInteger {
+		return "must be an integer"
+	}
+	return "must be a " + string(d.Type)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
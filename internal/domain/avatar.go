@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrAvatarNotFound = errors.New("avatar not found")
+	// ErrAvatarTooLarge is returned for uploads above the size limit
+	ErrAvatarTooLarge = errors.New("avatar too large")
+	// ErrAvatarUnsupported is returned for uploads that are not an image of
+	// an accepted format, judged by their content
+	ErrAvatarUnsupported = errors.New("unsupported avatar format")
+)
+
+// AvatarFormats are the accepted image formats of avatars
+var AvatarFormats = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+type AvatarVariant string
+
+const (
+	// AvatarOriginal is the image as uploaded
+	AvatarOriginal AvatarVariant = "original"
+	// AvatarThumbnail is a square PNG cut from the center of the image
+	AvatarThumbnail AvatarVariant = "thumbnail"
+)
+
+// Avatar describes an uploaded profile picture
+type Avatar struct {
+	UserID      int64     `json:"user_id" openapi:"required,readOnly"`
+	ContentType string    `json:"content_type" openapi:"required,readOnly,enum=image/png|image/jpeg|image/gif|image/webp" description:"Detected from the content, not the upload's Content-Type"`
+	Size        int64     `json:"size" openapi:"required,readOnly" description:"Bytes of the original image"`
+	Width       int       `json:"width" openapi:"required,readOnly"`
+	Height      int       `json:"height" openapi:"required,readOnly"`
+	UpdatedAt   time.Time `json:"updated_at" openapi:"required,readOnly"`
+}
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrChangeTokenExpired means changes since a token can't be told, the
+// client has to sync from scratch
+var ErrChangeTokenExpired = errors.New("change token expired")
+
+const changeTokenVersion = "1"
+
+// ChangeCursor is a position in the sequence of user changes: changes are
+// ordered by Seq, a sequence number assigned by the repository, then by
+// user ID. The zero cursor is the start.
+type ChangeCursor struct {
+	Seq uint64
+	ID  int64
+}
+
+// After reports whether c comes after other
+func (c ChangeCursor) After(other ChangeCursor) bool {
+	return c.Seq > other.Seq || c.Seq == other.Seq && c.ID > other.ID
+}
+
+// Token encodes the cursor for clients, who should treat it as opaque
+func (c ChangeCursor) Token() string {
+	raw := changeTokenVersion + "." + strconv.FormatUint(c.Seq, 10) + "." + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseChangeToken decodes a token made by Token, the empty token is the
+// zero cursor
+func ParseChangeToken(token string) (ChangeCursor, error) {
+	if token == "" {
+		return ChangeCursor{}, nil
+	}
+
+	invalid := &ValidationError{Entity: "changes", Violations: []FieldViolation{{Field: "since", Description: "must be a token returned as next_token"}}}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ChangeCursor{}, invalid
+	}
+	parts := strings.Split(string(raw), ".")
+	if len(parts) != 3 || parts[0] != changeTokenVersion {
+		return ChangeCursor{}, invalid
+	}
+
+	var c ChangeCursor
+	if c.Seq, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return ChangeCursor{}, invalid
+	}
+	if c.ID, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return ChangeCursor{}, invalid
+	}
+	return c, nil
+}
+
+func (c ChangeCursor) String() string {
+	return fmt.Sprintf("%d/%d", c.Seq, c.ID)
+}
+
+// UserChange is the latest state of a user changed after a cursor
+type UserChange struct {
+	Type EventType `json:"type" openapi:"required,enum=created|updated|deleted"`
+	ID   int64     `json:"id" openapi:"required"`
+	User *User     `json:"user,omitempty" description:"Absent for deleted users"`
+	Time time.Time `json:"time" openapi:"required" description:"When the user was last updated or deleted"`
+}
+
+// UserChanges are the users created, updated and deleted after a cursor
+type UserChanges struct {
+	Changes   []UserChange `json:"changes" openapi:"required"`
+	NextToken string       `json:"next_token" openapi:"required" description:"Pass as since to get the changes after these"`
+	HasMore   bool         `json:"has_more" openapi:"required" description:"More changes are available right away"`
+}
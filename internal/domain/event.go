@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+type EventType string
+
+const (
+	EventUserCreated EventType = "created"
+	EventUserUpdated EventType = "updated"
+	EventUserDeleted EventType = "deleted"
+)
+
+// EventTypes lists every user event type
+var EventTypes = []EventType{EventUserCreated, EventUserUpdated, EventUserDeleted}
+
+// UserEvent is a change made to a user. Deleted events only carry the ID.
+type UserEvent struct {
+	Type EventType `json:"type" openapi:"required,enum=created|updated|deleted"`
+	User User      `json:"user" openapi:"required"`
+	Time time.Time `json:"time" openapi:"required"`
+}
+
+// OutboxMessage is a user event recorded in the outbox by the transaction
+// that made the change. IDs follow the order the changes were written in.
+type OutboxMessage struct {
+	ID int64 `json:"id"`
+	UserEvent
+}
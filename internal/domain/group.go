@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrGroupConflict is returned when another group has the same name
+	ErrGroupConflict = errors.New("group conflicts with another group")
+	// ErrMembershipNotFound is returned when removing a user who isn't a member
+	ErrMembershipNotFound = errors.New("user is not a member of the group")
+)
+
+// Group is a team of users. A user can be a member of any number of groups
+// and leaves them all when deleted.
+type Group struct {
+	ID          int64     `json:"id" openapi:"required,readOnly"`
+	Name        string    `json:"name" openapi:"required,minLength=1,maxLength=100" description:"Unique regardless of case"`
+	Description string    `json:"description,omitempty" openapi:"maxLength=1000"`
+	CreatedAt   time.Time `json:"created_at" openapi:"required,readOnly"`
+	UpdatedAt   time.Time `json:"updated_at" openapi:"required,readOnly"`
+}
+
+// Normalize trims the name and description
+func (g *Group) Normalize() {
+	g.Name = strings.TrimSpace(g.Name)
+	g.Description = strings.TrimSpace(g.Description)
+}
+
+func (g Group) Validate() error {
+	var violations []FieldViolation
+
+	if n := utf8.RuneCountInString(g.Name); n < 1 || n > 100 {
+		violations = append(violations, FieldViolation{Field: "name", Description: "must be between 1 and 100 characters long"})
+	}
+	if utf8.RuneCountInString(g.Description) > 1000 {
+		violations = append(violations, FieldViolation{Field: "description", Description: "must be at most 1000 characters long"})
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Entity: "group", Violations: violations}
+	}
+	return nil
+}
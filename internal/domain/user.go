@@ -1,14 +1,167 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
 var (
 	ErrUserNotFound = errors.New("user not found")
+	// ErrUserConflict is wrapped by errors naming the field another user
+	// already has the same value of
+	ErrUserConflict = errors.New("user conflict")
 )
 
+const maxEmailLength = 254
+
+// e164 is an international phone number: "+", a country code not starting
+// with 0 and at most 15 digits in total
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
 type User struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
-	Age  int    `json:"age"`
-	Sex  string `json:"sex"`
+	ID    int64  `json:"id" openapi:"required,readOnly"`
+	Name  string `json:"name" openapi:"required,minLength=1,maxLength=255"`
+	Age   int    `json:"age" openapi:"required,minimum=1,maximum=149"`
+	Sex   string `json:"sex" openapi:"required,enum=male|female|other"`
+	Email string `json:"email,omitempty" openapi:"format=email,maxLength=254" description:"Unique, stored in lower case"`
+	Phone string `json:"phone,omitempty" openapi:"format=phone,maxLength=32" description:"Unique, international format; spaces, dashes, dots and parentheses are removed and a leading 00 becomes + (E.164)"`
+	// Attributes are the custom attributes defined in the registry
+	Attributes map[string]interface{} `json:"attributes,omitempty" description:"Custom attributes, as defined by the attribute registry"`
+	// CreatedAt and UpdatedAt are set by the repository
+	CreatedAt time.Time `json:"created_at" openapi:"required,readOnly"`
+	UpdatedAt time.Time `json:"updated_at" openapi:"required,readOnly" description:"Changes with every update, also when no value changed"`
+	// Addresses are only loaded when asked for
+	Addresses []Address `json:"addresses,omitempty" openapi:"readOnly" description:"Only with ?expand=addresses, omitted when the user has none"`
+}
+
+// UserFilter narrows a list of users, zero values don't filter. Results are
+// ordered by ID; Limit 0 means no limit.
+type UserFilter struct {
+	// Name matches users whose name contains it, ignoring case
+	Name   string
+	Sex    string
+	MinAge int
+	MaxAge int
+	// CreatedAfter and CreatedBefore are exclusive bounds of CreatedAt
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// UpdatedSince is an inclusive bound of UpdatedAt, so that incremental
+	// syncs passing the latest UpdatedAt they saw don't miss changes made
+	// within the same instant
+	UpdatedSince time.Time
+	// Attributes match users having each of these attribute values
+	Attributes map[string]interface{}
+	Limit      int
+	Offset     int
+}
+
+// UserSearch finds users by words of their name, also when misspelled.
+// Limit 0 means no limit.
+type UserSearch struct {
+	Query  string
+	Limit  int
+	Offset int
+}
+
+// UserSearchResult is a user matching a search, best matches first
+type UserSearchResult struct {
+	User      User    `json:"user" openapi:"required"`
+	Rank      float64 `json:"rank" openapi:"required" description:"Relevance, above 1 when every query word starts a word of the name"`
+	Highlight string  `json:"highlight" openapi:"required" description:"HTML-escaped name with the matching words wrapped in <mark> tags"`
+}
+
+// FieldViolation describes a single invalid field
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// ValidationError lists every invalid field of an entity
+type ValidationError struct {
+	Entity     string
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, fmt.Sprintf("%s %s", v.Field, v.Description))
+	}
+	return "invalid " + e.Entity + ": " + strings.Join(parts, ", ")
+}
+
+// Validate checks the same constraints the OpenAPI document declares, so
+// that transports without request validation get identical rules
+func (u User) Validate() error {
+	var violations []FieldViolation
+
+	if n := utf8.RuneCountInString(u.Name); n < 1 || n > 255 {
+		violations = append(violations, FieldViolation{Field: "name", Description: "must be between 1 and 255 characters long"})
+	}
+	if u.Age < 1 || u.Age > 149 {
+		violations = append(violations, FieldViolation{Field: "age", Description: "must be between 1 and 149"})
+	}
+	if u.Sex != "male" && u.Sex != "female" && u.Sex != "other" {
+		violations = append(violations, FieldViolation{Field: "sex", Description: "must be one of male, female, other"})
+	}
+	if u.Email != "" && !ValidEmail(u.Email) {
+		violations = append(violations, FieldViolation{Field: "email", Description: "must be a valid email address"})
+	}
+	if u.Phone != "" && !e164.MatchString(u.Phone) {
+		violations = append(violations, FieldViolation{Field: "phone", Description: "must be an international phone number like +14155550123"})
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Entity: "user", Violations: violations}
+	}
+	return nil
+}
+
+// Normalize brings email and phone to the form they are stored and
+// compared in. Validate the user afterwards.
+func (u *User) Normalize() {
+	u.Email = NormalizeEmail(u.Email)
+	u.Phone = NormalizePhone(u.Phone)
+}
+
+// NormalizeEmail trims and lowercases an email address. Lowercasing the
+// local part is not required by the RFC but is what users expect.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone removes separators from a phone number and replaces the
+// international prefix 00 with +
+func NormalizePhone(phone string) string {
+	phone = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, phone)
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	return phone
+}
+
+// ValidEmail reports whether email is a bare address, without a display
+// name or comments, with a dotted domain
+func ValidEmail(email string) bool {
+	if len(email) > maxEmailLength {
+		return false
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return false
+	}
+	at := strings.LastIndex(email, "@")
+	domain := email[at+1:]
+	return strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
 }
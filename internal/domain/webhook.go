@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+type DeliveryStatus string
+
+const (
+	// DeliveryPending deliveries are waiting for their next attempt
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryDelivered deliveries were accepted with a 2xx response
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead deliveries ran out of attempts and wait for a manual retry
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// minSecretLength is the shortest accepted signing secret
+const minSecretLength = 16
+
+// WebhookSubscription sends user events of the given types to a URL
+type WebhookSubscription struct {
+	ID         int64       `json:"id" openapi:"required,readOnly"`
+	URL        string      `json:"url" openapi:"required,format=uri,maxLength=2048"`
+	EventTypes []EventType `json:"event_types" openapi:"required"`
+	Secret     string      `json:"secret,omitempty" openapi:"minLength=16,maxLength=255" description:"HMAC-SHA256 signing key, generated when empty and only returned on creation"`
+	Disabled   bool        `json:"disabled"`
+	CreatedAt  time.Time   `json:"created_at" openapi:"required,readOnly"`
+}
+
+// WebhookDelivery is one event queued for a subscription
+type WebhookDelivery struct {
+	ID             int64          `json:"id" openapi:"required,readOnly"`
+	SubscriptionID int64          `json:"subscription_id" openapi:"required"`
+	EventType      EventType      `json:"event_type" openapi:"required,enum=created|updated|deleted"`
+	Payload        string         `json:"payload" openapi:"required" description:"Signed request body"`
+	Status         DeliveryStatus `json:"status" openapi:"required,enum=pending|delivered|dead"`
+	Attempts       int            `json:"attempts" openapi:"required"`
+	ResponseStatus int            `json:"response_status,omitempty" description:"HTTP status of the last attempt"`
+	LastError      string         `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time     `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at" openapi:"required"`
+	DeliveredAt    *time.Time     `json:"delivered_at,omitempty"`
+}
+
+// WebhookTask is a delivery claimed for sending, with its target
+type WebhookTask struct {
+	Delivery WebhookDelivery
+	URL      string
+	Secret   string
+}
+
+func (s WebhookSubscription) Validate() error {
+	var violations []FieldViolation
+
+	if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		violations = append(violations, FieldViolation{Field: "url", Description: "must be an absolute http or https URL"})
+	} else if len(s.URL) > 2048 {
+		violations = append(violations, FieldViolation{Field: "url", Description: "must be at most 2048 characters long"})
+	}
+
+	if len(s.EventTypes) == 0 {
+		violations = append(violations, FieldViolation{Field: "event_types", Description: "must not be empty"})
+	}
+	for _, eventType := range s.EventTypes {
+		if eventType != EventUserCreated && eventType != EventUserUpdated && eventType != EventUserDeleted {
+			violations = append(violations, FieldViolation{Field: "event_types", Description: "must only contain created, updated, deleted"})
+			break
+		}
+	}
+
+	if s.Secret != "" && (len(s.Secret) < minSecretLength || len(s.Secret) > 255) {
+		violations = append(violations, FieldViolation{Field: "secret", Description: "must be between 16 and 255 characters long"})
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Entity: "webhook subscription", Violations: violations}
+	}
+	return nil
+}
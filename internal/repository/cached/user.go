@@ -0,0 +1,348 @@
+// Package cached wraps repositories with read-through in-process caches
+package cached
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/internal/service"
+	"crud-without-db/pkg/cache"
+	"crud-without-db/pkg/db"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/singleflight"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Config struct {
+	// Size is the maximum number of cached users, including negative entries
+	Size int
+	TTL  time.Duration
+	// NegativeTTL is how long a missing user is remembered, 0 disables it
+	NegativeTTL time.Duration
+	// ListSize is the maximum number of cached list results, 0 disables them
+	ListSize int
+	ListTTL  time.Duration
+}
+
+// Stats are the counters of a Users cache
+type Stats struct {
+	Users cache.Stats `json:"users"`
+	Lists cache.Stats `json:"lists"`
+	// NegativeHits are user hits that answered ErrUserNotFound
+	NegativeHits uint64 `json:"negative_hits"`
+	// SharedLoads are misses that shared one load with concurrent callers
+	SharedLoads   uint64 `json:"shared_loads"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+// userEntry is a cached user, or a cached ErrUserNotFound when !found
+type userEntry struct {
+	user  domain.User
+	found bool
+}
+
+// Users caches GetByID, GetByIDs and list results of another repository.
+// Callers get copies, changing them doesn't change the cache.
+//
+// Writes through the cache invalidate it. Changes made elsewhere, by SQL or
+// other instances, are seen once the entries expire, or right away when the
+// cache receives change events (see Publish). Reads that must see the
+// primary (db.WithPrimary) bypass the cache.
+type Users struct {
+	repo   service.UsersRepository
+	config Config
+
+	users *cache.LRU[int64, userEntry]
+	lists *cache.LRU[string, []domain.User]
+	loads singleflight.Group
+
+	// generation changes with every invalidation, loads started before
+	// don't store their possibly stale result
+	mu         sync.Mutex
+	generation uint64
+
+	negativeHits  atomic.Uint64
+	sharedLoads   atomic.Uint64
+	invalidations atomic.Uint64
+}
+
+func NewUsers(repo service.UsersRepository, config Config) *Users {
+	return &Users{
+		repo:   repo,
+		config: config,
+		users:  cache.NewLRU[int64, userEntry](config.Size),
+		lists:  cache.NewLRU[string, []domain.User](config.ListSize),
+	}
+}
+
+func (c *Users) Create(ctx context.Context, user domain.User) (domain.User, error) {
+	created, err := c.repo.Create(ctx, user)
+	if err == nil {
+		// Drops a negative entry for the new ID along with the lists
+		c.Invalidate(created.ID)
+	}
+	return created, err
+}
+
+func (c *Users) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	if db.UsePrimary(ctx) {
+		return c.repo.GetByID(ctx, id)
+	}
+
+	if e, ok := c.users.Get(id); ok {
+		if !e.found {
+			c.negativeHits.Add(1)
+			return domain.User{}, domain.ErrUserNotFound
+		}
+		return cloneUser(e.user), nil
+	}
+
+	generation := c.currentGeneration()
+	// A caller going away must not fail the others waiting for the load
+	loadCtx := context.WithoutCancel(ctx)
+	v, err, shared := c.loads.Do("user:"+strconv.FormatInt(id, 10), func() (interface{}, error) {
+		user, err := c.repo.GetByID(loadCtx, id)
+		switch {
+		case err == nil:
+			c.storeUser(generation, id, userEntry{user: user, found: true})
+		case errors.Is(err, domain.ErrUserNotFound):
+			c.storeUser(generation, id, userEntry{})
+		}
+		return user, err
+	})
+	if shared {
+		c.sharedLoads.Add(1)
+	}
+
+	return cloneUser(v.(domain.User)), err
+}
+
+// GetByIDs serves cached users and loads the others in one query
+func (c *Users) GetByIDs(ctx context.Context, ids []int64) ([]domain.User, error) {
+	if db.UsePrimary(ctx) {
+		return c.repo.GetByIDs(ctx, ids)
+	}
+
+	var users []domain.User
+	var missing []int64
+	for _, id := range ids {
+		e, ok := c.users.Get(id)
+		switch {
+		case !ok:
+			missing = append(missing, id)
+		case e.found:
+			users = append(users, cloneUser(e.user))
+		default:
+			c.negativeHits.Add(1)
+		}
+	}
+	if len(missing) == 0 {
+		return users, nil
+	}
+
+	generation := c.currentGeneration()
+	loaded, err := c.repo.GetByIDs(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[int64]bool, len(loaded))
+	for _, user := range loaded {
+		found[user.ID] = true
+		c.storeUser(generation, user.ID, userEntry{user: cloneUser(user), found: true})
+	}
+	for _, id := range missing {
+		if !found[id] {
+			c.storeUser(generation, id, userEntry{})
+		}
+	}
+
+	users = append(users, loaded...)
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (c *Users) GetAll(ctx context.Context) ([]domain.User, error) {
+	return c.list(ctx, "all", func(ctx context.Context) ([]domain.User, error) {
+		return c.repo.GetAll(ctx)
+	})
+}
+
+func (c *Users) List(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	key, err := listKey(filter)
+	if err != nil {
+		return c.repo.List(ctx, filter)
+	}
+	return c.list(ctx, key, func(ctx context.Context) ([]domain.User, error) {
+		return c.repo.List(ctx, filter)
+	})
+}
+
+// listKey identifies the results of a filter. Times are compared as
+// instants, whatever their location, and attributes are encoded as JSON,
+// which sorts their names.
+func listKey(filter domain.UserFilter) (string, error) {
+	attributes, err := json.Marshal(filter.Attributes)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode attribute filter: %w", err)
+	}
+	return fmt.Sprintf("list|%q|%q|%d|%d|%s|%s|%s|%s|%d|%d",
+		filter.Name, filter.Sex, filter.MinAge, filter.MaxAge,
+		filterTime(filter.CreatedAfter), filterTime(filter.CreatedBefore), filterTime(filter.UpdatedSince),
+		attributes, filter.Limit, filter.Offset), nil
+}
+
+func filterTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// GetByEmail isn't cached, the cache couldn't tell when an email moves to
+// another user
+func (c *Users) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	return c.repo.GetByEmail(ctx, email)
+}
+
+// Changes isn't cached, every sync asks for new changes
+func (c *Users) Changes(ctx context.Context, since domain.ChangeCursor, limit int) (domain.UserChanges, error) {
+	return c.repo.Changes(ctx, since, limit)
+}
+
+// Search isn't cached, queries rarely repeat
+func (c *Users) Search(ctx context.Context, s domain.UserSearch) ([]domain.UserSearchResult, error) {
+	return c.repo.Search(ctx, s)
+}
+
+func (c *Users) Update(ctx context.Context, id int64, user domain.User) (domain.User, error) {
+	updated, err := c.repo.Update(ctx, id, user)
+	// Also on errors, the change may have been made all the same
+	c.Invalidate(id)
+	return updated, err
+}
+
+func (c *Users) Delete(ctx context.Context, id int64) error {
+	err := c.repo.Delete(ctx, id)
+	c.Invalidate(id)
+	return err
+}
+
+// Invalidate drops a user and all cached lists
+func (c *Users) Invalidate(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.users.Remove(id)
+	c.lists.Purge()
+	c.invalidations.Add(1)
+}
+
+// Purge drops everything
+func (c *Users) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.users.Purge()
+	c.lists.Purge()
+	c.invalidations.Add(1)
+}
+
+// Publish invalidates the changed user, so the cache can take change
+// events detected from the database
+func (c *Users) Publish(event domain.UserEvent) {
+	c.Invalidate(event.User.ID)
+}
+
+// Reset purges the cache when changes may have been missed
+func (c *Users) Reset() {
+	c.Purge()
+}
+
+func (c *Users) Stats() Stats {
+	return Stats{
+		Users:         c.users.Stats(),
+		Lists:         c.lists.Stats(),
+		NegativeHits:  c.negativeHits.Load(),
+		SharedLoads:   c.sharedLoads.Load(),
+		Invalidations: c.invalidations.Load(),
+	}
+}
+
+func (c *Users) list(ctx context.Context, key string, load func(ctx context.Context) ([]domain.User, error)) ([]domain.User, error) {
+	if c.config.ListSize == 0 || db.UsePrimary(ctx) {
+		return load(ctx)
+	}
+
+	if users, ok := c.lists.Get(key); ok {
+		return cloneUsers(users), nil
+	}
+
+	generation := c.currentGeneration()
+	loadCtx := context.WithoutCancel(ctx)
+	v, err, shared := c.loads.Do("list:"+key, func() (interface{}, error) {
+		users, err := load(loadCtx)
+		if err == nil {
+			c.mu.Lock()
+			if c.generation == generation {
+				c.lists.Set(key, users, c.config.ListTTL)
+			}
+			c.mu.Unlock()
+		}
+		return users, err
+	})
+	if shared {
+		c.sharedLoads.Add(1)
+	}
+
+	users, _ := v.([]domain.User)
+	return cloneUsers(users), err
+}
+
+func (c *Users) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// storeUser caches an entry unless an invalidation happened since the load started
+func (c *Users) storeUser(generation uint64, id int64, e userEntry) {
+	ttl := c.config.TTL
+	if !e.found {
+		if c.config.NegativeTTL == 0 {
+			return
+		}
+		ttl = c.config.NegativeTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation == generation {
+		c.users.Set(id, e, ttl)
+	}
+}
+
+// cloneUser copies the maps and slices of a user shared with the cache
+func cloneUser(user domain.User) domain.User {
+	user.Attributes = maps.Clone(user.Attributes)
+	user.Addresses = slices.Clone(user.Addresses)
+	return user
+}
+
+func cloneUsers(users []domain.User) []domain.User {
+	if users == nil {
+		return nil
+	}
+	clones := make([]domain.User, len(users))
+	for i, user := range users {
+		clones[i] = cloneUser(user)
+	}
+	return clones
+}
@@ -0,0 +1,365 @@
+package cached
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/internal/service"
+	"crud-without-db/pkg/cache"
+	"crud-without-db/pkg/db"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingRepo keeps users in a map and counts the calls it gets. While
+// gate is set, GetByID and List signal started and wait for gate to close.
+type countingRepo struct {
+	service.UsersRepository
+
+	mu      sync.Mutex
+	users   map[int64]domain.User
+	calls   map[string]int
+	gate    chan struct{}
+	started chan struct{}
+}
+
+func newCountingRepo(users ...domain.User) *countingRepo {
+	r := &countingRepo{users: map[int64]domain.User{}, calls: map[string]int{}}
+	for _, user := range users {
+		r.users[user.ID] = user
+	}
+	return r
+}
+
+// hold makes loads wait until the returned function releases them, later
+// loads don't wait
+func (r *countingRepo) hold() func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.gate = make(chan struct{})
+	r.started = make(chan struct{}, 100)
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		close(r.gate)
+		r.gate = nil
+	}
+}
+
+func (r *countingRepo) call(method string) {
+	r.mu.Lock()
+	r.calls[method]++
+	gate, started := r.gate, r.started
+	r.mu.Unlock()
+
+	if gate != nil {
+		started <- struct{}{}
+		<-gate
+	}
+}
+
+func (r *countingRepo) count(method string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[method]
+}
+
+func (r *countingRepo) snapshot() map[int64]domain.User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := make(map[int64]domain.User, len(r.users))
+	for id, user := range r.users {
+		users[id] = cloneUser(user)
+	}
+	return users
+}
+
+func (r *countingRepo) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	users := r.snapshot()
+	r.call("GetByID")
+
+	user, ok := users[id]
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (r *countingRepo) GetByIDs(ctx context.Context, ids []int64) ([]domain.User, error) {
+	users := r.snapshot()
+	r.call("GetByIDs")
+
+	var found []domain.User
+	for _, id := range ids {
+		if user, ok := users[id]; ok {
+			found = append(found, user)
+		}
+	}
+	return found, nil
+}
+
+func (r *countingRepo) List(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	users := r.snapshot()
+	r.call("List")
+
+	var found []domain.User
+	for id := int64(1); id <= int64(len(users)); id++ {
+		if user, ok := users[id]; ok && (filter.Sex == "" || user.Sex == filter.Sex) {
+			found = append(found, user)
+		}
+	}
+	return found, nil
+}
+
+func (r *countingRepo) Update(ctx context.Context, id int64, user domain.User) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls["Update"]++
+	if _, ok := r.users[id]; !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	user.ID = id
+	r.users[id] = user
+	return user, nil
+}
+
+func testConfig() Config {
+	return Config{
+		Size:        100,
+		TTL:         time.Minute,
+		NegativeTTL: time.Minute,
+		ListSize:    10,
+		ListTTL:     time.Minute,
+	}
+}
+
+func testUsers() []domain.User {
+	return []domain.User{
+		{ID: 1, Name: "Ann", Sex: "female", Attributes: map[string]interface{}{"plan": "pro"}},
+		{ID: 2, Name: "Bob", Sex: "male", Attributes: map[string]interface{}{"plan": "free"}},
+	}
+}
+
+func TestUsersReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	c := NewUsers(newCountingRepo(testUsers()...), testConfig())
+
+	for i := 0; i < 2; i++ {
+		user, err := c.GetByID(ctx, 1)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if user.Attributes["plan"] != "pro" {
+			t.Fatalf("call %d: plan = %v, want pro", i+1, user.Attributes["plan"])
+		}
+		user.Attributes["plan"] = "changed"
+	}
+
+	for i := 0; i < 2; i++ {
+		users, err := c.GetByIDs(ctx, []int64{1, 2})
+		if err != nil {
+			t.Fatalf("GetByIDs: %v", err)
+		}
+		if len(users) != 2 || users[1].Attributes["plan"] != "free" {
+			t.Fatalf("call %d: users = %+v, want Bob on the free plan", i+1, users)
+		}
+		users[1].Attributes["plan"] = "changed"
+	}
+
+	for i := 0; i < 2; i++ {
+		users, err := c.List(ctx, domain.UserFilter{})
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(users) != 2 || users[0].Name != "Ann" || users[0].Attributes["plan"] != "pro" {
+			t.Fatalf("call %d: users = %+v, want Ann on the pro plan first", i+1, users)
+		}
+		users[0].Name = "changed"
+		users[0].Attributes["plan"] = "changed"
+	}
+}
+
+func TestUsersNegativeCaching(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("enabled", func(t *testing.T) {
+		repo := newCountingRepo(testUsers()...)
+		c := NewUsers(repo, testConfig())
+
+		for i := 0; i < 3; i++ {
+			if _, err := c.GetByID(ctx, 3); !errors.Is(err, domain.ErrUserNotFound) {
+				t.Fatalf("GetByID error = %v, want ErrUserNotFound", err)
+			}
+		}
+		users, err := c.GetByIDs(ctx, []int64{1, 3})
+		if err != nil || len(users) != 1 {
+			t.Fatalf("GetByIDs = %+v, %v; want user 1", users, err)
+		}
+
+		if n := repo.count("GetByID"); n != 1 {
+			t.Errorf("repository GetByID calls = %d, want 1", n)
+		}
+		if n := repo.count("GetByIDs"); n != 1 {
+			t.Errorf("repository GetByIDs calls = %d, want 1 for user 1", n)
+		}
+		if n := c.Stats().NegativeHits; n != 3 {
+			t.Errorf("negative hits = %d, want 3", n)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		repo := newCountingRepo(testUsers()...)
+		config := testConfig()
+		config.NegativeTTL = 0
+		c := NewUsers(repo, config)
+
+		for i := 0; i < 3; i++ {
+			if _, err := c.GetByID(ctx, 3); !errors.Is(err, domain.ErrUserNotFound) {
+				t.Fatalf("GetByID error = %v, want ErrUserNotFound", err)
+			}
+		}
+		if n := repo.count("GetByID"); n != 3 {
+			t.Errorf("repository GetByID calls = %d, want 3", n)
+		}
+	})
+}
+
+func TestUsersSharesConcurrentLoads(t *testing.T) {
+	const callers = 10
+	ctx := context.Background()
+	repo := newCountingRepo(testUsers()...)
+	c := NewUsers(repo, testConfig())
+
+	release := repo.hold()
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := c.GetByID(ctx, 1)
+			if err == nil && user.Name != "Ann" {
+				err = errors.New("got " + user.Name)
+			}
+			errs <- err
+		}()
+	}
+	<-repo.started
+	// Let the other callers join the load before it completes; callers
+	// arriving later are served from the cache
+	time.Sleep(20 * time.Millisecond)
+	release()
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("GetByID: %v", err)
+		}
+	}
+	if n := repo.count("GetByID"); n != 1 {
+		t.Errorf("repository GetByID calls = %d, want 1", n)
+	}
+	// Every caller of a shared load counts, the first one too
+	stats := c.Stats()
+	if stats.SharedLoads == 0 || stats.SharedLoads+stats.Users.Hits != callers {
+		t.Errorf("shared loads %d and hits %d, want %d callers served by one load", stats.SharedLoads, stats.Users.Hits, callers)
+	}
+}
+
+func TestUsersDiscardsLoadsInvalidatedByWrite(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("user", func(t *testing.T) {
+		repo := newCountingRepo(testUsers()...)
+		c := NewUsers(repo, testConfig())
+
+		release := repo.hold()
+		loaded := make(chan domain.User)
+		go func() {
+			user, _ := c.GetByID(ctx, 1)
+			loaded <- user
+		}()
+		<-repo.started
+
+		// The load read Ann before the update and completes after it
+		if _, err := c.Update(ctx, 1, domain.User{Name: "Ann Updated"}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		release()
+		if user := <-loaded; user.Name != "Ann" {
+			t.Fatalf("concurrent load = %s, want the state it read", user.Name)
+		}
+
+		user, err := c.GetByID(ctx, 1)
+		if err != nil || user.Name != "Ann Updated" {
+			t.Fatalf("GetByID = %s, %v; want the updated user", user.Name, err)
+		}
+		if n := repo.count("GetByID"); n != 2 {
+			t.Errorf("repository GetByID calls = %d, want 2", n)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		repo := newCountingRepo(testUsers()...)
+		c := NewUsers(repo, testConfig())
+
+		release := repo.hold()
+		loaded := make(chan []domain.User)
+		go func() {
+			users, _ := c.List(ctx, domain.UserFilter{Sex: "female"})
+			loaded <- users
+		}()
+		<-repo.started
+
+		if _, err := c.Update(ctx, 2, domain.User{Name: "Bo", Sex: "female"}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		release()
+		if users := <-loaded; len(users) != 1 {
+			t.Fatalf("concurrent load = %+v, want the state it read", users)
+		}
+
+		users, err := c.List(ctx, domain.UserFilter{Sex: "female"})
+		if err != nil || len(users) != 2 {
+			t.Fatalf("List = %+v, %v; want both users", users, err)
+		}
+		if n := repo.count("List"); n != 2 {
+			t.Errorf("repository List calls = %d, want 2", n)
+		}
+	})
+}
+
+func TestUsersStats(t *testing.T) {
+	ctx := context.Background()
+	repo := newCountingRepo(testUsers()...)
+	c := NewUsers(repo, testConfig())
+
+	c.GetByID(ctx, 1)                           // miss
+	c.GetByID(ctx, 1)                           // hit
+	c.GetByID(ctx, 3)                           // miss, cached as not found
+	c.GetByID(ctx, 3)                           // negative hit
+	c.GetByID(db.WithPrimary(ctx), 1)           // bypasses the cache
+	c.List(ctx, domain.UserFilter{})            // miss
+	c.List(ctx, domain.UserFilter{})            // hit
+	c.List(ctx, domain.UserFilter{Sex: "male"}) // miss
+	c.Update(ctx, 1, domain.User{Name: "Ann"})  // invalidates user 1 and the lists
+	c.Publish(domain.UserEvent{User: domain.User{ID: 2}})
+
+	want := Stats{
+		Users:         cache.Stats{Hits: 2, Misses: 2, Entries: 1},
+		Lists:         cache.Stats{Hits: 1, Misses: 2},
+		NegativeHits:  1,
+		Invalidations: 2,
+	}
+	if got := c.Stats(); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+	if n := repo.count("GetByID"); n != 3 {
+		t.Errorf("repository GetByID calls = %d, want 3", n)
+	}
+}
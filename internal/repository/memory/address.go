@@ -0,0 +1,154 @@
+package memory
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Addresses stores the postal addresses of users in a map. Deleting a user
+// removes their addresses.
+type Addresses struct {
+	mu        sync.RWMutex
+	nextID    int64
+	addresses map[int64]domain.Address
+	users     *Users
+}
+
+// NewAddresses creates the addresses of users, whose deletions it follows
+func NewAddresses(users *Users) *Addresses {
+	r := &Addresses{
+		addresses: make(map[int64]domain.Address),
+		users:     users,
+	}
+	users.onDelete(r.removeUser)
+	return r
+}
+
+func (r *Addresses) List(ctx context.Context, userID int64) ([]domain.Address, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, err := r.users.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return r.of(userID), nil
+}
+
+func (r *Addresses) Get(ctx context.Context, userID, id int64) (domain.Address, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	address, ok := r.addresses[id]
+	if !ok || address.UserID != userID {
+		return domain.Address{}, domain.ErrAddressNotFound
+	}
+	return address, nil
+}
+
+// Create checks the user exists with the addresses locked, like AddMember
+// of Groups
+func (r *Addresses) Create(ctx context.Context, address domain.Address) (domain.Address, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.users.GetByID(ctx, address.UserID); err != nil {
+		return domain.Address{}, err
+	}
+
+	current, hasDefault := r.defaultOf(address.UserID)
+	address.Default = address.Default || !hasDefault
+	if address.Default && hasDefault {
+		r.setDefault(current, false)
+	}
+
+	r.nextID++
+	address.ID = r.nextID
+	address.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	address.UpdatedAt = address.CreatedAt
+	r.addresses[address.ID] = address
+
+	return address, nil
+}
+
+func (r *Addresses) Update(ctx context.Context, userID, id int64, address domain.Address) (domain.Address, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.addresses[id]
+	if !ok || old.UserID != userID {
+		return domain.Address{}, domain.ErrAddressNotFound
+	}
+
+	current, hasDefault := r.defaultOf(userID)
+	address.Default = address.Default || old.Default || !hasDefault
+	if address.Default && !old.Default && hasDefault {
+		r.setDefault(current, false)
+	}
+
+	address.ID = id
+	address.UserID = userID
+	address.CreatedAt = old.CreatedAt
+	address.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	r.addresses[id] = address
+
+	return address, nil
+}
+
+func (r *Addresses) Delete(ctx context.Context, userID, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	address, ok := r.addresses[id]
+	if !ok || address.UserID != userID {
+		return domain.ErrAddressNotFound
+	}
+	delete(r.addresses, id)
+
+	if remaining := r.of(userID); address.Default && len(remaining) > 0 {
+		r.setDefault(remaining[0], true)
+	}
+
+	return nil
+}
+
+// removeUser is the delete hook of users
+func (r *Addresses) removeUser(userID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, address := range r.addresses {
+		if address.UserID == userID {
+			delete(r.addresses, id)
+		}
+	}
+}
+
+// of returns the addresses of a user ordered by ID
+func (r *Addresses) of(userID int64) []domain.Address {
+	addresses := []domain.Address{}
+	for _, address := range r.addresses {
+		if address.UserID == userID {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].ID < addresses[j].ID })
+	return addresses
+}
+
+func (r *Addresses) defaultOf(userID int64) (domain.Address, bool) {
+	for _, address := range r.addresses {
+		if address.UserID == userID && address.Default {
+			return address, true
+		}
+	}
+	return domain.Address{}, false
+}
+
+func (r *Addresses) setDefault(address domain.Address, isDefault bool) {
+	address.Default = isDefault
+	address.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	r.addresses[address.ID] = address
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Attributes stores the definitions of custom user attributes in a map
+type Attributes struct {
+	mu          sync.RWMutex
+	definitions map[string]domain.AttributeDefinition
+	users       *Users
+}
+
+// NewAttributes creates the registry for the attributes of users, which
+// are checked before a definition is deleted
+func NewAttributes(users *Users) *Attributes {
+	return &Attributes{
+		definitions: make(map[string]domain.AttributeDefinition),
+		users:       users,
+	}
+}
+
+func (r *Attributes) List(ctx context.Context) ([]domain.AttributeDefinition, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	definitions := make([]domain.AttributeDefinition, 0, len(r.definitions))
+	for _, definition := range r.definitions {
+		definitions = append(definitions, definition)
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Name < definitions[j].Name })
+	return definitions, nil
+}
+
+func (r *Attributes) Get(ctx context.Context, name string) (domain.AttributeDefinition, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	definition, ok := r.definitions[name]
+	if !ok {
+		return domain.AttributeDefinition{}, domain.ErrAttributeNotFound
+	}
+	return definition, nil
+}
+
+func (r *Attributes) Put(ctx context.Context, definition domain.AttributeDefinition) (domain.AttributeDefinition, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	old, exists := r.definitions[definition.Name]
+	definition.CreatedAt = now
+	if exists {
+		definition.CreatedAt = old.CreatedAt
+	}
+	definition.UpdatedAt = now
+	r.definitions[definition.Name] = definition
+
+	return definition, !exists, nil
+}
+
+func (r *Attributes) Delete(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.definitions[name]; !ok {
+		return domain.ErrAttributeNotFound
+	}
+	if r.users.inUse(name) {
+		return domain.ErrAttributeInUse
+	}
+	delete(r.definitions, name)
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package memory
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Groups stores groups and their memberships in maps. Deleting a user
+// removes their memberships.
+type Groups struct {
+	mu     sync.RWMutex
+	nextID int64
+	groups map[int64]domain.Group
+	// members maps groups to their users, groupsOf users to their groups
+	members  map[int64]map[int64]struct{}
+	groupsOf map[int64]map[int64]struct{}
+	users    *Users
+}
+
+// NewGroups creates the groups of users, whose deletions it follows
+func NewGroups(users *Users) *Groups {
+	r := &Groups{
+		groups:   make(map[int64]domain.Group),
+		members:  make(map[int64]map[int64]struct{}),
+		groupsOf: make(map[int64]map[int64]struct{}),
+		users:    users,
+	}
+	users.onDelete(r.removeUser)
+	return r
+}
+
+func (r *Groups) Create(ctx context.Context, group domain.Group) (domain.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkUnique(0, group); err != nil {
+		return domain.Group{}, err
+	}
+
+	r.nextID++
+	group.ID = r.nextID
+	group.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	group.UpdatedAt = group.CreatedAt
+	r.groups[group.ID] = group
+
+	return group, nil
+}
+
+func (r *Groups) GetByID(ctx context.Context, id int64) (domain.Group, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	group, ok := r.groups[id]
+	if !ok {
+		return domain.Group{}, domain.ErrGroupNotFound
+	}
+	return group, nil
+}
+
+func (r *Groups) List(ctx context.Context) ([]domain.Group, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := make([]domain.Group, 0, len(r.groups))
+	for _, group := range r.groups {
+		groups = append(groups, group)
+	}
+	sortGroups(groups)
+	return groups, nil
+}
+
+func (r *Groups) Update(ctx context.Context, id int64, group domain.Group) (domain.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.groups[id]
+	if !ok {
+		return domain.Group{}, domain.ErrGroupNotFound
+	}
+	if err := r.checkUnique(id, group); err != nil {
+		return domain.Group{}, err
+	}
+
+	group.ID = id
+	group.CreatedAt = old.CreatedAt
+	group.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	r.groups[id] = group
+
+	return group, nil
+}
+
+func (r *Groups) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[id]; !ok {
+		return domain.ErrGroupNotFound
+	}
+
+	for userID := range r.members[id] {
+		removeMember(r.groupsOf, userID, id)
+	}
+	delete(r.members, id)
+	delete(r.groups, id)
+
+	return nil
+}
+
+// AddMember checks the user exists with the groups locked, so a user
+// deleted concurrently is either never added or removed by the delete hook
+func (r *Groups) AddMember(ctx context.Context, groupID, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[groupID]; !ok {
+		return domain.ErrGroupNotFound
+	}
+	if _, err := r.users.GetByID(ctx, userID); err != nil {
+		return err
+	}
+
+	addMember(r.members, groupID, userID)
+	addMember(r.groupsOf, userID, groupID)
+
+	return nil
+}
+
+func (r *Groups) RemoveMember(ctx context.Context, groupID, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.members[groupID][userID]; !ok {
+		return domain.ErrMembershipNotFound
+	}
+
+	removeMember(r.members, groupID, userID)
+	removeMember(r.groupsOf, userID, groupID)
+
+	return nil
+}
+
+func (r *Groups) Members(ctx context.Context, groupID int64) ([]domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.groups[groupID]; !ok {
+		return nil, domain.ErrGroupNotFound
+	}
+
+	ids := make([]int64, 0, len(r.members[groupID]))
+	for id := range r.members[groupID] {
+		ids = append(ids, id)
+	}
+	return r.users.GetByIDs(ctx, ids)
+}
+
+func (r *Groups) UserGroups(ctx context.Context, userID int64) ([]domain.Group, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, err := r.users.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	groups := make([]domain.Group, 0, len(r.groupsOf[userID]))
+	for id := range r.groupsOf[userID] {
+		groups = append(groups, r.groups[id])
+	}
+	sortGroups(groups)
+	return groups, nil
+}
+
+// removeUser is the delete hook of users
+func (r *Groups) removeUser(userID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for groupID := range r.groupsOf[userID] {
+		removeMember(r.members, groupID, userID)
+	}
+	delete(r.groupsOf, userID)
+}
+
+// checkUnique returns a conflict when another group than id has the name
+// of group, regardless of case
+func (r *Groups) checkUnique(id int64, group domain.Group) error {
+	for _, other := range r.groups {
+		if other.ID != id && strings.EqualFold(other.Name, group.Name) {
+			return fmt.Errorf("%w: name is already in use", domain.ErrGroupConflict)
+		}
+	}
+	return nil
+}
+
+func addMember(index map[int64]map[int64]struct{}, key, id int64) {
+	ids, ok := index[key]
+	if !ok {
+		ids = make(map[int64]struct{})
+		index[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func removeMember(index map[int64]map[int64]struct{}, key, id int64) {
+	if ids, ok := index[key]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(index, key)
+		}
+	}
+}
+
+func sortGroups(groups []domain.Group) {
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+}
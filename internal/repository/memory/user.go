@@ -0,0 +1,440 @@
+// Package memory keeps repositories in process memory, for development and
+// environments without PostgreSQL. Data is lost on restart.
+package memory
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/search"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Users stores users in a map, indexing the words and trigrams of their
+// names for search and their unique emails and phones
+type Users struct {
+	mu     sync.RWMutex
+	nextID int64
+	users  map[int64]domain.User
+	emails map[string]int64
+	phones map[string]int64
+
+	// seq numbers the changes for sync, each user remembers the changes
+	// that created and last changed it, deleted users leave a tombstone
+	seq        uint64
+	positions  map[int64]position
+	tombstones map[int64]tombstone
+
+	// terms and trigrams map the words of names and their trigrams to users
+	terms    map[string]map[int64]struct{}
+	trigrams map[string]map[int64]struct{}
+
+	// deleteHooks clean up data of other repositories that refers to users
+	deleteHooks []func(id int64)
+}
+
+func NewUsers() *Users {
+	return &Users{
+		users:      make(map[int64]domain.User),
+		emails:     make(map[string]int64),
+		phones:     make(map[string]int64),
+		positions:  make(map[int64]position),
+		tombstones: make(map[int64]tombstone),
+		terms:      make(map[string]map[int64]struct{}),
+		trigrams:   make(map[string]map[int64]struct{}),
+	}
+}
+
+func (r *Users) Create(ctx context.Context, user domain.User) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkUnique(0, user); err != nil {
+		return domain.User{}, err
+	}
+
+	r.nextID++
+	user.ID = r.nextID
+	user.Attributes = copyAttributes(user.Attributes)
+	user.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	user.UpdatedAt = user.CreatedAt
+	r.users[user.ID] = user
+	r.index(user)
+	r.seq++
+	r.positions[user.ID] = position{created: r.seq, changed: r.seq}
+
+	return user, nil
+}
+
+func (r *Users) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// GetByEmail finds a user by normalized email address
+func (r *Users) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.emails[strings.ToLower(email)]
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return r.users[id], nil
+}
+
+// GetByIDs returns the existing users among ids, missing IDs are skipped
+func (r *Users) GetByIDs(ctx context.Context, ids []int64) ([]domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[int64]bool, len(ids))
+	var users []domain.User
+	for _, id := range ids {
+		if user, ok := r.users[id]; ok && !seen[id] {
+			seen[id] = true
+			users = append(users, user)
+		}
+	}
+	sortByID(users)
+	return users, nil
+}
+
+func (r *Users) GetAll(ctx context.Context) ([]domain.User, error) {
+	return r.List(ctx, domain.UserFilter{})
+}
+
+func (r *Users) List(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name := strings.ToLower(filter.Name)
+	var users []domain.User
+	for _, user := range r.users {
+		switch {
+		case name != "" && !strings.Contains(strings.ToLower(user.Name), name):
+		case filter.Sex != "" && user.Sex != filter.Sex:
+		case filter.MinAge > 0 && user.Age < filter.MinAge:
+		case filter.MaxAge > 0 && user.Age > filter.MaxAge:
+		case !filter.CreatedAfter.IsZero() && !user.CreatedAt.After(filter.CreatedAfter):
+		case !filter.CreatedBefore.IsZero() && !user.CreatedAt.Before(filter.CreatedBefore):
+		case !filter.UpdatedSince.IsZero() && user.UpdatedAt.Before(filter.UpdatedSince):
+		case !hasAttributes(user, filter.Attributes):
+		default:
+			users = append(users, user)
+		}
+	}
+	sortByID(users)
+
+	return page(users, filter.Limit, filter.Offset), nil
+}
+
+// Search ranks users like the PostgreSQL backend: names whose words start
+// with every query term first, then by trigram word similarity
+func (r *Users) Search(ctx context.Context, s domain.UserSearch) ([]domain.UserSearchResult, error) {
+	queryTerms := search.Terms(s.Query)
+	if len(queryTerms) == 0 {
+		return nil, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Prefix matches come from the word index, misspellings share trigrams
+	candidates := make(map[int64]struct{})
+	for _, term := range queryTerms {
+		for word, ids := range r.terms {
+			if strings.HasPrefix(word, term) {
+				for id := range ids {
+					candidates[id] = struct{}{}
+				}
+			}
+		}
+		for _, trigram := range search.Trigrams(term) {
+			for id := range r.trigrams[trigram] {
+				candidates[id] = struct{}{}
+			}
+		}
+	}
+
+	var results []domain.UserSearchResult
+	for id := range candidates {
+		user := r.users[id]
+		nameTerms := search.Terms(user.Name)
+		prefixMatch := search.PrefixMatch(queryTerms, nameTerms)
+		similarity := search.WordSimilarity(queryTerms, nameTerms)
+		if !prefixMatch && similarity < search.SimilarityThreshold {
+			continue
+		}
+		results = append(results, domain.UserSearchResult{
+			User: user,
+			Rank: search.Rank(prefixMatch, similarity),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].User.ID < results[j].User.ID
+	})
+
+	return page(results, s.Limit, s.Offset), nil
+}
+
+func (r *Users) Update(ctx context.Context, id int64, user domain.User) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.users[id]
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	if err := r.checkUnique(id, user); err != nil {
+		return domain.User{}, err
+	}
+
+	r.unindex(old)
+	user.ID = id
+	user.Attributes = copyAttributes(user.Attributes)
+	user.CreatedAt = old.CreatedAt
+	user.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	r.users[id] = user
+	r.index(user)
+	r.seq++
+	r.positions[id] = position{created: r.positions[id].created, changed: r.seq}
+
+	return user, nil
+}
+
+// Delete removes the user, then runs the delete hooks of dependent
+// repositories outside the lock
+func (r *Users) Delete(ctx context.Context, id int64) error {
+	hooks, err := r.remove(id)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		hook(id)
+	}
+	return nil
+}
+
+func (r *Users) remove(id int64) ([]func(id int64), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+
+	r.unindex(user)
+	delete(r.users, id)
+	delete(r.positions, id)
+	r.seq++
+	r.tombstones[id] = tombstone{seq: r.seq, at: time.Now().UTC().Truncate(time.Microsecond)}
+
+	return r.deleteHooks, nil
+}
+
+// onDelete registers a hook run after a user is deleted, like ON DELETE
+// CASCADE in PostgreSQL
+func (r *Users) onDelete(hook func(id int64)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deleteHooks = append(r.deleteHooks, hook)
+}
+
+// Changes returns the users created, updated and deleted after since in
+// the order of their last change
+func (r *Users) Changes(ctx context.Context, since domain.ChangeCursor, limit int) (domain.UserChanges, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Changes are made under the lock, all of them up to seq are done
+	horizon := r.seq + 1
+	if since.Seq > horizon {
+		return domain.UserChanges{}, domain.ErrChangeTokenExpired
+	}
+
+	type change struct {
+		cursor domain.ChangeCursor
+		change domain.UserChange
+	}
+	var changes []change
+	for id, user := range r.users {
+		pos := r.positions[id]
+		cursor := domain.ChangeCursor{Seq: pos.changed, ID: id}
+		if !cursor.After(since) {
+			continue
+		}
+		eventType := domain.EventUserUpdated
+		if (domain.ChangeCursor{Seq: pos.created, ID: id}).After(since) {
+			eventType = domain.EventUserCreated
+		}
+		changes = append(changes, change{cursor, domain.UserChange{Type: eventType, ID: id, User: &user, Time: user.UpdatedAt}})
+	}
+	// Clients syncing from scratch don't need tombstones
+	if since != (domain.ChangeCursor{}) {
+		for id, t := range r.tombstones {
+			cursor := domain.ChangeCursor{Seq: t.seq, ID: id}
+			if cursor.After(since) {
+				changes = append(changes, change{cursor, domain.UserChange{Type: domain.EventUserDeleted, ID: id, Time: t.at}})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[j].cursor.After(changes[i].cursor) })
+
+	result := domain.UserChanges{Changes: []domain.UserChange{}}
+	next := domain.ChangeCursor{Seq: horizon}
+	if len(changes) > limit {
+		changes = changes[:limit]
+		result.HasMore = true
+		next = changes[limit-1].cursor
+	}
+	for _, c := range changes {
+		result.Changes = append(result.Changes, c.change)
+	}
+	if since.After(next) {
+		next = since
+	}
+	result.NextToken = next.Token()
+
+	return result, nil
+}
+
+// inUse reports whether any user has a value for the attribute
+func (r *Users) inUse(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if _, ok := user.Attributes[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnique returns a conflict when another user than id has the email
+// or phone of user
+func (r *Users) checkUnique(id int64, user domain.User) error {
+	if other, ok := r.emails[strings.ToLower(user.Email)]; ok && user.Email != "" && other != id {
+		return fmt.Errorf("%w: email is already in use", domain.ErrUserConflict)
+	}
+	if other, ok := r.phones[user.Phone]; ok && user.Phone != "" && other != id {
+		return fmt.Errorf("%w: phone is already in use", domain.ErrUserConflict)
+	}
+	return nil
+}
+
+// index must be called with the write lock held
+func (r *Users) index(user domain.User) {
+	if user.Email != "" {
+		r.emails[strings.ToLower(user.Email)] = user.ID
+	}
+	if user.Phone != "" {
+		r.phones[user.Phone] = user.ID
+	}
+	for _, term := range search.Terms(user.Name) {
+		add(r.terms, term, user.ID)
+		for _, trigram := range search.Trigrams(term) {
+			add(r.trigrams, trigram, user.ID)
+		}
+	}
+}
+
+// unindex must be called with the write lock held
+func (r *Users) unindex(user domain.User) {
+	delete(r.emails, strings.ToLower(user.Email))
+	delete(r.phones, user.Phone)
+	for _, term := range search.Terms(user.Name) {
+		remove(r.terms, term, user.ID)
+		for _, trigram := range search.Trigrams(term) {
+			remove(r.trigrams, trigram, user.ID)
+		}
+	}
+}
+
+// position is where a user was created and last changed in the sequence
+// of changes
+type position struct {
+	created uint64
+	changed uint64
+}
+
+type tombstone struct {
+	seq uint64
+	at  time.Time
+}
+
+func add(index map[string]map[int64]struct{}, key string, id int64) {
+	ids, ok := index[key]
+	if !ok {
+		ids = make(map[int64]struct{})
+		index[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func remove(index map[string]map[int64]struct{}, key string, id int64) {
+	if ids, ok := index[key]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(index, key)
+		}
+	}
+}
+
+// hasAttributes reports whether user has all the attribute values, like
+// JSONB containment
+func hasAttributes(user domain.User, attributes map[string]interface{}) bool {
+	for name, value := range attributes {
+		if actual, ok := user.Attributes[name]; !ok || !reflect.DeepEqual(actual, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// copyAttributes keeps callers from changing stored attributes, values are
+// scalars so a shallow copy is enough
+func copyAttributes(attributes map[string]interface{}) map[string]interface{} {
+	if len(attributes) == 0 {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(attributes))
+	for name, value := range attributes {
+		copied[name] = value
+	}
+	return copied
+}
+
+func sortByID(users []domain.User) {
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+}
+
+// page applies a limit (0 means none) and offset
+func page[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
@@ -0,0 +1,244 @@
+package psql
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/db"
+	"database/sql"
+	"fmt"
+)
+
+// Addresses stores the postal addresses of users. Changes lock the user's
+// row, so the single default address is maintained one change at a time;
+// a partial unique index guards it as well.
+type Addresses struct {
+	db *db.Cluster
+}
+
+func NewAddresses(db *db.Cluster) *Addresses {
+	return &Addresses{db: db}
+}
+
+const addressColumns = `id, user_id, label, line1, line2, city, region, postal_code, country, is_default, created_at, updated_at`
+
+func (r *Addresses) List(ctx context.Context, userID int64) ([]domain.Address, error) {
+	reader := r.db.Reader(ctx)
+	if err := checkExists(ctx, reader, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userID, domain.ErrUserNotFound); err != nil {
+		return nil, err
+	}
+
+	rows, err := reader.QueryContext(ctx, `SELECT `+addressColumns+` FROM user_addresses WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses: %w", err)
+	}
+	defer rows.Close()
+
+	addresses := []domain.Address{}
+	for rows.Next() {
+		address, err := scanAddress(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan address: %w", err)
+		}
+		addresses = append(addresses, address)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return addresses, nil
+}
+
+func (r *Addresses) Get(ctx context.Context, userID, id int64) (domain.Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM user_addresses WHERE id = $1 AND user_id = $2`
+
+	address, err := scanAddress(r.db.Reader(ctx).QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return address, domain.ErrAddressNotFound
+		}
+		return address, fmt.Errorf("failed to get address: %w", err)
+	}
+
+	return address, nil
+}
+
+// Create makes the address the default when asked to or when the user has
+// no default yet
+func (r *Addresses) Create(ctx context.Context, address domain.Address) (domain.Address, error) {
+	query := `
+		INSERT INTO user_addresses (user_id, label, line1, line2, city, region, postal_code, country, is_default)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, updated_at`
+
+	err := r.inUserTx(ctx, address.UserID, func(tx *sql.Tx, hasDefault bool) error {
+		address.Default = address.Default || !hasDefault
+		if address.Default && hasDefault {
+			if err := unsetDefault(ctx, tx, address.UserID); err != nil {
+				return err
+			}
+		}
+
+		err := tx.QueryRowContext(ctx, query, address.UserID, address.Label, address.Line1, address.Line2, address.City,
+			address.Region, address.PostalCode, address.Country, address.Default).
+			Scan(&address.ID, &address.CreatedAt, &address.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create address: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.Address{}, err
+	}
+
+	return address, nil
+}
+
+// Update keeps the default address the default
+func (r *Addresses) Update(ctx context.Context, userID, id int64, address domain.Address) (domain.Address, error) {
+	query := `
+		UPDATE user_addresses
+		SET label = $1, line1 = $2, line2 = $3, city = $4, region = $5, postal_code = $6, country = $7,
+			is_default = $8, updated_at = now()
+		WHERE id = $9 AND user_id = $10
+		RETURNING created_at, updated_at`
+
+	err := r.inUserTx(ctx, userID, func(tx *sql.Tx, hasDefault bool) error {
+		var wasDefault bool
+		err := tx.QueryRowContext(ctx, `SELECT is_default FROM user_addresses WHERE id = $1 AND user_id = $2`, id, userID).
+			Scan(&wasDefault)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return domain.ErrAddressNotFound
+			}
+			return fmt.Errorf("failed to get address: %w", err)
+		}
+
+		address.Default = address.Default || wasDefault || !hasDefault
+		if address.Default && !wasDefault && hasDefault {
+			if err := unsetDefault(ctx, tx, userID); err != nil {
+				return err
+			}
+		}
+
+		err = tx.QueryRowContext(ctx, query, address.Label, address.Line1, address.Line2, address.City, address.Region,
+			address.PostalCode, address.Country, address.Default, id, userID).
+			Scan(&address.CreatedAt, &address.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to update address: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.Address{}, err
+	}
+
+	address.ID = id
+	address.UserID = userID
+	return address, nil
+}
+
+// Delete makes the oldest remaining address the default when the default
+// is deleted
+func (r *Addresses) Delete(ctx context.Context, userID, id int64) error {
+	return r.inUserTx(ctx, userID, func(tx *sql.Tx, hasDefault bool) error {
+		var wasDefault bool
+		err := tx.QueryRowContext(ctx, `DELETE FROM user_addresses WHERE id = $1 AND user_id = $2 RETURNING is_default`, id, userID).
+			Scan(&wasDefault)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return domain.ErrAddressNotFound
+			}
+			return fmt.Errorf("failed to delete address: %w", err)
+		}
+
+		if wasDefault {
+			query := `
+				UPDATE user_addresses SET is_default = true, updated_at = now()
+				WHERE id = (SELECT min(id) FROM user_addresses WHERE user_id = $1)`
+			if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+				return fmt.Errorf("failed to set default address: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// inUserTx runs fn in a transaction holding a lock on the user's row,
+// telling it whether the user has a default address
+func (r *Addresses) inUserTx(ctx context.Context, userID int64, fn func(tx *sql.Tx, hasDefault bool) error) error {
+	tx, err := r.db.Primary().BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT EXISTS (SELECT 1 FROM user_addresses WHERE user_id = $1 AND is_default)
+		FROM users WHERE id = $1
+		FOR NO KEY UPDATE`
+
+	var hasDefault bool
+	if err := tx.QueryRowContext(ctx, query, userID).Scan(&hasDefault); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.ErrUserNotFound
+		}
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	if err := fn(tx, hasDefault); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func unsetDefault(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `UPDATE user_addresses SET is_default = false, updated_at = now() WHERE user_id = $1 AND is_default`
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to unset default address: %w", err)
+	}
+	return nil
+}
+
+func scanAddress(row rowScanner) (domain.Address, error) {
+	var a domain.Address
+	err := row.Scan(&a.ID, &a.UserID, &a.Label, &a.Line1, &a.Line2, &a.City, &a.Region, &a.PostalCode, &a.Country,
+		&a.Default, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
+
+// InitSchema creates the addresses table if it doesn't exist. The users
+// table must exist first.
+func (r *Addresses) InitSchema() error {
+	queries := []string{`
+		CREATE TABLE IF NOT EXISTS user_addresses (
+			id BIGSERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			label VARCHAR(50) NOT NULL DEFAULT '',
+			line1 VARCHAR(200) NOT NULL,
+			line2 VARCHAR(200) NOT NULL DEFAULT '',
+			city VARCHAR(100) NOT NULL,
+			region VARCHAR(100) NOT NULL DEFAULT '',
+			postal_code VARCHAR(16) NOT NULL DEFAULT '',
+			country CHAR(2) NOT NULL,
+			is_default BOOLEAN NOT NULL DEFAULT false,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_addresses_user ON user_addresses(user_id, id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_user_addresses_default ON user_addresses(user_id) WHERE is_default`,
+	}
+
+	for _, query := range queries {
+		if _, err := r.db.Primary().Exec(query); err != nil {
+			return fmt.Errorf("failed to create addresses table: %w", err)
+		}
+	}
+
+	return nil
+}
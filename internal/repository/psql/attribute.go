@@ -0,0 +1,146 @@
+package psql
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/db"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// Attributes stores the definitions of custom user attributes, the rules
+// of each as a JSONB document
+type Attributes struct {
+	db *db.Cluster
+}
+
+func NewAttributes(db *db.Cluster) *Attributes {
+	return &Attributes{db: db}
+}
+
+func (r *Attributes) List(ctx context.Context) ([]domain.AttributeDefinition, error) {
+	query := `SELECT name, definition, created_at, updated_at FROM user_attributes ORDER BY name`
+
+	rows, err := r.db.Reader(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attributes: %w", err)
+	}
+	defer rows.Close()
+
+	definitions := []domain.AttributeDefinition{}
+	for rows.Next() {
+		definition, err := scanAttribute(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attribute: %w", err)
+		}
+		definitions = append(definitions, definition)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return definitions, nil
+}
+
+func (r *Attributes) Get(ctx context.Context, name string) (domain.AttributeDefinition, error) {
+	query := `SELECT name, definition, created_at, updated_at FROM user_attributes WHERE name = $1`
+
+	definition, err := scanAttribute(r.db.Reader(ctx).QueryRowContext(ctx, query, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return definition, domain.ErrAttributeNotFound
+		}
+		return definition, fmt.Errorf("failed to get attribute: %w", err)
+	}
+
+	return definition, nil
+}
+
+// Put creates or replaces a definition, a row inserted rather than updated
+// has no xmax
+func (r *Attributes) Put(ctx context.Context, definition domain.AttributeDefinition) (domain.AttributeDefinition, bool, error) {
+	query := `
+		INSERT INTO user_attributes (name, definition)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET definition = EXCLUDED.definition, updated_at = now()
+		RETURNING created_at, updated_at, xmax = 0`
+
+	rules, err := json.Marshal(definition)
+	if err != nil {
+		return definition, false, fmt.Errorf("failed to encode attribute: %w", err)
+	}
+
+	var created bool
+	err = r.db.Primary().QueryRowContext(ctx, query, definition.Name, string(rules)).
+		Scan(&definition.CreatedAt, &definition.UpdatedAt, &created)
+	if err != nil {
+		return definition, false, fmt.Errorf("failed to put attribute: %w", err)
+	}
+
+	return definition, created, nil
+}
+
+// Delete removes a definition no user has a value for, the check uses the
+// GIN index on users.attributes
+func (r *Attributes) Delete(ctx context.Context, name string) error {
+	query := `
+		WITH deleted AS (
+			DELETE FROM user_attributes
+			WHERE name = $1 AND NOT EXISTS (SELECT 1 FROM users WHERE attributes ? $1)
+			RETURNING name
+		)
+		SELECT EXISTS (SELECT 1 FROM deleted), EXISTS (SELECT 1 FROM user_attributes WHERE name = $1)`
+
+	var deleted, exists bool
+	if err := r.db.Primary().QueryRowContext(ctx, query, name).Scan(&deleted, &exists); err != nil {
+		return fmt.Errorf("failed to delete attribute: %w", err)
+	}
+
+	switch {
+	case deleted:
+		return nil
+	case exists:
+		return domain.ErrAttributeInUse
+	default:
+		return domain.ErrAttributeNotFound
+	}
+}
+
+func scanAttribute(row rowScanner) (domain.AttributeDefinition, error) {
+	var definition domain.AttributeDefinition
+	var name string
+	var rules []byte
+	if err := row.Scan(&name, &rules, &definition.CreatedAt, &definition.UpdatedAt); err != nil {
+		return definition, err
+	}
+	createdAt, updatedAt := definition.CreatedAt, definition.UpdatedAt
+
+	if err := json.Unmarshal(rules, &definition); err != nil {
+		return definition, fmt.Errorf("failed to decode attribute %q: %w", name, err)
+	}
+	definition.Name, definition.CreatedAt, definition.UpdatedAt = name, createdAt, updatedAt
+
+	return definition, nil
+}
+
+// InitSchema creates the attributes table if it doesn't exist
+func (r *Attributes) InitSchema() error {
+	queries := []string{`
+		CREATE TABLE IF NOT EXISTS user_attributes (
+			name VARCHAR(63) PRIMARY KEY,
+			definition JSONB NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		)`,
+	}
+
+	for _, query := range queries {
+		if _, err := r.db.Primary().Exec(query); err != nil {
+			return fmt.Errorf("failed to create attribute tables: %w", err)
+		}
+	}
+
+	return nil
+}
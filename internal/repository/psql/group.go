@@ -0,0 +1,262 @@
+package psql
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/db"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+// Groups stores groups and their memberships. Memberships reference users
+// and groups with ON DELETE CASCADE, so deleting either removes them.
+type Groups struct {
+	db *db.Cluster
+}
+
+func NewGroups(db *db.Cluster) *Groups {
+	return &Groups{db: db}
+}
+
+func (r *Groups) Create(ctx context.Context, group domain.Group) (domain.Group, error) {
+	query := `
+		INSERT INTO groups (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at`
+
+	err := r.db.Primary().QueryRowContext(ctx, query, group.Name, group.Description).
+		Scan(&group.ID, &group.CreatedAt, &group.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "idx_groups_name_unique") {
+			return domain.Group{}, fmt.Errorf("%w: name is already in use", domain.ErrGroupConflict)
+		}
+		return domain.Group{}, fmt.Errorf("failed to create group: %w", err)
+	}
+
+	return group, nil
+}
+
+func (r *Groups) GetByID(ctx context.Context, id int64) (domain.Group, error) {
+	query := `SELECT id, name, description, created_at, updated_at FROM groups WHERE id = $1`
+
+	group, err := scanGroup(r.db.Reader(ctx).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return group, domain.ErrGroupNotFound
+		}
+		return group, fmt.Errorf("failed to get group by id: %w", err)
+	}
+
+	return group, nil
+}
+
+func (r *Groups) List(ctx context.Context) ([]domain.Group, error) {
+	query := `SELECT id, name, description, created_at, updated_at FROM groups ORDER BY id`
+
+	rows, err := r.db.Reader(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer rows.Close()
+
+	return scanGroups(rows)
+}
+
+func (r *Groups) Update(ctx context.Context, id int64, group domain.Group) (domain.Group, error) {
+	query := `
+		UPDATE groups
+		SET name = $1, description = $2, updated_at = now()
+		WHERE id = $3
+		RETURNING id, created_at, updated_at`
+
+	err := r.db.Primary().QueryRowContext(ctx, query, group.Name, group.Description, id).
+		Scan(&group.ID, &group.CreatedAt, &group.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Group{}, domain.ErrGroupNotFound
+		}
+		if isUniqueViolation(err, "idx_groups_name_unique") {
+			return domain.Group{}, fmt.Errorf("%w: name is already in use", domain.ErrGroupConflict)
+		}
+		return domain.Group{}, fmt.Errorf("failed to update group: %w", err)
+	}
+
+	return group, nil
+}
+
+func (r *Groups) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.Primary().ExecContext(ctx, `DELETE FROM groups WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrGroupNotFound
+	}
+
+	return nil
+}
+
+// AddMember relies on the foreign keys to report a missing group or user
+func (r *Groups) AddMember(ctx context.Context, groupID, userID int64) error {
+	query := `INSERT INTO group_memberships (group_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	if _, err := r.db.Primary().ExecContext(ctx, query, groupID, userID); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			switch pqErr.Constraint {
+			case "fk_group_memberships_group":
+				return domain.ErrGroupNotFound
+			case "fk_group_memberships_user":
+				return domain.ErrUserNotFound
+			}
+		}
+		return fmt.Errorf("failed to add group member: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Groups) RemoveMember(ctx context.Context, groupID, userID int64) error {
+	query := `DELETE FROM group_memberships WHERE group_id = $1 AND user_id = $2`
+
+	result, err := r.db.Primary().ExecContext(ctx, query, groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove group member: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrMembershipNotFound
+	}
+
+	return nil
+}
+
+func (r *Groups) Members(ctx context.Context, groupID int64) ([]domain.User, error) {
+	reader := r.db.Reader(ctx)
+	if err := checkExists(ctx, reader, `SELECT EXISTS (SELECT 1 FROM groups WHERE id = $1)`, groupID, domain.ErrGroupNotFound); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT u.id, u.name, u.age, u.sex, COALESCE(u.email, ''), COALESCE(u.phone, ''), u.attributes, u.created_at, u.updated_at
+		FROM group_memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = $1
+		ORDER BY u.id`
+
+	rows, err := reader.QueryContext(ctx, query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group members: %w", err)
+	}
+	defer rows.Close()
+
+	return scanUsers(rows)
+}
+
+func (r *Groups) UserGroups(ctx context.Context, userID int64) ([]domain.Group, error) {
+	reader := r.db.Reader(ctx)
+	if err := checkExists(ctx, reader, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userID, domain.ErrUserNotFound); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT g.id, g.name, g.description, g.created_at, g.updated_at
+		FROM group_memberships m
+		JOIN groups g ON g.id = m.group_id
+		WHERE m.user_id = $1
+		ORDER BY g.id`
+
+	rows, err := reader.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user groups: %w", err)
+	}
+	defer rows.Close()
+
+	return scanGroups(rows)
+}
+
+// checkExists returns notFound when the EXISTS query is false for id
+func checkExists(ctx context.Context, reader *sql.DB, query string, id int64, notFound error) error {
+	var exists bool
+	if err := reader.QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check existence: %w", err)
+	}
+	if !exists {
+		return notFound
+	}
+	return nil
+}
+
+func scanGroup(row rowScanner) (domain.Group, error) {
+	var group domain.Group
+	err := row.Scan(&group.ID, &group.Name, &group.Description, &group.CreatedAt, &group.UpdatedAt)
+	return group, err
+}
+
+func scanGroups(rows *sql.Rows) ([]domain.Group, error) {
+	var groups []domain.Group
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return groups, nil
+}
+
+// isUniqueViolation reports whether err violates the unique index
+func isUniqueViolation(err error, index string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == index
+}
+
+// InitSchema creates the group tables if they don't exist. The users table
+// must exist first.
+func (r *Groups) InitSchema() error {
+	queries := []string{`
+		CREATE TABLE IF NOT EXISTS groups (
+			id BIGSERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			description VARCHAR(1000) NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_groups_name_unique ON groups(lower(name))`, `
+		CREATE TABLE IF NOT EXISTS group_memberships (
+			group_id BIGINT NOT NULL,
+			user_id BIGINT NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			PRIMARY KEY (group_id, user_id),
+			CONSTRAINT fk_group_memberships_group FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+			CONSTRAINT fk_group_memberships_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_group_memberships_user ON group_memberships(user_id, group_id)`,
+	}
+
+	for _, query := range queries {
+		if _, err := r.db.Primary().Exec(query); err != nil {
+			return fmt.Errorf("failed to create group tables: %w", err)
+		}
+	}
+
+	return nil
+}
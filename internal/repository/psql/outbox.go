@@ -0,0 +1,145 @@
+package psql
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/db"
+	"crud-without-db/pkg/logger"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// Outbox reads the user events written by Users in the transaction of each
+// change, so an event is never lost once the change is committed
+type Outbox struct {
+	db     *db.Cluster
+	logger zerolog.Logger
+}
+
+func NewOutbox(db *db.Cluster) *Outbox {
+	return &Outbox{db: db, logger: logger.GetLogger("outbox")}
+}
+
+// Deliver locks up to limit undelivered messages and passes them to publish
+// in ID order, stopping at the first error. Published messages are marked
+// delivered when the transaction commits. Rows locked by another relay are
+// skipped, so several instances can run side by side.
+func (r *Outbox) Deliver(ctx context.Context, limit int, publish func(ctx context.Context, msg domain.OutboxMessage) error) (int, error) {
+	tx, err := r.db.Primary().BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin outbox transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, payload FROM outbox
+		WHERE delivered_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read outbox: %w", err)
+	}
+
+	var messages []domain.OutboxMessage
+	var malformed []int64
+	for rows.Next() {
+		var msg domain.OutboxMessage
+		var payload []byte
+		if err := rows.Scan(&msg.ID, &payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		if err := json.Unmarshal(payload, &msg.UserEvent); err != nil {
+			// It can never be published, holding it back would block the outbox
+			r.logger.Error().Err(err).Int64("id", msg.ID).Msg("Skipping malformed outbox message")
+			malformed = append(malformed, msg.ID)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	delivered := malformed
+	var publishErr error
+	for _, msg := range messages {
+		if publishErr = publish(ctx, msg); publishErr != nil {
+			break
+		}
+		delivered = append(delivered, msg.ID)
+	}
+
+	if len(delivered) > 0 {
+		_, err := tx.ExecContext(ctx, `UPDATE outbox SET delivered_at = now() WHERE id = ANY($1)`, pq.Array(delivered))
+		if err != nil {
+			return 0, fmt.Errorf("failed to mark outbox messages delivered: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to commit outbox transaction: %w", err)
+		}
+	}
+
+	return len(delivered) - len(malformed), publishErr
+}
+
+// Prune deletes messages delivered before the given time
+func (r *Outbox) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.Primary().ExecContext(ctx, `DELETE FROM outbox WHERE delivered_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// InitSchema creates the outbox table if it doesn't exist
+func (r *Outbox) InitSchema() error {
+	queries := []string{`
+		CREATE TABLE IF NOT EXISTS outbox (
+			id BIGSERIAL PRIMARY KEY,
+			aggregate_type VARCHAR(32) NOT NULL,
+			aggregate_id BIGINT NOT NULL,
+			event_type VARCHAR(32) NOT NULL,
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			delivered_at TIMESTAMP WITH TIME ZONE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE delivered_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_outbox_delivered ON outbox(delivered_at) WHERE delivered_at IS NOT NULL`,
+	}
+
+	for _, query := range queries {
+		if _, err := r.db.Primary().Exec(query); err != nil {
+			return fmt.Errorf("failed to create outbox table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeOutbox records a user event in the transaction that made the change
+func writeOutbox(ctx context.Context, tx *sql.Tx, eventType domain.EventType, user domain.User) error {
+	payload, err := json.Marshal(domain.UserEvent{Type: eventType, User: user, Time: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox event: %w", err)
+	}
+
+	query := `
+		INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload)
+		VALUES ('user', $1, $2, $3)`
+
+	if _, err := tx.ExecContext(ctx, query, user.ID, string(eventType), payload); err != nil {
+		return fmt.Errorf("failed to write outbox message: %w", err)
+	}
+
+	return nil
+}
@@ -1,39 +1,59 @@
 package psql
 
 import (
+	"context"
 	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/db"
+	"crud-without-db/pkg/search"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
 )
 
+// Users stores users in PostgreSQL, sending writes to the primary and
+// reads to a replica unless the context requires the primary. Every change
+// records its event in the outbox table within the same transaction.
 type Users struct {
-	db *sql.DB
+	db *db.Cluster
 }
 
-func NewUsers(db *sql.DB) *Users {
+func NewUsers(db *db.Cluster) *Users {
 	return &Users{db: db}
 }
 
-func (r *Users) Create(user domain.User) error {
+func (r *Users) Create(ctx context.Context, user domain.User) (domain.User, error) {
 	query := `
-		INSERT INTO users (name, age, sex) 
-		VALUES ($1, $2, $3) 
-		RETURNING id`
+		INSERT INTO users (name, age, sex, email, phone, attributes) 
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6) 
+		RETURNING id, created_at, updated_at`
 
-	err := r.db.QueryRow(query, user.Name, user.Age, user.Sex).Scan(&user.ID)
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, user.Name, user.Age, user.Sex, user.Email, user.Phone, jsonMap(user.Attributes)).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			if conflict := conflictError(err); conflict != nil {
+				return conflict
+			}
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		return writeOutbox(ctx, tx, domain.EventUserCreated, user)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
+		return domain.User{}, err
 	}
 
-	return nil
+	return user, nil
 }
 
-func (r *Users) GetByID(id int64) (domain.User, error) {
+func (r *Users) GetByID(ctx context.Context, id int64) (domain.User, error) {
 	var user domain.User
-	query := `SELECT id, name, age, sex FROM users WHERE id = $1`
+	query := `SELECT id, name, age, sex, COALESCE(email, ''), COALESCE(phone, ''), attributes, created_at, updated_at FROM users WHERE id = $1`
 
-	err := r.db.QueryRow(query, id).Scan(&user.ID, &user.Name, &user.Age, &user.Sex)
+	err := r.db.Reader(ctx).QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Name, &user.Age, &user.Sex, &user.Email, &user.Phone, (*jsonMap)(&user.Attributes), &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return user, domain.ErrUserNotFound
@@ -44,90 +64,496 @@ func (r *Users) GetByID(id int64) (domain.User, error) {
 	return user, nil
 }
 
-func (r *Users) GetAll() ([]domain.User, error) {
-	query := `SELECT id, name, age, sex FROM users ORDER BY id`
+// GetByEmail finds a user by normalized email address
+func (r *Users) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	var user domain.User
+	query := `SELECT id, name, age, sex, COALESCE(email, ''), COALESCE(phone, ''), attributes, created_at, updated_at FROM users WHERE lower(email) = $1`
 
-	rows, err := r.db.Query(query)
+	err := r.db.Reader(ctx).QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Name, &user.Age, &user.Sex, &user.Email, &user.Phone, (*jsonMap)(&user.Attributes), &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return user, domain.ErrUserNotFound
+		}
+		return user, fmt.Errorf("failed to get user by email: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetByIDs returns the existing users among ids, missing IDs are skipped
+func (r *Users) GetByIDs(ctx context.Context, ids []int64) ([]domain.User, error) {
+	query := `SELECT id, name, age, sex, COALESCE(email, ''), COALESCE(phone, ''), attributes, created_at, updated_at FROM users WHERE id = ANY($1) ORDER BY id`
+
+	rows, err := r.db.Reader(ctx).QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users by ids: %w", err)
+	}
+	defer rows.Close()
+
+	return scanUsers(rows)
+}
+
+func (r *Users) GetAll(ctx context.Context) ([]domain.User, error) {
+	query := `SELECT id, name, age, sex, COALESCE(email, ''), COALESCE(phone, ''), attributes, created_at, updated_at FROM users ORDER BY id`
+
+	rows, err := r.db.Reader(ctx).QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all users: %w", err)
 	}
 	defer rows.Close()
 
-	var users []domain.User
+	return scanUsers(rows)
+}
+
+func (r *Users) List(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Name != "" {
+		conditions = append(conditions, "strpos(lower(name), lower("+arg(filter.Name)+")) > 0")
+	}
+	if filter.Sex != "" {
+		conditions = append(conditions, "sex = "+arg(filter.Sex))
+	}
+	if filter.MinAge > 0 {
+		conditions = append(conditions, "age >= "+arg(filter.MinAge))
+	}
+	if filter.MaxAge > 0 {
+		conditions = append(conditions, "age <= "+arg(filter.MaxAge))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at > "+arg(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(filter.CreatedBefore))
+	}
+	if !filter.UpdatedSince.IsZero() {
+		conditions = append(conditions, "updated_at >= "+arg(filter.UpdatedSince))
+	}
+	if len(filter.Attributes) > 0 {
+		// Containment is served by the GIN index on attributes
+		conditions = append(conditions, "attributes @> "+arg(jsonMap(filter.Attributes))+"::jsonb")
+	}
+
+	query := `SELECT id, name, age, sex, COALESCE(email, ''), COALESCE(phone, ''), attributes, created_at, updated_at FROM users`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query += " OFFSET " + arg(filter.Offset)
+	}
+
+	rows, err := r.db.Reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	return scanUsers(rows)
+}
+
+// Search matches names by word prefixes (tsvector) or, for misspellings,
+// by trigram word similarity (pg_trgm), best matches first
+func (r *Users) Search(ctx context.Context, s domain.UserSearch) ([]domain.UserSearchResult, error) {
+	terms := search.Terms(s.Query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	// Terms only hold letters and digits, so they are safe in a tsquery
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+
+	query := `
+		SELECT id, name, age, sex, COALESCE(email, ''), COALESCE(phone, ''), attributes, created_at, updated_at,
+			search_vector @@ to_tsquery('simple', $1) AS prefix_match,
+			word_similarity($2, name) AS similarity
+		FROM users
+		WHERE search_vector @@ to_tsquery('simple', $1) OR $2 <% name
+		ORDER BY prefix_match DESC, similarity DESC, id`
+	args := []interface{}{strings.Join(prefixes, " & "), strings.Join(terms, " ")}
+	if s.Limit > 0 {
+		args = append(args, s.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if s.Offset > 0 {
+		args = append(args, s.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	// The <% threshold is a setting, scoped to a transaction
+	tx, err := r.db.Reader(ctx).BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin search transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	threshold := strconv.FormatFloat(search.SimilarityThreshold, 'f', -1, 64)
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`, threshold); err != nil {
+		return nil, fmt.Errorf("failed to set similarity threshold: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	var results []domain.UserSearchResult
 	for rows.Next() {
-		var user domain.User
-		err := rows.Scan(&user.ID, &user.Name, &user.Age, &user.Sex)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan user: %w", err)
+		var result domain.UserSearchResult
+		var prefixMatch bool
+		var similarity float64
+		user := &result.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Age, &user.Sex, &user.Email, &user.Phone, (*jsonMap)(&user.Attributes), &user.CreatedAt, &user.UpdatedAt, &prefixMatch, &similarity); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
 		}
-		users = append(users, user)
+		result.Rank = search.Rank(prefixMatch, similarity)
+		results = append(results, result)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	return users, nil
+	return results, nil
 }
 
-func (r *Users) Update(id int64, user domain.User) error {
+func (r *Users) Update(ctx context.Context, id int64, user domain.User) (domain.User, error) {
+	// updated_at is also set by a trigger in databases migrated with
+	// migrations/001, setting it here covers tables made by InitSchema
 	query := `
 		UPDATE users 
-		SET name = $1, age = $2, sex = $3 
-		WHERE id = $4`
+		SET name = $1, age = $2, sex = $3, email = NULLIF($4, ''), phone = NULLIF($5, ''), attributes = $6, updated_at = CURRENT_TIMESTAMP 
+		WHERE id = $7
+		RETURNING id, created_at, updated_at`
+
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, user.Name, user.Age, user.Sex, user.Email, user.Phone, jsonMap(user.Attributes), id).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return domain.ErrUserNotFound
+			}
+			if conflict := conflictError(err); conflict != nil {
+				return conflict
+			}
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		return writeOutbox(ctx, tx, domain.EventUserUpdated, user)
+	})
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r *Users) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM users WHERE id = $1`
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
 
-	result, err := r.db.Exec(query, user.Name, user.Age, user.Sex, id)
+		if rowsAffected == 0 {
+			return domain.ErrUserNotFound
+		}
+
+		return writeOutbox(ctx, tx, domain.EventUserDeleted, domain.User{ID: id})
+	})
+}
+
+// Changes returns the users created, updated and deleted after since,
+// ordered by the transaction that last changed them. Only transactions
+// older than the oldest one still running are included: any transaction
+// committing later has a higher ID, so the next cursor never skips it.
+func (r *Users) Changes(ctx context.Context, since domain.ChangeCursor, limit int) (domain.UserChanges, error) {
+	// One snapshot for the horizon and the changes. Replicas may lag behind
+	// the horizon of tokens handed out by the primary, so always read there.
+	tx, err := r.db.Primary().BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
 	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+		return domain.UserChanges{}, fmt.Errorf("failed to begin changes transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	var rawHorizon string
+	if err := tx.QueryRowContext(ctx, `SELECT pg_snapshot_xmin(pg_current_snapshot())::text`).Scan(&rawHorizon); err != nil {
+		return domain.UserChanges{}, fmt.Errorf("failed to get change horizon: %w", err)
+	}
+	horizon, err := strconv.ParseUint(rawHorizon, 10, 64)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return domain.UserChanges{}, fmt.Errorf("failed to parse change horizon: %w", err)
 	}
+	// Tombstones are kept forever, so tokens never expire. A token past the
+	// horizon, whose transactions are still in progress here, gets an empty
+	// page keeping it as the next token.
 
-	if rowsAffected == 0 {
-		return domain.ErrUserNotFound
+	// Clients syncing from scratch don't need tombstones
+	query := `
+		SELECT id, name, age, sex, COALESCE(email, ''), COALESCE(phone, ''), attributes, created_at, updated_at,
+			changed_xid AS xid, (created_xid, id) > ($1::xid8, $2) AS created, false AS deleted
+		FROM users
+		WHERE (changed_xid, id) > ($1::xid8, $2) AND changed_xid < $3::xid8
+		UNION ALL
+		SELECT id, '', 0, '', '', '', '{}'::jsonb, deleted_at, deleted_at,
+			deleted_xid, false, true
+		FROM users_tombstones
+		WHERE $4 AND (deleted_xid, id) > ($1::xid8, $2) AND deleted_xid < $3::xid8
+		ORDER BY xid, id
+		LIMIT $5`
+
+	rows, err := tx.QueryContext(ctx, query,
+		strconv.FormatUint(since.Seq, 10), since.ID, rawHorizon, since != domain.ChangeCursor{}, limit+1)
+	if err != nil {
+		return domain.UserChanges{}, fmt.Errorf("failed to get user changes: %w", err)
 	}
+	defer rows.Close()
 
-	return nil
+	changes := domain.UserChanges{Changes: []domain.UserChange{}}
+	var last domain.ChangeCursor
+	for rows.Next() {
+		var user domain.User
+		var rawSeq string
+		var created, deleted bool
+		if err := rows.Scan(&user.ID, &user.Name, &user.Age, &user.Sex, &user.Email, &user.Phone, (*jsonMap)(&user.Attributes), &user.CreatedAt, &user.UpdatedAt,
+			&rawSeq, &created, &deleted); err != nil {
+			return domain.UserChanges{}, fmt.Errorf("failed to scan user change: %w", err)
+		}
+
+		if len(changes.Changes) == limit {
+			changes.HasMore = true
+			break
+		}
+
+		seq, err := strconv.ParseUint(rawSeq, 10, 64)
+		if err != nil {
+			return domain.UserChanges{}, fmt.Errorf("failed to parse change sequence: %w", err)
+		}
+		last = domain.ChangeCursor{Seq: seq, ID: user.ID}
+		changes.Changes = append(changes.Changes, changeOf(user, created, deleted))
+	}
+
+	if err := rows.Err(); err != nil {
+		return domain.UserChanges{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	// Without more changes the next sync starts at the horizon
+	if !changes.HasMore {
+		last = domain.ChangeCursor{Seq: horizon}
+		if since.After(last) {
+			last = since
+		}
+	}
+	changes.NextToken = last.Token()
+
+	return changes, nil
 }
 
-func (r *Users) Delete(id int64) error {
-	query := `DELETE FROM users WHERE id = $1`
+// changeOf makes the change of a user row or, when deleted, a tombstone
+// carrying the deletion time in UpdatedAt
+func changeOf(user domain.User, created, deleted bool) domain.UserChange {
+	switch {
+	case deleted:
+		return domain.UserChange{Type: domain.EventUserDeleted, ID: user.ID, Time: user.UpdatedAt}
+	case created:
+		return domain.UserChange{Type: domain.EventUserCreated, ID: user.ID, User: &user, Time: user.UpdatedAt}
+	default:
+		return domain.UserChange{Type: domain.EventUserUpdated, ID: user.ID, User: &user, Time: user.UpdatedAt}
+	}
+}
 
-	result, err := r.db.Exec(query, id)
+// inTx runs fn in a transaction on the primary, committing if it succeeds
+func (r *Users) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Primary().BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return nil
+}
+
+// conflictError maps a unique violation of the email or phone index to
+// domain.ErrUserConflict, other errors to nil
+func conflictError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return nil
+	}
+	switch pqErr.Constraint {
+	case "idx_users_email_unique":
+		return fmt.Errorf("%w: email is already in use", domain.ErrUserConflict)
+	case "idx_users_phone_unique":
+		return fmt.Errorf("%w: phone is already in use", domain.ErrUserConflict)
+	}
+	return nil
+}
+
+// jsonMap stores user attributes in a JSONB column, nil as an empty object
+type jsonMap map[string]interface{}
+
+func (m jsonMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(m)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return nil, fmt.Errorf("failed to encode attributes: %w", err)
 	}
+	return string(b), nil
+}
 
-	if rowsAffected == 0 {
-		return domain.ErrUserNotFound
+// Scan leaves the map nil for an empty object
+func (m *jsonMap) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+		*m = nil
+		return nil
+	default:
+		return fmt.Errorf("unsupported attributes type %T", src)
 	}
 
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return fmt.Errorf("failed to decode attributes: %w", err)
+	}
+	if len(decoded) == 0 {
+		decoded = nil
+	}
+	*m = decoded
 	return nil
 }
 
-// InitSchema creates the users table if it doesn't exist
+func scanUsers(rows *sql.Rows) ([]domain.User, error) {
+	var users []domain.User
+	for rows.Next() {
+		var user domain.User
+		err := rows.Scan(&user.ID, &user.Name, &user.Age, &user.Sex, &user.Email, &user.Phone, (*jsonMap)(&user.Attributes), &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// InitSchema creates the users table if it doesn't exist, with the trigger
+// notifying the users_changes channel (PostgreSQL 14+), the search indexes,
+// the unique email and phone indexes, change tracking for sync and the
+// custom attributes
 func (r *Users) InitSchema() error {
-	query := `
+	queries := []string{`
 		CREATE TABLE IF NOT EXISTS users (
 			id SERIAL PRIMARY KEY,
 			name VARCHAR(255) NOT NULL,
 			age INTEGER NOT NULL,
 			sex VARCHAR(10) NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_updated_at ON users (updated_at)`, `
+		CREATE OR REPLACE FUNCTION notify_users_changes()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			IF TG_OP = 'TRUNCATE' THEN
+				PERFORM pg_notify('users_changes', json_build_object('op', TG_OP, 'time', now())::text);
+			ELSIF TG_OP = 'DELETE' THEN
+				PERFORM pg_notify('users_changes', json_build_object('op', TG_OP, 'id', OLD.id, 'time', now())::text);
+			ELSE
+				PERFORM pg_notify('users_changes', json_build_object('op', TG_OP, 'id', NEW.id, 'time', now())::text);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ language 'plpgsql'`, `
+		CREATE OR REPLACE TRIGGER notify_users_changes
+			AFTER INSERT OR UPDATE OR DELETE ON users
+			FOR EACH ROW
+			EXECUTE FUNCTION notify_users_changes()`, `
+		CREATE OR REPLACE TRIGGER notify_users_truncate
+			AFTER TRUNCATE ON users
+			FOR EACH STATEMENT
+			EXECUTE FUNCTION notify_users_changes()`,
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`, `
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (to_tsvector('simple', name)) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN (search_vector)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING GIN (name gin_trgm_ops)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS email VARCHAR(254)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS phone VARCHAR(16)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_unique ON users (lower(email))`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone_unique ON users (phone)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS created_xid xid8 NOT NULL DEFAULT '0'`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS changed_xid xid8 NOT NULL DEFAULT '0'`,
+		`CREATE INDEX IF NOT EXISTS idx_users_changed_xid ON users (changed_xid, id)`, `
+		CREATE TABLE IF NOT EXISTS users_tombstones (
+			id BIGINT PRIMARY KEY,
+			deleted_xid xid8 NOT NULL,
+			deleted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_tombstones_deleted_xid ON users_tombstones (deleted_xid, id)`, `
+		CREATE OR REPLACE FUNCTION track_users_changes()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				INSERT INTO users_tombstones (id, deleted_xid) VALUES (OLD.id, pg_current_xact_id())
+				ON CONFLICT (id) DO UPDATE SET deleted_xid = EXCLUDED.deleted_xid, deleted_at = EXCLUDED.deleted_at;
+				RETURN OLD;
+			END IF;
+			IF TG_OP = 'INSERT' THEN
+				NEW.created_xid = pg_current_xact_id();
+			END IF;
+			NEW.changed_xid = pg_current_xact_id();
+			RETURN NEW;
+		END;
+		$$ language 'plpgsql'`, `
+		CREATE OR REPLACE TRIGGER track_users_changes
+			BEFORE INSERT OR UPDATE OR DELETE ON users
+			FOR EACH ROW
+			EXECUTE FUNCTION track_users_changes()`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}'`,
+		`CREATE INDEX IF NOT EXISTS idx_users_attributes ON users USING GIN (attributes)`,
+	}
 
-	_, err := r.db.Exec(query)
-	if err != nil {
-		return fmt.Errorf("failed to create users table: %w", err)
+	for _, query := range queries {
+		if _, err := r.db.Primary().Exec(query); err != nil {
+			return fmt.Errorf("failed to create users table: %w", err)
+		}
 	}
 
 	return nil
@@ -0,0 +1,316 @@
+package psql
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/db"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Webhooks stores webhook subscriptions and the delivery queue. Deliveries
+// are claimed with SELECT ... FOR UPDATE SKIP LOCKED, so any number of
+// instances can dispatch them without sending one twice.
+type Webhooks struct {
+	db *db.Cluster
+}
+
+func NewWebhooks(db *db.Cluster) *Webhooks {
+	return &Webhooks{db: db}
+}
+
+func (r *Webhooks) CreateSubscription(ctx context.Context, sub domain.WebhookSubscription) (domain.WebhookSubscription, error) {
+	query := `
+		INSERT INTO webhook_subscriptions (url, event_types, secret, disabled)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	err := r.db.Primary().QueryRowContext(ctx, query, sub.URL, pq.Array(eventTypeStrings(sub.EventTypes)), sub.Secret, sub.Disabled).
+		Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		return sub, fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+func (r *Webhooks) GetSubscription(ctx context.Context, id int64) (domain.WebhookSubscription, error) {
+	query := `SELECT id, url, event_types, disabled, created_at FROM webhook_subscriptions WHERE id = $1`
+
+	sub, err := scanSubscription(r.db.Reader(ctx).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return sub, domain.ErrWebhookNotFound
+		}
+		return sub, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+func (r *Webhooks) ListSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	query := `SELECT id, url, event_types, disabled, created_at FROM webhook_subscriptions ORDER BY id`
+
+	rows, err := r.db.Reader(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []domain.WebhookSubscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return subs, nil
+}
+
+// UpdateSubscription replaces a subscription, an empty secret keeps the current one
+func (r *Webhooks) UpdateSubscription(ctx context.Context, id int64, sub domain.WebhookSubscription) (domain.WebhookSubscription, error) {
+	query := `
+		UPDATE webhook_subscriptions
+		SET url = $1, event_types = $2, secret = COALESCE(NULLIF($3, ''), secret), disabled = $4
+		WHERE id = $5
+		RETURNING id, url, event_types, disabled, created_at`
+
+	updated, err := scanSubscription(r.db.Primary().QueryRowContext(ctx, query,
+		sub.URL, pq.Array(eventTypeStrings(sub.EventTypes)), sub.Secret, sub.Disabled, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return updated, domain.ErrWebhookNotFound
+		}
+		return updated, fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+
+	return updated, nil
+}
+
+func (r *Webhooks) DeleteSubscription(ctx context.Context, id int64) error {
+	result, err := r.db.Primary().ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// EnqueueDeliveries queues the payload for every enabled subscription of the event type
+func (r *Webhooks) EnqueueDeliveries(ctx context.Context, eventType domain.EventType, payload []byte) (int64, error) {
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_type, payload)
+		SELECT id, $1, $2 FROM webhook_subscriptions
+		WHERE NOT disabled AND $1 = ANY(event_types)`
+
+	result, err := r.db.Primary().ExecContext(ctx, query, string(eventType), string(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// ClaimDeliveries takes up to limit due deliveries and hides them from other
+// dispatchers for the lease. Deliveries of a crashed dispatcher become due
+// again when their lease expires.
+func (r *Webhooks) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookTask, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = now() + $2 * INTERVAL '1 second'
+		FROM webhook_subscriptions s
+		WHERE s.id = d.subscription_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.subscription_id, d.event_type, d.payload, d.attempts, d.created_at, s.url, s.secret`
+
+	rows, err := r.db.Primary().QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []domain.WebhookTask
+	for rows.Next() {
+		var task domain.WebhookTask
+		d := &task.Delivery
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventType, &d.Payload, &d.Attempts, &d.CreatedAt, &task.URL, &task.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.Status = domain.DeliveryPending
+		tasks = append(tasks, task)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// RecordAttempt stores the outcome of a delivery attempt. nextAttempt is
+// ignored unless the delivery stays pending.
+func (r *Webhooks) RecordAttempt(ctx context.Context, id int64, status domain.DeliveryStatus, responseStatus int, attemptErr string, nextAttempt time.Time) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1,
+			status = $2,
+			response_status = NULLIF($3, 0),
+			last_error = NULLIF($4, ''),
+			next_attempt_at = CASE WHEN $2 = 'pending' THEN $5::timestamptz END,
+			delivered_at = CASE WHEN $2 = 'delivered' THEN now() END
+		WHERE id = $1`
+
+	_, err := r.db.Primary().ExecContext(ctx, query, id, string(status), responseStatus, attemptErr, nextAttempt)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery attempt: %w", err)
+	}
+
+	return nil
+}
+
+// ListDeliveries returns the newest deliveries of a subscription, optionally by status
+func (r *Webhooks) ListDeliveries(ctx context.Context, subscriptionID int64, status domain.DeliveryStatus, limit int) ([]domain.WebhookDelivery, error) {
+	query := `
+		SELECT id, subscription_id, event_type, payload, status, attempts,
+			COALESCE(response_status, 0), COALESCE(last_error, ''), next_attempt_at, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3`
+
+	rows, err := r.db.Reader(ctx).QueryContext(ctx, query, subscriptionID, string(status), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []domain.WebhookDelivery
+	for rows.Next() {
+		var d domain.WebhookDelivery
+		var nextAttempt, delivered sql.NullTime
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.ResponseStatus, &d.LastError, &nextAttempt, &d.CreatedAt, &delivered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		if nextAttempt.Valid {
+			d.NextAttemptAt = &nextAttempt.Time
+		}
+		if delivered.Valid {
+			d.DeliveredAt = &delivered.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// RetryDelivery puts a delivery back in the queue with a fresh attempt budget
+func (r *Webhooks) RetryDelivery(ctx context.Context, subscriptionID, deliveryID int64) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = now(), delivered_at = NULL
+		WHERE id = $1 AND subscription_id = $2`
+
+	result, err := r.db.Primary().ExecContext(ctx, query, deliveryID, subscriptionID)
+	if err != nil {
+		return fmt.Errorf("failed to retry webhook delivery: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// InitSchema creates the webhook tables if they don't exist
+func (r *Webhooks) InitSchema() error {
+	queries := []string{`
+		CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+			id BIGSERIAL PRIMARY KEY,
+			url VARCHAR(2048) NOT NULL,
+			event_types TEXT[] NOT NULL,
+			secret VARCHAR(255) NOT NULL,
+			disabled BOOLEAN NOT NULL DEFAULT false,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		)`, `
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			subscription_id BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+			event_type VARCHAR(32) NOT NULL,
+			payload TEXT NOT NULL,
+			status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_status INTEGER,
+			last_error TEXT,
+			next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			delivered_at TIMESTAMP WITH TIME ZONE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending'`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription ON webhook_deliveries(subscription_id, id DESC)`,
+	}
+
+	for _, query := range queries {
+		if _, err := r.db.Primary().Exec(query); err != nil {
+			return fmt.Errorf("failed to create webhook tables: %w", err)
+		}
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSubscription(row rowScanner) (domain.WebhookSubscription, error) {
+	var sub domain.WebhookSubscription
+	var eventTypes []string
+	err := row.Scan(&sub.ID, &sub.URL, pq.Array(&eventTypes), &sub.Disabled, &sub.CreatedAt)
+	for _, eventType := range eventTypes {
+		sub.EventTypes = append(sub.EventTypes, domain.EventType(eventType))
+	}
+	return sub, err
+}
+
+func eventTypeStrings(types []domain.EventType) []string {
+	result := make([]string, 0, len(types))
+	for _, t := range types {
+		result = append(result, string(t))
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+)
+
+// AddressesRepository stores the addresses of users. It keeps exactly one
+// default address per user with addresses: the first address becomes the
+// default, a new default unsets the previous one and deleting the default
+// makes the oldest remaining address the default.
+type AddressesRepository interface {
+	// List fails with domain.ErrUserNotFound for unknown users
+	List(ctx context.Context, userID int64) ([]domain.Address, error)
+	Get(ctx context.Context, userID, id int64) (domain.Address, error)
+	Create(ctx context.Context, address domain.Address) (domain.Address, error)
+	Update(ctx context.Context, userID, id int64, address domain.Address) (domain.Address, error)
+	Delete(ctx context.Context, userID, id int64) error
+}
+
+// Addresses manages the postal addresses of users
+type Addresses struct {
+	repo AddressesRepository
+}
+
+func NewAddresses(repo AddressesRepository) *Addresses {
+	return &Addresses{repo: repo}
+}
+
+// List returns the addresses of a user ordered by ID
+func (a *Addresses) List(ctx context.Context, userID int64) ([]domain.Address, error) {
+	return a.repo.List(ctx, userID)
+}
+
+func (a *Addresses) Get(ctx context.Context, userID, id int64) (domain.Address, error) {
+	return a.repo.Get(ctx, userID, id)
+}
+
+func (a *Addresses) Create(ctx context.Context, userID int64, address domain.Address) (domain.Address, error) {
+	address.Normalize()
+	if err := address.Validate(); err != nil {
+		return domain.Address{}, err
+	}
+	address.UserID = userID
+	return a.repo.Create(ctx, address)
+}
+
+// Update replaces an address. The default address stays the default until
+// another address is made the default.
+func (a *Addresses) Update(ctx context.Context, userID, id int64, address domain.Address) (domain.Address, error) {
+	address.Normalize()
+	if err := address.Validate(); err != nil {
+		return domain.Address{}, err
+	}
+	address.UserID = userID
+	return a.repo.Update(ctx, userID, id, address)
+}
+
+func (a *Addresses) Delete(ctx context.Context, userID, id int64) error {
+	return a.repo.Delete(ctx, userID, id)
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+)
+
+type AttributesRepository interface {
+	List(ctx context.Context) ([]domain.AttributeDefinition, error)
+	Get(ctx context.Context, name string) (domain.AttributeDefinition, error)
+	// Put creates or replaces a definition, reporting whether it was created
+	Put(ctx context.Context, definition domain.AttributeDefinition) (domain.AttributeDefinition, bool, error)
+	// Delete fails with domain.ErrAttributeInUse while users have a value
+	Delete(ctx context.Context, name string) error
+}
+
+// Attributes is the registry of custom user attributes
+type Attributes struct {
+	repo AttributesRepository
+}
+
+func NewAttributes(repo AttributesRepository) *Attributes {
+	return &Attributes{repo: repo}
+}
+
+func (a *Attributes) List(ctx context.Context) ([]domain.AttributeDefinition, error) {
+	return a.repo.List(ctx)
+}
+
+func (a *Attributes) Get(ctx context.Context, name string) (domain.AttributeDefinition, error) {
+	return a.repo.Get(ctx, name)
+}
+
+// Put defines an attribute or replaces its definition. Values users
+// already have are checked against the new rules on their next update.
+func (a *Attributes) Put(ctx context.Context, definition domain.AttributeDefinition) (domain.AttributeDefinition, bool, error) {
+	if err := definition.Validate(); err != nil {
+		return domain.AttributeDefinition{}, false, err
+	}
+	return a.repo.Put(ctx, definition)
+}
+
+func (a *Attributes) Delete(ctx context.Context, name string) error {
+	return a.repo.Delete(ctx, name)
+}
+
+// Definitions returns the definitions by name
+func (a *Attributes) Definitions(ctx context.Context) (map[string]domain.AttributeDefinition, error) {
+	definitions, err := a.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]domain.AttributeDefinition, len(definitions))
+	for _, definition := range definitions {
+		byName[definition.Name] = definition
+	}
+	return byName, nil
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/blob"
+	"crud-without-db/pkg/events"
+	"crud-without-db/pkg/logger"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AvatarsConfig struct {
+	// MaxSize is the largest accepted upload in bytes
+	MaxSize int64
+	// MaxPixels bounds width times height, checked before decoding so that
+	// small files can't expand to huge images in memory
+	MaxPixels int
+	// ThumbnailSize is the width and height of thumbnails in pixels
+	ThumbnailSize int
+}
+
+// UserFinder looks up users, avatars belong to existing users only
+type UserFinder interface {
+	GetByID(ctx context.Context, id int64) (domain.User, error)
+}
+
+// UserEventSubscriber provides the user events avatars are cleaned up on
+type UserEventSubscriber interface {
+	Subscribe(filter events.Filter, lastEventID string) (*events.Subscription, []events.Event, bool)
+}
+
+// Avatars stores profile pictures with their thumbnails in a blob store.
+// Every upload is stored under a new version and becomes current by
+// replacing the small "current" blob naming it, so that readers always get
+// variants of the same upload.
+type Avatars struct {
+	store  blob.Store
+	users  UserFinder
+	config AvatarsConfig
+	// mu serializes switching versions, so that replaced versions are
+	// always deleted
+	mu     sync.Mutex
+	logger zerolog.Logger
+}
+
+func NewAvatars(store blob.Store, users UserFinder, config AvatarsConfig) *Avatars {
+	return &Avatars{
+		store:  store,
+		users:  users,
+		config: config,
+		logger: logger.GetLogger("avatars"),
+	}
+}
+
+// MaxSize is the largest accepted upload in bytes
+func (a *Avatars) MaxSize() int64 {
+	return a.config.MaxSize
+}
+
+// Put replaces the avatar of a user with the image read from r. The format
+// is detected from the content; the image is decoded to check it and to
+// generate the thumbnail.
+func (a *Avatars) Put(ctx context.Context, userID int64, r io.Reader) (domain.Avatar, error) {
+	if _, err := a.users.GetByID(ctx, userID); err != nil {
+		return domain.Avatar{}, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, a.config.MaxSize+1))
+	if err != nil {
+		return domain.Avatar{}, fmt.Errorf("failed to read avatar: %w", err)
+	}
+	if int64(len(data)) > a.config.MaxSize {
+		return domain.Avatar{}, domain.ErrAvatarTooLarge
+	}
+	if len(data) == 0 {
+		return domain.Avatar{}, invalidAvatar("must not be empty")
+	}
+
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(domain.AvatarFormats, contentType) {
+		return domain.Avatar{}, domain.ErrAvatarUnsupported
+	}
+
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return domain.Avatar{}, invalidAvatar("must be a valid image")
+	}
+	if imageConfig.Width < 1 || imageConfig.Height < 1 {
+		return domain.Avatar{}, invalidAvatar("must not be empty")
+	}
+	if imageConfig.Width > a.config.MaxPixels/imageConfig.Height {
+		return domain.Avatar{}, invalidAvatar("must have at most " + strconv.Itoa(a.config.MaxPixels) + " pixels")
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return domain.Avatar{}, invalidAvatar("must be a valid image")
+	}
+
+	var thumbnail bytes.Buffer
+	if err := png.Encode(&thumbnail, squareThumbnail(img, a.config.ThumbnailSize)); err != nil {
+		return domain.Avatar{}, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	version, err := newAvatarVersion()
+	if err != nil {
+		return domain.Avatar{}, err
+	}
+	if err := a.store.Put(ctx, avatarKey(userID, version, domain.AvatarThumbnail), &thumbnail); err != nil {
+		return domain.Avatar{}, err
+	}
+	if err := a.store.Put(ctx, avatarKey(userID, version, domain.AvatarOriginal), bytes.NewReader(data)); err != nil {
+		a.deleteVersion(ctx, userID, version)
+		return domain.Avatar{}, err
+	}
+	if err := a.switchVersion(ctx, userID, version); err != nil {
+		a.deleteVersion(ctx, userID, version)
+		return domain.Avatar{}, err
+	}
+
+	return domain.Avatar{
+		UserID:      userID,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       imageConfig.Width,
+		Height:      imageConfig.Height,
+		UpdatedAt:   time.Now().UTC(),
+	}, nil
+}
+
+// Open returns a variant of the avatar of a user, to be closed by the
+// caller, with its version. Versions change with every upload and are the
+// same for all variants of an upload.
+func (a *Avatars) Open(ctx context.Context, userID int64, variant domain.AvatarVariant) (*blob.Object, string, error) {
+	// Avatars of deleted users may remain until the cleanup removes them
+	if _, err := a.users.GetByID(ctx, userID); err != nil {
+		return nil, "", err
+	}
+
+	// A version replaced after reading the current one is deleted, read
+	// the new current version then
+	for retries := 0; ; retries++ {
+		version, err := a.currentVersion(ctx, userID)
+		if err != nil {
+			return nil, "", err
+		}
+		object, err := a.store.Open(ctx, avatarKey(userID, version, variant))
+		if errors.Is(err, blob.ErrNotFound) && retries < 2 {
+			continue
+		}
+		if errors.Is(err, blob.ErrNotFound) {
+			return nil, "", domain.ErrAvatarNotFound
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return object, version, nil
+	}
+}
+
+func (a *Avatars) Delete(ctx context.Context, userID int64) error {
+	if _, err := a.users.GetByID(ctx, userID); err != nil {
+		return err
+	}
+	return a.remove(ctx, userID)
+}
+
+// RunCleanup deletes the avatars of deleted users until ctx is done or the
+// event source closes. Avatars of users deleted while resubscribing remain
+// stored but are not served.
+func (a *Avatars) RunCleanup(ctx context.Context, source UserEventSubscriber) {
+	filter := events.Filter{Types: []domain.EventType{domain.EventUserDeleted}}
+	for {
+		sub, _, _ := source.Subscribe(filter, "")
+		a.cleanup(ctx, sub)
+		if ctx.Err() != nil || errors.Is(sub.Err(), events.ErrClosed) {
+			return
+		}
+		a.logger.Warn().Err(sub.Err()).Msg("Avatar cleanup subscription ended, resubscribing")
+	}
+}
+
+func (a *Avatars) cleanup(ctx context.Context, sub *events.Subscription) {
+	defer sub.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Done():
+			return
+		case event := <-sub.Events():
+			if err := a.remove(ctx, event.User.ID); err != nil && !errors.Is(err, domain.ErrAvatarNotFound) {
+				a.logger.Error().Err(err).Int64("user_id", event.User.ID).Msg("Failed to delete avatar of deleted user")
+			}
+		}
+	}
+}
+
+// switchVersion makes version the current avatar and deletes the replaced one
+func (a *Avatars) switchVersion(ctx context.Context, userID int64, version string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	previous, err := a.currentVersion(ctx, userID)
+	if err != nil && !errors.Is(err, domain.ErrAvatarNotFound) {
+		return err
+	}
+	if err := a.store.Put(ctx, currentAvatarKey(userID), strings.NewReader(version)); err != nil {
+		return err
+	}
+	if previous != "" {
+		a.deleteVersion(ctx, userID, previous)
+	}
+	return nil
+}
+
+// remove deletes the current avatar, removing the current blob first so
+// that it disappears at once
+func (a *Avatars) remove(ctx context.Context, userID int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	version, err := a.currentVersion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := a.store.Delete(ctx, currentAvatarKey(userID)); err != nil && !errors.Is(err, blob.ErrNotFound) {
+		return err
+	}
+	a.deleteVersion(ctx, userID, version)
+	return nil
+}
+
+func (a *Avatars) currentVersion(ctx context.Context, userID int64) (string, error) {
+	object, err := a.store.Open(ctx, currentAvatarKey(userID))
+	if errors.Is(err, blob.ErrNotFound) {
+		return "", domain.ErrAvatarNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	version, err := io.ReadAll(io.LimitReader(object, 64))
+	if err != nil {
+		return "", fmt.Errorf("failed to read current avatar version: %w", err)
+	}
+	return string(version), nil
+}
+
+// deleteVersion deletes the variants of a version. Failures only leave
+// unused blobs behind, so they are logged.
+func (a *Avatars) deleteVersion(ctx context.Context, userID int64, version string) {
+	for _, variant := range []domain.AvatarVariant{domain.AvatarOriginal, domain.AvatarThumbnail} {
+		if err := a.store.Delete(ctx, avatarKey(userID, version, variant)); err != nil && !errors.Is(err, blob.ErrNotFound) {
+			a.logger.Error().Err(err).Int64("user_id", userID).Str("version", version).Msg("Failed to delete avatar version")
+		}
+	}
+}
+
+func newAvatarVersion() (string, error) {
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate avatar version: %w", err)
+	}
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + hex.EncodeToString(random), nil
+}
+
+func avatarKey(userID int64, version string, variant domain.AvatarVariant) string {
+	return "avatars/" + strconv.FormatInt(userID, 10) + "/" + version + "/" + string(variant)
+}
+
+func currentAvatarKey(userID int64) string {
+	return "avatars/" + strconv.FormatInt(userID, 10) + "/current"
+}
+
+func invalidAvatar(description string) error {
+	return &domain.ValidationError{
+		Entity:     "avatar",
+		Violations: []domain.FieldViolation{{Field: "image", Description: description}},
+	}
+}
+
+// squareThumbnail cuts the largest centered square from img and scales it
+// to size by size pixels
+func squareThumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	square := image.Rect(x, y, x+side, y+side)
+
+	thumbnail := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, square, draw.Src, nil)
+	return thumbnail
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/db"
+	"crud-without-db/pkg/logger"
+	"encoding/json"
+	"errors"
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// UsersChangesChannel is the channel the users table trigger notifies
+const UsersChangesChannel = "users_changes"
+
+// changeLoadTimeout bounds loading the changed user for an event
+const changeLoadTimeout = 5 * time.Second
+
+// ChangePublisher receives the events detected from notifications
+type ChangePublisher interface {
+	EventPublisher
+	// Reset is called when changes may have been missed, e.g. after a
+	// reconnect or a TRUNCATE; everything derived from users must reload
+	Reset()
+}
+
+// changeNotification is the payload sent by the users table trigger
+type changeNotification struct {
+	Op   string    `json:"op"`
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+}
+
+// UserChanges turns users_changes notifications into user events, so
+// changes made directly in SQL or by other instances reach subscribers
+type UserChanges struct {
+	repo       UsersRepository
+	publishers []ChangePublisher
+	logger     zerolog.Logger
+}
+
+// NewUserChanges creates the notification handler. Events go to the
+// publishers in order, so caches should come before subscribers.
+func NewUserChanges(repo UsersRepository, publishers ...ChangePublisher) *UserChanges {
+	return &UserChanges{
+		repo:       repo,
+		publishers: publishers,
+		logger:     logger.GetLogger("changes"),
+	}
+}
+
+// Notify handles a notification payload
+func (c *UserChanges) Notify(payload string) {
+	var n changeNotification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		c.logger.Error().Err(err).Str("payload", payload).Msg("Invalid change notification")
+		return
+	}
+
+	var eventType domain.EventType
+	switch n.Op {
+	case "INSERT":
+		eventType = domain.EventUserCreated
+	case "UPDATE":
+		eventType = domain.EventUserUpdated
+	case "DELETE":
+		c.publish(domain.EventUserDeleted, domain.User{ID: n.ID}, n.Time)
+		return
+	case "TRUNCATE":
+		c.logger.Info().Msg("Users table truncated")
+		c.reset()
+		return
+	default:
+		c.logger.Warn().Str("op", n.Op).Msg("Unknown change notification")
+		return
+	}
+
+	// The primary has the committed row, replicas may lag behind
+	ctx, cancel := context.WithTimeout(db.WithPrimary(context.Background()), changeLoadTimeout)
+	defer cancel()
+
+	user, err := c.repo.GetByID(ctx, n.ID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			// Deleted since, its delete notification follows
+			return
+		}
+		c.logger.Error().Err(err).Int64("user_id", n.ID).Msg("Failed to load changed user")
+		c.reset()
+		return
+	}
+
+	c.publish(eventType, user, n.Time)
+}
+
+// Reconnected resets subscribers, notifications sent while disconnected are lost
+func (c *UserChanges) Reconnected() {
+	c.reset()
+}
+
+func (c *UserChanges) publish(eventType domain.EventType, user domain.User, at time.Time) {
+	c.logger.Debug().Str("type", string(eventType)).Int64("user_id", user.ID).Msg("Change detected")
+	event := domain.UserEvent{Type: eventType, User: user, Time: at.UTC()}
+	for _, publisher := range c.publishers {
+		publisher.Publish(event)
+	}
+}
+
+func (c *UserChanges) reset() {
+	for _, publisher := range c.publishers {
+		publisher.Reset()
+	}
+}
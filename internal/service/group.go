@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+)
+
+type GroupsRepository interface {
+	Create(ctx context.Context, group domain.Group) (domain.Group, error)
+	GetByID(ctx context.Context, id int64) (domain.Group, error)
+	List(ctx context.Context) ([]domain.Group, error)
+	Update(ctx context.Context, id int64, group domain.Group) (domain.Group, error)
+	// Delete removes the group and its memberships
+	Delete(ctx context.Context, id int64) error
+	// AddMember adds a user to a group, adding a member again does nothing
+	AddMember(ctx context.Context, groupID, userID int64) error
+	RemoveMember(ctx context.Context, groupID, userID int64) error
+	// Members returns the users in a group ordered by ID
+	Members(ctx context.Context, groupID int64) ([]domain.User, error)
+	// UserGroups returns the groups of a user ordered by ID
+	UserGroups(ctx context.Context, userID int64) ([]domain.Group, error)
+}
+
+// Groups organizes users into teams
+type Groups struct {
+	repo GroupsRepository
+}
+
+func NewGroups(repo GroupsRepository) *Groups {
+	return &Groups{repo: repo}
+}
+
+func (g *Groups) Create(ctx context.Context, group domain.Group) (domain.Group, error) {
+	group.Normalize()
+	if err := group.Validate(); err != nil {
+		return domain.Group{}, err
+	}
+	return g.repo.Create(ctx, group)
+}
+
+func (g *Groups) GetByID(ctx context.Context, id int64) (domain.Group, error) {
+	return g.repo.GetByID(ctx, id)
+}
+
+func (g *Groups) List(ctx context.Context) ([]domain.Group, error) {
+	return g.repo.List(ctx)
+}
+
+func (g *Groups) Update(ctx context.Context, id int64, group domain.Group) (domain.Group, error) {
+	group.Normalize()
+	if err := group.Validate(); err != nil {
+		return domain.Group{}, err
+	}
+	return g.repo.Update(ctx, id, group)
+}
+
+func (g *Groups) Delete(ctx context.Context, id int64) error {
+	return g.repo.Delete(ctx, id)
+}
+
+func (g *Groups) AddMember(ctx context.Context, groupID, userID int64) error {
+	return g.repo.AddMember(ctx, groupID, userID)
+}
+
+func (g *Groups) RemoveMember(ctx context.Context, groupID, userID int64) error {
+	return g.repo.RemoveMember(ctx, groupID, userID)
+}
+
+func (g *Groups) Members(ctx context.Context, groupID int64) ([]domain.User, error) {
+	return g.repo.Members(ctx, groupID)
+}
+
+func (g *Groups) UserGroups(ctx context.Context, userID int64) ([]domain.Group, error) {
+	return g.repo.UserGroups(ctx, userID)
+}
@@ -1,43 +1,239 @@
 package service
 
 import (
+	"context"
 	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/search"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
 )
 
+// maxSearchQueryLength bounds the work of a single search
+const maxSearchQueryLength = 200
+
 type UsersRepository interface {
-	Create(user domain.User) error
-	GetByID(id int64) (domain.User, error)
-	GetAll() ([]domain.User, error)
-	Delete(id int64) error
-	Update(id int64, inp domain.User) error
+	Create(ctx context.Context, user domain.User) (domain.User, error)
+	GetByID(ctx context.Context, id int64) (domain.User, error)
+	GetByEmail(ctx context.Context, email string) (domain.User, error)
+	GetByIDs(ctx context.Context, ids []int64) ([]domain.User, error)
+	GetAll(ctx context.Context) ([]domain.User, error)
+	List(ctx context.Context, filter domain.UserFilter) ([]domain.User, error)
+	Search(ctx context.Context, search domain.UserSearch) ([]domain.UserSearchResult, error)
+	Changes(ctx context.Context, since domain.ChangeCursor, limit int) (domain.UserChanges, error)
+	Delete(ctx context.Context, id int64) error
+	Update(ctx context.Context, id int64, inp domain.User) (domain.User, error)
+}
+
+// AttributeDefinitions provides the definitions of custom user attributes
+type AttributeDefinitions interface {
+	Definitions(ctx context.Context) (map[string]domain.AttributeDefinition, error)
+}
+
+// EventPublisher receives user changes after they have been stored
+type EventPublisher interface {
+	Publish(event domain.UserEvent)
 }
 
 type Users struct {
-	repo UsersRepository
+	repo       UsersRepository
+	events     EventPublisher
+	attributes AttributeDefinitions
 }
 
-func NewUsers(repo UsersRepository) *Users {
+// NewUsers creates the users service, events may be nil. Without attribute
+// definitions users can't have custom attributes.
+func NewUsers(repo UsersRepository, events EventPublisher, attributes AttributeDefinitions) *Users {
 	return &Users{
-		repo: repo,
+		repo:       repo,
+		events:     events,
+		attributes: attributes,
+	}
+}
+
+// Create normalizes, validates and stores a user, returning it as stored
+// with the assigned ID
+func (b *Users) Create(ctx context.Context, user domain.User) (domain.User, error) {
+	// Addresses are managed as their own resource
+	user.Addresses = nil
+	user.Normalize()
+	if err := b.validate(ctx, user); err != nil {
+		return domain.User{}, err
+	}
+
+	user, err := b.repo.Create(ctx, user)
+	if err != nil {
+		return domain.User{}, err
+	}
+	b.publish(domain.EventUserCreated, user)
+
+	return user, nil
+}
+
+func (b *Users) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	return b.repo.GetByID(ctx, id)
+}
+
+// GetByEmail finds a user by email address, in any case
+func (b *Users) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	email = domain.NormalizeEmail(email)
+	if !domain.ValidEmail(email) {
+		return domain.User{}, &domain.ValidationError{
+			Entity:     "user",
+			Violations: []domain.FieldViolation{{Field: "email", Description: "must be a valid email address"}},
+		}
+	}
+	return b.repo.GetByEmail(ctx, email)
+}
+
+// GetByIDs returns the users that exist among ids in a single query
+func (b *Users) GetByIDs(ctx context.Context, ids []int64) ([]domain.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return b.repo.GetByIDs(ctx, ids)
+}
+
+func (b *Users) GetAll(ctx context.Context) ([]domain.User, error) {
+	return b.repo.GetAll(ctx)
+}
+
+// List returns the users matching filter. Attribute values given as
+// strings, like query parameters, are converted to the attribute's type.
+func (b *Users) List(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	if len(filter.Attributes) > 0 {
+		definitions, err := b.definitions(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		attributes := make(map[string]interface{}, len(filter.Attributes))
+		var violations []domain.FieldViolation
+		for name, value := range filter.Attributes {
+			definition, ok := definitions[name]
+			if !ok {
+				violations = append(violations, domain.FieldViolation{Field: "attr." + name, Description: "is not a defined attribute"})
+				continue
+			}
+			if raw, ok := value.(string); ok {
+				if value, err = definition.ParseValue(raw); err != nil {
+					violations = append(violations, domain.FieldViolation{Field: "attr." + name, Description: err.Error()})
+					continue
+				}
+			}
+			attributes[name] = value
+		}
+		if len(violations) > 0 {
+			return nil, &domain.ValidationError{Entity: "filter", Violations: violations}
+		}
+		filter.Attributes = attributes
+	}
+
+	return b.repo.List(ctx, filter)
+}
+
+func (b *Users) Delete(ctx context.Context, id int64) error {
+	if err := b.repo.Delete(ctx, id); err != nil {
+		return err
 	}
+	b.publish(domain.EventUserDeleted, domain.User{ID: id})
+
+	return nil
 }
 
-func (b *Users) Create(user domain.User) error {
-	return b.repo.Create(user)
+// Update replaces a user, returning it as stored
+func (b *Users) Update(ctx context.Context, id int64, inp domain.User) (domain.User, error) {
+	inp.Addresses = nil
+	inp.Normalize()
+	if err := b.validate(ctx, inp); err != nil {
+		return domain.User{}, err
+	}
+	user, err := b.repo.Update(ctx, id, inp)
+	if err != nil {
+		return domain.User{}, err
+	}
+	b.publish(domain.EventUserUpdated, user)
+
+	return user, nil
+}
+
+// Search finds users by words of their name, also misspelled, and
+// highlights the matching words
+func (b *Users) Search(ctx context.Context, s domain.UserSearch) ([]domain.UserSearchResult, error) {
+	var violations []domain.FieldViolation
+	if len(search.Terms(s.Query)) == 0 {
+		violations = append(violations, domain.FieldViolation{Field: "q", Description: "must contain a letter or digit"})
+	}
+	if utf8.RuneCountInString(s.Query) > maxSearchQueryLength {
+		violations = append(violations, domain.FieldViolation{Field: "q", Description: fmt.Sprintf("must be at most %d characters", maxSearchQueryLength)})
+	}
+	if len(violations) > 0 {
+		return nil, &domain.ValidationError{Entity: "search", Violations: violations}
+	}
+
+	results, err := b.repo.Search(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].Highlight = search.Highlight(results[i].User.Name, s.Query)
+	}
+	return results, nil
 }
 
-func (b *Users) GetByID(id int64) (domain.User, error) {
-	return b.repo.GetByID(id)
+// Changes returns the users created, updated and deleted since a token,
+// for clients keeping a copy of the users. An empty token starts a full
+// sync without deletions.
+func (b *Users) Changes(ctx context.Context, since string, limit int) (domain.UserChanges, error) {
+	cursor, err := domain.ParseChangeToken(since)
+	if err != nil {
+		return domain.UserChanges{}, err
+	}
+	if limit < 1 {
+		return domain.UserChanges{}, &domain.ValidationError{
+			Entity:     "changes",
+			Violations: []domain.FieldViolation{{Field: "limit", Description: "must be positive"}},
+		}
+	}
+	return b.repo.Changes(ctx, cursor, limit)
 }
 
-func (b *Users) GetAll() ([]domain.User, error) {
-	return b.repo.GetAll()
+// validate checks a user, with its attributes against their definitions
+func (b *Users) validate(ctx context.Context, user domain.User) error {
+	var violations []domain.FieldViolation
+	var validationErr *domain.ValidationError
+	if err := user.Validate(); errors.As(err, &validationErr) {
+		violations = validationErr.Violations
+	}
+
+	definitions, err := b.definitions(ctx)
+	if err != nil {
+		return err
+	}
+	violations = append(violations, domain.ValidateAttributes(definitions, user.Attributes)...)
+
+	if len(violations) > 0 {
+		return &domain.ValidationError{Entity: "user", Violations: violations}
+	}
+	return nil
 }
 
-func (b *Users) Delete(id int64) error {
-	return b.repo.Delete(id)
+func (b *Users) definitions(ctx context.Context) (map[string]domain.AttributeDefinition, error) {
+	if b.attributes == nil {
+		return nil, nil
+	}
+	definitions, err := b.attributes.Definitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attribute definitions: %w", err)
+	}
+	return definitions, nil
 }
 
-func (b *Users) Update(id int64, inp domain.User) error {
-	return b.repo.Update(id, inp)
+func (b *Users) publish(eventType domain.EventType, user domain.User) {
+	if b.events == nil {
+		return
+	}
+	b.events.Publish(domain.UserEvent{Type: eventType, User: user, Time: time.Now().UTC()})
 }
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/logger"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+)
+
+type WebhooksRepository interface {
+	CreateSubscription(ctx context.Context, sub domain.WebhookSubscription) (domain.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id int64) (domain.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, id int64, sub domain.WebhookSubscription) (domain.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id int64) error
+	EnqueueDeliveries(ctx context.Context, eventType domain.EventType, payload []byte) (int64, error)
+	ListDeliveries(ctx context.Context, subscriptionID int64, status domain.DeliveryStatus, limit int) ([]domain.WebhookDelivery, error)
+	RetryDelivery(ctx context.Context, subscriptionID, deliveryID int64) error
+}
+
+// Webhooks manages webhook subscriptions and queues a delivery for every
+// matching subscription when a user event is relayed from the outbox
+type Webhooks struct {
+	repo   WebhooksRepository
+	logger zerolog.Logger
+}
+
+func NewWebhooks(repo WebhooksRepository) *Webhooks {
+	return &Webhooks{
+		repo:   repo,
+		logger: logger.GetLogger("webhooks"),
+	}
+}
+
+// Create stores a subscription. Without a secret one is generated; the
+// returned subscription is the only place it is shown.
+func (w *Webhooks) Create(ctx context.Context, sub domain.WebhookSubscription) (domain.WebhookSubscription, error) {
+	if err := sub.Validate(); err != nil {
+		return domain.WebhookSubscription{}, err
+	}
+
+	if sub.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			return domain.WebhookSubscription{}, err
+		}
+		sub.Secret = secret
+	}
+
+	return w.repo.CreateSubscription(ctx, sub)
+}
+
+func (w *Webhooks) Get(ctx context.Context, id int64) (domain.WebhookSubscription, error) {
+	return w.repo.GetSubscription(ctx, id)
+}
+
+func (w *Webhooks) List(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	return w.repo.ListSubscriptions(ctx)
+}
+
+// Update replaces a subscription, an empty secret keeps the current one
+func (w *Webhooks) Update(ctx context.Context, id int64, sub domain.WebhookSubscription) (domain.WebhookSubscription, error) {
+	if err := sub.Validate(); err != nil {
+		return domain.WebhookSubscription{}, err
+	}
+	return w.repo.UpdateSubscription(ctx, id, sub)
+}
+
+func (w *Webhooks) Delete(ctx context.Context, id int64) error {
+	return w.repo.DeleteSubscription(ctx, id)
+}
+
+// Deliveries returns the delivery log of a subscription, newest first
+func (w *Webhooks) Deliveries(ctx context.Context, subscriptionID int64, status domain.DeliveryStatus, limit int) ([]domain.WebhookDelivery, error) {
+	if _, err := w.repo.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	return w.repo.ListDeliveries(ctx, subscriptionID, status, limit)
+}
+
+// RetryDelivery requeues a delivery, typically a dead-lettered one
+func (w *Webhooks) RetryDelivery(ctx context.Context, subscriptionID, deliveryID int64) error {
+	return w.repo.RetryDelivery(ctx, subscriptionID, deliveryID)
+}
+
+// Enqueue queues a delivery of the event for every enabled subscription
+// to its type
+func (w *Webhooks) Enqueue(ctx context.Context, event domain.UserEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	count, err := w.repo.EnqueueDeliveries(ctx, event.Type, payload)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		w.logger.Debug().
+			Str("type", string(event.Type)).
+			Int64("user_id", event.User.ID).
+			Int64("deliveries", count).
+			Msg("Webhook deliveries enqueued")
+	}
+	return nil
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
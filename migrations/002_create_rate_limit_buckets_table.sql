@@ -0,0 +1,12 @@
+-- Migration: 002_create_rate_limit_buckets_table.sql
+-- Description: Token buckets shared by all instances for the Postgres rate limit store
+
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+-- Speed up removal of refilled buckets
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_expires_at ON rate_limit_buckets(expires_at);
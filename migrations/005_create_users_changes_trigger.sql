@@ -0,0 +1,29 @@
+-- Migration: 005_create_users_changes_trigger.sql
+-- Description: Notify the users_changes channel about every change to users,
+-- including changes made outside the API. Requires PostgreSQL 14+.
+
+-- Payloads only carry the ID, listeners load the row themselves. This keeps
+-- them under the 8000 byte notification limit whatever the row holds.
+CREATE OR REPLACE FUNCTION notify_users_changes()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'TRUNCATE' THEN
+        PERFORM pg_notify('users_changes', json_build_object('op', TG_OP, 'time', now())::text);
+    ELSIF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('users_changes', json_build_object('op', TG_OP, 'id', OLD.id, 'time', now())::text);
+    ELSE
+        PERFORM pg_notify('users_changes', json_build_object('op', TG_OP, 'id', NEW.id, 'time', now())::text);
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER notify_users_changes
+    AFTER INSERT OR UPDATE OR DELETE ON users
+    FOR EACH ROW
+    EXECUTE FUNCTION notify_users_changes();
+
+CREATE OR REPLACE TRIGGER notify_users_truncate
+    AFTER TRUNCATE ON users
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION notify_users_changes();
@@ -0,0 +1,14 @@
+-- Migration: 006_add_users_search.sql
+-- Description: Full-text and fuzzy search over user names.
+-- Creating the pg_trgm extension needs the CREATE privilege on the database.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Names aren't stemmed, the 'simple' configuration only lowercases words
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', name)) STORED;
+
+-- Prefix queries on words of the name
+CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN (search_vector);
+-- Word similarity (<%) for misspelled names
+CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING GIN (name gin_trgm_ops);
@@ -0,0 +1,10 @@
+-- Migration: 007_add_users_email_phone.sql
+-- Description: Optional email and phone of users, each unique.
+-- The application stores emails in lower case and phones in E.164 form.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email VARCHAR(254);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone VARCHAR(16);
+
+-- Unique also for rows written by SQL in another case, NULLs don't conflict
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_unique ON users (lower(email));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone_unique ON users (phone);
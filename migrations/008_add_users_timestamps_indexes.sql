@@ -0,0 +1,12 @@
+-- Migration: 008_add_users_timestamps_indexes.sql
+-- Description: Time-range queries on created_at and updated_at, used by
+-- incremental syncs (GET /users?updated_since=...).
+
+-- Rows written before the defaults existed
+UPDATE users SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+UPDATE users SET updated_at = created_at WHERE updated_at IS NULL;
+
+ALTER TABLE users ALTER COLUMN created_at SET NOT NULL;
+ALTER TABLE users ALTER COLUMN updated_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_updated_at ON users(updated_at);
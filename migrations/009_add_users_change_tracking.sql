@@ -0,0 +1,40 @@
+-- Migration: 009_add_users_change_tracking.sql
+-- Description: Change tracking for incremental sync (GET /users/changes).
+-- Every row remembers the transactions that created and last changed it,
+-- deleted users leave a tombstone. A sync returns the changes of
+-- transactions older than the oldest one still running, so that changes
+-- committing late aren't skipped. xid8 needs PostgreSQL 13+.
+-- TRUNCATE leaves no tombstones, clients have to sync from scratch after.
+
+-- Existing rows count as changed before any token
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_xid xid8 NOT NULL DEFAULT '0';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS changed_xid xid8 NOT NULL DEFAULT '0';
+CREATE INDEX IF NOT EXISTS idx_users_changed_xid ON users (changed_xid, id);
+
+CREATE TABLE IF NOT EXISTS users_tombstones (
+    id BIGINT PRIMARY KEY,
+    deleted_xid xid8 NOT NULL,
+    deleted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_users_tombstones_deleted_xid ON users_tombstones (deleted_xid, id);
+
+CREATE OR REPLACE FUNCTION track_users_changes()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO users_tombstones (id, deleted_xid) VALUES (OLD.id, pg_current_xact_id())
+        ON CONFLICT (id) DO UPDATE SET deleted_xid = EXCLUDED.deleted_xid, deleted_at = EXCLUDED.deleted_at;
+        RETURN OLD;
+    END IF;
+    IF TG_OP = 'INSERT' THEN
+        NEW.created_xid = pg_current_xact_id();
+    END IF;
+    NEW.changed_xid = pg_current_xact_id();
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER track_users_changes
+    BEFORE INSERT OR UPDATE OR DELETE ON users
+    FOR EACH ROW
+    EXECUTE FUNCTION track_users_changes();
@@ -0,0 +1,16 @@
+-- Migration: 010_add_users_attributes.sql
+-- Description: Custom user attributes stored as JSONB and the registry
+-- defining their names, types and validation rules
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+
+-- Serves containment filters (attributes @> ...) and existence checks
+-- (attributes ? name) when deleting a definition
+CREATE INDEX IF NOT EXISTS idx_users_attributes ON users USING GIN (attributes);
+
+CREATE TABLE IF NOT EXISTS user_attributes (
+    name VARCHAR(63) PRIMARY KEY,
+    definition JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
@@ -0,0 +1,25 @@
+-- Migration: 011_create_groups_tables.sql
+-- Description: Groups of users and their memberships. Deleting a user or a
+-- group removes its memberships.
+
+CREATE TABLE IF NOT EXISTS groups (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description VARCHAR(1000) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_groups_name_unique ON groups(lower(name));
+
+CREATE TABLE IF NOT EXISTS group_memberships (
+    group_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (group_id, user_id),
+    CONSTRAINT fk_group_memberships_group FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+    CONSTRAINT fk_group_memberships_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Groups of a user; the primary key serves members of a group
+CREATE INDEX IF NOT EXISTS idx_group_memberships_user ON group_memberships(user_id, group_id);
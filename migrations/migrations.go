@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL migrations, so that schemas created at
+// startup come from the same files
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,29 @@
+// Package blob stores binary objects, like uploaded images, by key
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps objects under slash separated keys, like "avatars/1/original".
+// Put replaces an existing object atomically: readers see either the old or
+// the new content.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open fails with ErrNotFound for missing objects
+	Open(ctx context.Context, key string) (*Object, error)
+	// Delete fails with ErrNotFound for missing objects
+	Delete(ctx context.Context, key string) error
+}
+
+// Object is the content of a stored object, to be closed after reading
+type Object struct {
+	io.ReadSeekCloser
+	Size    int64
+	ModTime time.Time
+}
@@ -0,0 +1,299 @@
+package config
+
+import (
+	"time"
+)
+
+// Config is the complete application configuration.
+//
+// Values are resolved in the following order, later sources win:
+// defaults, YAML file (-config flag or CONFIG_FILE), environment variables
+// (env tag) and command-line flags (dotted yaml path, e.g. -db.host).
+// Fields tagged with secret are masked when the configuration is printed.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	GRPC      GRPCConfig      `yaml:"grpc"`
+	Events    EventsConfig    `yaml:"events"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Outbox    OutboxConfig    `yaml:"outbox"`
+	Webhooks  WebhooksConfig  `yaml:"webhooks"`
+	Avatars   AvatarsConfig   `yaml:"avatars"`
+	CORS      CORSConfig      `yaml:"cors"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	OpenAPI   OpenAPIConfig   `yaml:"openapi"`
+	Database  DatabaseConfig  `yaml:"db"`
+	Log       LogConfig       `yaml:"log"`
+	Admin     AdminConfig     `yaml:"admin"`
+}
+
+type ServerConfig struct {
+	Addr            string        `yaml:"addr" env:"SERVER_ADDR" usage:"HTTP listen address"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" usage:"graceful shutdown timeout"`
+	TrustedProxies  []string      `yaml:"trusted_proxies" env:"SERVER_TRUSTED_PROXIES" usage:"IPs/CIDRs of proxies allowed to set X-Forwarded-For"`
+}
+
+type GRPCConfig struct {
+	Enabled    bool   `yaml:"enabled" env:"GRPC_ENABLED" usage:"serve the gRPC API"`
+	Addr       string `yaml:"addr" env:"GRPC_ADDR" usage:"gRPC listen address"`
+	Reflection bool   `yaml:"reflection" env:"GRPC_REFLECTION" usage:"register the server reflection service"`
+}
+
+type EventsConfig struct {
+	Listen           bool `yaml:"listen" env:"EVENTS_LISTEN" usage:"detect changes through Postgres notifications, including changes made outside the API"`
+	ReplaySize       int  `yaml:"replay_size" env:"EVENTS_REPLAY_SIZE" usage:"recent events kept for resuming streams"`
+	SubscriberBuffer int  `yaml:"subscriber_buffer" env:"EVENTS_SUBSCRIBER_BUFFER" usage:"events queued per subscriber before it is dropped"`
+}
+
+type CacheConfig struct {
+	Enabled     bool          `yaml:"enabled" env:"CACHE_ENABLED" usage:"cache users in process"`
+	Size        int           `yaml:"size" env:"CACHE_SIZE" usage:"maximum number of cached users"`
+	TTL         time.Duration `yaml:"ttl" env:"CACHE_TTL" usage:"how long a user is cached"`
+	NegativeTTL time.Duration `yaml:"negative_ttl" env:"CACHE_NEGATIVE_TTL" usage:"how long a missing user is remembered, 0 disables it"`
+	ListSize    int           `yaml:"list_size" env:"CACHE_LIST_SIZE" usage:"maximum number of cached list results, 0 disables them"`
+	ListTTL     time.Duration `yaml:"list_ttl" env:"CACHE_LIST_TTL" usage:"how long a list result is cached"`
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval" env:"OUTBOX_POLL_INTERVAL" usage:"how often the outbox is polled for new events"`
+	BatchSize    int           `yaml:"batch_size" env:"OUTBOX_BATCH_SIZE" usage:"events relayed per transaction"`
+	Retention    time.Duration `yaml:"retention" env:"OUTBOX_RETENTION" usage:"how long delivered events are kept, 0 keeps them forever"`
+	Publishers   []string      `yaml:"publishers" env:"OUTBOX_PUBLISHERS" usage:"where events are relayed to: log, webhook, file"`
+	FilePath     string        `yaml:"file_path" env:"OUTBOX_FILE_PATH" usage:"JSON lines file of the file publisher"`
+}
+
+type WebhooksConfig struct {
+	Enabled        bool          `yaml:"enabled" env:"WEBHOOKS_ENABLED" usage:"deliver user events to webhook subscriptions"`
+	PollInterval   time.Duration `yaml:"poll_interval" env:"WEBHOOKS_POLL_INTERVAL" usage:"how often the delivery queue is polled"`
+	BatchSize      int           `yaml:"batch_size" env:"WEBHOOKS_BATCH_SIZE" usage:"deliveries sent concurrently per poll"`
+	MaxAttempts    int           `yaml:"max_attempts" env:"WEBHOOKS_MAX_ATTEMPTS" usage:"attempts before a delivery is dead-lettered"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" env:"WEBHOOKS_INITIAL_BACKOFF" usage:"delay before the first retry, doubled per attempt"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" env:"WEBHOOKS_MAX_BACKOFF" usage:"maximum delay between retries"`
+	Timeout        time.Duration `yaml:"timeout" env:"WEBHOOKS_TIMEOUT" usage:"timeout of a single delivery request"`
+}
+
+type AvatarsConfig struct {
+	Dir           string        `yaml:"dir" env:"AVATARS_DIR" usage:"directory avatars are stored in"`
+	MaxSize       int64         `yaml:"max_size" env:"AVATARS_MAX_SIZE" usage:"largest accepted upload in bytes"`
+	MaxPixels     int           `yaml:"max_pixels" env:"AVATARS_MAX_PIXELS" usage:"largest accepted image, width times height"`
+	ThumbnailSize int           `yaml:"thumbnail_size" env:"AVATARS_THUMBNAIL_SIZE" usage:"width and height of thumbnails in pixels"`
+	CacheMaxAge   time.Duration `yaml:"cache_max_age" env:"AVATARS_CACHE_MAX_AGE" usage:"how long clients may cache avatars without revalidating"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string          `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" usage:"allowed origins: *, exact origins or https://*.example.com patterns"`
+	AllowedMethods   []string          `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS" usage:"methods allowed in preflight requests"`
+	AllowedHeaders   []string          `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS" usage:"request headers allowed in preflight requests"`
+	ExposedHeaders   []string          `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS" usage:"response headers readable by browsers"`
+	AllowCredentials bool              `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" usage:"allow cookies and authorization headers, not compatible with origin *"`
+	MaxAge           time.Duration     `yaml:"max_age" env:"CORS_MAX_AGE" usage:"how long browsers cache preflight responses"`
+	Routes           map[string]string `yaml:"routes" env:"CORS_ROUTES" usage:"per-route origins, /path/template=space separated origins,..."`
+}
+
+type RateLimitConfig struct {
+	Enabled         bool              `yaml:"enabled" env:"RATE_LIMIT_ENABLED" usage:"enable request rate limiting"`
+	Store           string            `yaml:"store" env:"RATE_LIMIT_STORE" usage:"bucket store: memory or postgres"`
+	Default         string            `yaml:"default" env:"RATE_LIMIT_DEFAULT" usage:"default limit as <requests>/<period>"`
+	Routes          map[string]string `yaml:"routes" env:"RATE_LIMIT_ROUTES" usage:"per-route limits, METHOD /path=<requests>/<period>,..."`
+	KeyBy           []string          `yaml:"key_by" env:"RATE_LIMIT_KEY_BY" usage:"client key sources in order: api_key, jwt_sub, ip"`
+	CleanupInterval time.Duration     `yaml:"cleanup_interval" env:"RATE_LIMIT_CLEANUP_INTERVAL" usage:"how often refilled buckets are removed"`
+}
+
+type OpenAPIConfig struct {
+	ValidateRequests  bool  `yaml:"validate_requests" env:"OPENAPI_VALIDATE_REQUESTS" usage:"reject requests that do not match the OpenAPI document"`
+	ValidateResponses bool  `yaml:"validate_responses" env:"OPENAPI_VALIDATE_RESPONSES" usage:"replace non-conforming responses with 500, for tests"`
+	MaxBodySize       int64 `yaml:"max_body_size" env:"OPENAPI_MAX_BODY_SIZE" usage:"largest JSON request body in bytes, larger ones get 413"`
+}
+
+type DatabaseConfig struct {
+	Backend         string           `yaml:"backend" env:"DB_BACKEND" usage:"where users are stored: postgres, or memory without the outbox, webhooks and change notifications"`
+	Host            string           `yaml:"host" env:"DB_HOST" usage:"PostgreSQL host"`
+	Port            int              `yaml:"port" env:"DB_PORT" usage:"PostgreSQL port"`
+	User            string           `yaml:"user" env:"DB_USER" usage:"PostgreSQL user"`
+	Password        string           `yaml:"password" env:"DB_PASSWORD" secret:"true" usage:"PostgreSQL password"`
+	Name            string           `yaml:"name" env:"DB_NAME" usage:"PostgreSQL database name"`
+	SSLMode         string           `yaml:"sslmode" env:"DB_SSLMODE" usage:"PostgreSQL sslmode"`
+	MaxOpenConns    int              `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" usage:"maximum number of open connections"`
+	MaxIdleConns    int              `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" usage:"maximum number of idle connections"`
+	ConnMaxLifetime time.Duration    `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" usage:"maximum connection lifetime"`
+	ConnMaxIdleTime time.Duration    `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" usage:"maximum time a connection may stay idle"`
+	Retry           DBRetryConfig    `yaml:"retry"`
+	Replicas        DBReplicasConfig `yaml:"replicas"`
+}
+
+type DBReplicasConfig struct {
+	Hosts               []string      `yaml:"hosts" env:"DB_REPLICA_HOSTS" usage:"comma separated read replicas as host[:port]"`
+	HealthCheckInterval time.Duration `yaml:"health_check_interval" env:"DB_REPLICA_HEALTH_CHECK_INTERVAL" usage:"replica health check period"`
+	StickyWindow        time.Duration `yaml:"sticky_window" env:"DB_REPLICA_STICKY_WINDOW" usage:"how long reads of a client go to the primary after its write"`
+}
+
+type DBRetryConfig struct {
+	InitialInterval time.Duration `yaml:"initial_interval" env:"DB_RETRY_INITIAL_INTERVAL" usage:"delay before the first reconnect attempt"`
+	MaxInterval     time.Duration `yaml:"max_interval" env:"DB_RETRY_MAX_INTERVAL" usage:"maximum delay between reconnect attempts"`
+	MaxWait         time.Duration `yaml:"max_wait" env:"DB_RETRY_MAX_WAIT" usage:"total time to wait for the database on startup, 0 disables retries"`
+}
+
+type LogConfig struct {
+	Level      string            `yaml:"level" env:"LOG_LEVEL" usage:"global log level"`
+	Components map[string]string `yaml:"component_levels" env:"LOG_COMPONENT_LEVELS" usage:"per-component levels, component=level,..."`
+	Format     string            `yaml:"format" env:"LOG_FORMAT" usage:"stdout/stderr format: json, console or syslog"`
+	TimeFormat string            `yaml:"time_format" env:"LOG_TIME_FORMAT" usage:"timestamp layout"`
+	AppName    string            `yaml:"app_name" env:"LOG_APP_NAME" usage:"application name in syslog output"`
+	Outputs    []string          `yaml:"outputs" env:"LOG_OUTPUTS" usage:"comma separated outputs: stdout, stderr, file"`
+	File       LogFileConfig     `yaml:"file"`
+	Sampling   LogSamplingConfig `yaml:"sampling"`
+}
+
+type LogFileConfig struct {
+	Path        string        `yaml:"path" env:"LOG_FILE_PATH" usage:"log file path"`
+	Format      string        `yaml:"format" env:"LOG_FILE_FORMAT" usage:"log file format: json, console or syslog"`
+	MaxSizeMB   int           `yaml:"max_size_mb" env:"LOG_FILE_MAX_SIZE_MB" usage:"rotate after this size, 0 disables"`
+	RotateEvery time.Duration `yaml:"rotate_every" env:"LOG_FILE_ROTATE_EVERY" usage:"rotate after this period, 0 disables"`
+	MaxBackups  int           `yaml:"max_backups" env:"LOG_FILE_MAX_BACKUPS" usage:"rotated files to keep, 0 keeps all"`
+	MaxAge      time.Duration `yaml:"max_age" env:"LOG_FILE_MAX_AGE" usage:"rotated files retention, 0 keeps all"`
+}
+
+type LogSamplingConfig struct {
+	Components []string      `yaml:"components" env:"LOG_SAMPLE_COMPONENTS" usage:"components whose info logs are sampled"`
+	Burst      uint32        `yaml:"burst" env:"LOG_SAMPLE_BURST" usage:"events written per period before sampling"`
+	Period     time.Duration `yaml:"period" env:"LOG_SAMPLE_PERIOD" usage:"sampling period"`
+	Every      uint32        `yaml:"every" env:"LOG_SAMPLE_EVERY" usage:"write every N-th event after the burst, 0 drops"`
+}
+
+type AdminConfig struct {
+	Token string `yaml:"token" env:"ADMIN_TOKEN" secret:"true" usage:"bearer token for admin endpoints, empty disables them"`
+}
+
+// Default returns the configuration used when no other source sets a value
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":3000",
+			ShutdownTimeout: 5 * time.Second,
+		},
+		GRPC: GRPCConfig{
+			Enabled:    true,
+			Addr:       ":9090",
+			Reflection: true,
+		},
+		Events: EventsConfig{
+			Listen:           true,
+			ReplaySize:       1000,
+			SubscriberBuffer: 64,
+		},
+		Cache: CacheConfig{
+			Enabled:     true,
+			Size:        10000,
+			TTL:         time.Minute,
+			NegativeTTL: 10 * time.Second,
+			ListSize:    100,
+			ListTTL:     5 * time.Second,
+		},
+		Outbox: OutboxConfig{
+			PollInterval: time.Second,
+			BatchSize:    100,
+			Retention:    24 * time.Hour,
+			Publishers:   []string{"webhook"},
+		},
+		Webhooks: WebhooksConfig{
+			Enabled:        true,
+			PollInterval:   time.Second,
+			BatchSize:      10,
+			MaxAttempts:    8,
+			InitialBackoff: 10 * time.Second,
+			MaxBackoff:     time.Hour,
+			Timeout:        10 * time.Second,
+		},
+		Avatars: AvatarsConfig{
+			Dir:           "data/avatars",
+			MaxSize:       5 << 20,
+			MaxPixels:     25_000_000,
+			ThumbnailSize: 128,
+			CacheMaxAge:   5 * time.Minute,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD"},
+			AllowedHeaders: []string{
+				"Accept",
+				"Accept-Language",
+				"Content-Type",
+				"Content-Language",
+				"Authorization",
+				"X-Requested-With",
+				"X-API-Key",
+				"X-Read-Primary",
+				"Range",
+				"If-None-Match",
+			},
+			ExposedHeaders: []string{
+				"Content-Length",
+				"Content-Type",
+				"ETag",
+				"Accept-Ranges",
+				"Content-Range",
+				"Location",
+				"Retry-After",
+				"RateLimit-Limit",
+				"RateLimit-Remaining",
+				"RateLimit-Reset",
+				"RateLimit-Policy",
+			},
+			MaxAge: 24 * time.Hour,
+			Routes: map[string]string{},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:         true,
+			Store:           "memory",
+			Default:         "100/1m",
+			Routes:          map[string]string{"GET /users": "20/1m"},
+			KeyBy:           []string{"ip"},
+			CleanupInterval: time.Minute,
+		},
+		OpenAPI: OpenAPIConfig{
+			ValidateRequests: true,
+			MaxBodySize:      1 << 20,
+		},
+		Database: DatabaseConfig{
+			Backend:         "postgres",
+			Host:            "localhost",
+			Port:            5432,
+			User:            "postgres",
+			Name:            "postgres",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnMaxIdleTime: time.Minute,
+			Retry: DBRetryConfig{
+				InitialInterval: 500 * time.Millisecond,
+				MaxInterval:     10 * time.Second,
+				MaxWait:         time.Minute,
+			},
+			Replicas: DBReplicasConfig{
+				HealthCheckInterval: 5 * time.Second,
+				StickyWindow:        5 * time.Second,
+			},
+		},
+		Log: LogConfig{
+			Level:      "info",
+			Components: map[string]string{},
+			Format:     "json",
+			TimeFormat: time.RFC3339,
+			AppName:    "crud-without-db",
+			Outputs:    []string{"stdout"},
+			File: LogFileConfig{
+				Path:        "logs/app.log",
+				Format:      "json",
+				MaxSizeMB:   100,
+				RotateEvery: 24 * time.Hour,
+				MaxBackups:  7,
+				MaxAge:      7 * 24 * time.Hour,
+			},
+			Sampling: LogSamplingConfig{
+				Burst:  100,
+				Period: time.Second,
+				Every:  10,
+			},
+		},
+	}
+}
@@ -0,0 +1,289 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const secretMask = "******"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is a leaf configuration value addressed by its dotted yaml path
+type field struct {
+	path   string
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// Load resolves the configuration from defaults, an optional YAML file,
+// environment variables and the given command-line arguments, then validates it
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	fields := collectFields(reflect.ValueOf(cfg).Elem(), "")
+
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML configuration file")
+	flagValues := make(map[string]*string, len(fields))
+	for _, f := range fields {
+		flagValues[f.path] = fs.String(f.path, formatValue(f.value), f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []FieldError
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		if value := os.Getenv(f.env); value != "" {
+			if err := setValue(f.value, value); err != nil {
+				errs = append(errs, FieldError{Field: f.path, Message: fmt.Sprintf("%s: %v", f.env, err)})
+			}
+		}
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	for _, f := range fields {
+		if !set[f.path] {
+			continue
+		}
+		if err := setValue(f.value, *flagValues[f.path]); err != nil {
+			errs = append(errs, FieldError{Field: f.path, Message: fmt.Sprintf("-%s: %v", f.path, err)})
+		}
+	}
+
+	var verr *ValidationError
+	if err := cfg.Validate(); errors.As(err, &verr) {
+		errs = append(errs, verr.Fields...)
+	}
+
+	if len(errs) > 0 {
+		return nil, &ValidationError{Fields: errs}
+	}
+
+	return cfg, nil
+}
+
+// Usage writes the list of supported flags and environment variables
+func Usage(w io.Writer) {
+	fmt.Fprintf(w, "  -config\n\tpath to a YAML configuration file (env CONFIG_FILE)\n")
+	for _, f := range collectFields(reflect.ValueOf(Default()).Elem(), "") {
+		fmt.Fprintf(w, "  -%s\n\t%s (env %s, default %q)\n", f.path, f.usage, f.env, formatValue(f.value))
+	}
+}
+
+// Print writes the effective configuration as YAML with secrets masked
+func (c *Config) Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, f := range collectFields(reflect.ValueOf(c).Elem(), "") {
+		value := valueNode(f.value)
+		if f.secret && formatValue(f.value) != "" {
+			value = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: secretMask}
+		}
+		insertNode(root, strings.Split(f.path, "."), value)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	return enc.Close()
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func collectFields(v reflect.Value, prefix string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			fields = append(fields, collectFields(v.Field(i), path)...)
+			continue
+		}
+
+		fields = append(fields, field{
+			path:   path,
+			env:    sf.Tag.Get("env"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return fields
+}
+
+// setValue parses a flag or environment variable into a field.
+// Lists are comma separated, maps are "key=value,key=value".
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint32:
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", s)
+		}
+		v.SetUint(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		items := map[string]string{}
+		for _, pair := range strings.Split(s, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("invalid key=value pair %q", pair)
+			}
+			items[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	case reflect.Map:
+		items := v.Interface().(map[string]string)
+		pairs := make([]string, 0, len(items))
+		for key, value := range items {
+			pairs = append(pairs, key+"="+value)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// valueNode renders a field as a YAML node that Load is able to read back
+func valueNode(v reflect.Value) *yaml.Node {
+	if v.Type() == durationType {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: formatValue(v)}
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range v.Interface().([]string) {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+		}
+		return node
+	case reflect.Map:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		items := v.Interface().(map[string]string)
+		keys := make([]string, 0, len(items))
+		for key := range items {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: items[key]})
+		}
+		return node
+	case reflect.String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v.String()}
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: formatValue(v)}
+	}
+}
+
+func insertNode(parent *yaml.Node, path []string, value *yaml.Node) {
+	if len(path) == 1 {
+		parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: path[0]}, value)
+		return
+	}
+
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == path[0] {
+			insertNode(parent.Content[i+1], path[1:], value)
+			return
+		}
+	}
+
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: path[0]}, child)
+	insertNode(child, path[1:], value)
+}
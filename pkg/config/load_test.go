@@ -0,0 +1,188 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a YAML configuration file and returns its path
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, `
+db:
+  host: file-host
+  port: 6000
+  user: file-user
+log:
+  level: debug
+rate_limit:
+  key_by: [api_key, ip]
+`)
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Database.Host != "localhost" || cfg.Database.Port != 5432 || cfg.Log.Level != "info" {
+					t.Errorf("db %s:%d, log level %s, want the defaults", cfg.Database.Host, cfg.Database.Port, cfg.Log.Level)
+				}
+			},
+		},
+		{
+			name: "file over defaults",
+			args: []string{"-config", file},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Database.Host != "file-host" || cfg.Database.Port != 6000 || cfg.Log.Level != "debug" {
+					t.Errorf("db %s:%d, log level %s, want the file values", cfg.Database.Host, cfg.Database.Port, cfg.Log.Level)
+				}
+				if got := strings.Join(cfg.RateLimit.KeyBy, ","); got != "api_key,ip" {
+					t.Errorf("rate_limit.key_by = %s, want api_key,ip", got)
+				}
+				if cfg.Database.Name != "postgres" {
+					t.Errorf("db.name = %s, want the default for values missing in the file", cfg.Database.Name)
+				}
+			},
+		},
+		{
+			name: "file from CONFIG_FILE",
+			env:  map[string]string{"CONFIG_FILE": file},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Database.Host != "file-host" {
+					t.Errorf("db.host = %s, want file-host", cfg.Database.Host)
+				}
+			},
+		},
+		{
+			name: "env over file",
+			env:  map[string]string{"DB_HOST": "env-host", "RATE_LIMIT_KEY_BY": "jwt_sub, ip", "LOG_COMPONENT_LEVELS": "cache=warn"},
+			args: []string{"-config", file},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Database.Host != "env-host" || cfg.Database.Port != 6000 {
+					t.Errorf("db %s:%d, want env-host:6000", cfg.Database.Host, cfg.Database.Port)
+				}
+				if got := strings.Join(cfg.RateLimit.KeyBy, ","); got != "jwt_sub,ip" {
+					t.Errorf("rate_limit.key_by = %s, want jwt_sub,ip", got)
+				}
+				if got := cfg.Log.Components["cache"]; got != "warn" {
+					t.Errorf("log.component_levels.cache = %q, want warn", got)
+				}
+			},
+		},
+		{
+			name: "flags over env",
+			env:  map[string]string{"DB_HOST": "env-host", "DB_USER": "env-user"},
+			args: []string{"-config", file, "-db.host", "flag-host", "-db.retry.max_wait=30s"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Database.Host != "flag-host" || cfg.Database.User != "env-user" || cfg.Database.Port != 6000 {
+					t.Errorf("db %s@%s:%d, want env-user@flag-host:6000", cfg.Database.User, cfg.Database.Host, cfg.Database.Port)
+				}
+				if cfg.Database.Retry.MaxWait != 30*time.Second {
+					t.Errorf("db.retry.max_wait = %s, want 30s", cfg.Database.Retry.MaxWait)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load(tt.args)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadValidationErrors(t *testing.T) {
+	t.Setenv("DB_MAX_OPEN_CONNS", "many")
+	t.Setenv("WEBHOOKS_MAX_BACKOFF", "1s")
+
+	_, err := Load([]string{"-db.port", "0", "-log.level", "loud", "-outbox.publishers", "log,mail"})
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want a *ValidationError", err)
+	}
+	want := []FieldError{
+		{Field: "db.max_open_conns", Message: `DB_MAX_OPEN_CONNS: invalid integer "many"`},
+		{Field: "outbox.publishers", Message: `unknown publisher "mail", must be one of log, webhook, file`},
+		{Field: "webhooks.max_backoff", Message: "must not be less than webhooks.initial_backoff"},
+		{Field: "db.port", Message: "must be between 1 and 65535"},
+		{Field: "log.level", Message: `unknown log level "loud"`},
+	}
+	if len(verr.Fields) != len(want) {
+		t.Fatalf("errors = %+v, want %+v", verr.Fields, want)
+	}
+	for i := range want {
+		if verr.Fields[i] != want[i] {
+			t.Errorf("error %d = %+v, want %+v", i, verr.Fields[i], want[i])
+		}
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "invalid configuration:\n  db.max_open_conns: ") {
+		t.Errorf("message = %q, want one line per field", msg)
+	}
+}
+
+func TestLoadRejectsUnknownFileFields(t *testing.T) {
+	_, err := Load([]string{"-config", writeFile(t, "db:\n  hots: typo\n")})
+	if err == nil || !strings.Contains(err.Error(), "field hots not found") {
+		t.Fatalf("error = %v, want an unknown field error", err)
+	}
+}
+
+func TestPrintMasksSecrets(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "db-secret")
+	cfg, err := Load([]string{"-db.host", "db.internal"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	out := buf.String()
+
+	if strings.Contains(out, "db-secret") {
+		t.Errorf("printed configuration contains the password:\n%s", out)
+	}
+	if !strings.Contains(out, "password: '******'") {
+		t.Errorf("printed configuration does not mask the password:\n%s", out)
+	}
+	if !strings.Contains(out, `token: ""`) {
+		t.Errorf("printed configuration masks the empty admin token:\n%s", out)
+	}
+
+	// The dump loads back, secrets are set again from the environment
+	printed, err := Load([]string{"-config", writeFile(t, out)})
+	if err != nil {
+		t.Fatalf("Load of printed configuration: %v", err)
+	}
+	if printed.Database.Host != "db.internal" || printed.Database.Password != "db-secret" {
+		t.Errorf("db host %s, password %s; want the printed host and the environment password", printed.Database.Host, printed.Database.Password)
+	}
+}
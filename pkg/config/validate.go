@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// FieldError describes a single invalid configuration value
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError lists every invalid configuration value at once
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		lines = append(lines, fmt.Sprintf("  %s: %s", f.Field, f.Message))
+	}
+	return "invalid configuration:\n" + strings.Join(lines, "\n")
+}
+
+type validator struct {
+	errs []FieldError
+}
+
+func (v *validator) check(ok bool, field, format string, args ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (v *validator) checkLevel(field, level string) {
+	_, err := zerolog.ParseLevel(level)
+	v.check(err == nil && level != "", field, "unknown log level %q", level)
+}
+
+func (v *validator) checkFormat(field, format string) {
+	v.check(oneOf(format, "json", "console", "syslog"), field, "must be one of json, console, syslog")
+}
+
+// Validate checks all values and returns a *ValidationError listing every
+// problem. Values parsed by the packages they configure, like rate limits
+// and CORS origins, are checked where those packages are wired.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.check(c.Server.Addr != "", "server.addr", "must not be empty")
+	v.check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+
+	if c.GRPC.Enabled {
+		v.check(c.GRPC.Addr != "", "grpc.addr", "must not be empty")
+		v.check(c.GRPC.Addr != c.Server.Addr, "grpc.addr", "must differ from server.addr")
+	}
+
+	v.check(c.Events.ReplaySize >= 0, "events.replay_size", "must not be negative")
+	v.check(c.Events.SubscriberBuffer > 0, "events.subscriber_buffer", "must be positive")
+
+	if c.Cache.Enabled {
+		v.check(c.Cache.Size > 0, "cache.size", "must be positive")
+		v.check(c.Cache.TTL > 0, "cache.ttl", "must be positive")
+		v.check(c.Cache.NegativeTTL >= 0, "cache.negative_ttl", "must not be negative")
+		v.check(c.Cache.ListSize >= 0, "cache.list_size", "must not be negative")
+		v.check(c.Cache.ListSize == 0 || c.Cache.ListTTL > 0, "cache.list_ttl", "must be positive when list results are cached")
+	}
+
+	v.check(c.Outbox.PollInterval > 0, "outbox.poll_interval", "must be positive")
+	v.check(c.Outbox.BatchSize > 0, "outbox.batch_size", "must be positive")
+	v.check(c.Outbox.Retention >= 0, "outbox.retention", "must not be negative")
+	for _, publisher := range c.Outbox.Publishers {
+		v.check(oneOf(publisher, "log", "webhook", "file"), "outbox.publishers", "unknown publisher %q, must be one of log, webhook, file", publisher)
+		if publisher == "webhook" {
+			v.check(c.Webhooks.Enabled, "outbox.publishers", "webhook publisher requires webhooks.enabled")
+		}
+		if publisher == "file" {
+			v.check(c.Outbox.FilePath != "", "outbox.file_path", "must not be empty with the file publisher")
+		}
+	}
+
+	if c.Webhooks.Enabled {
+		v.check(c.Webhooks.PollInterval > 0, "webhooks.poll_interval", "must be positive")
+		v.check(c.Webhooks.BatchSize > 0, "webhooks.batch_size", "must be positive")
+		v.check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts", "must be positive")
+		v.check(c.Webhooks.InitialBackoff > 0, "webhooks.initial_backoff", "must be positive")
+		v.check(c.Webhooks.MaxBackoff >= c.Webhooks.InitialBackoff, "webhooks.max_backoff", "must not be less than webhooks.initial_backoff")
+		v.check(c.Webhooks.Timeout > 0, "webhooks.timeout", "must be positive")
+	}
+
+	v.check(c.OpenAPI.MaxBodySize > 0, "openapi.max_body_size", "must be positive")
+
+	v.check(c.Avatars.Dir != "", "avatars.dir", "must not be empty")
+	v.check(c.Avatars.MaxSize > 0, "avatars.max_size", "must be positive")
+	v.check(c.Avatars.MaxPixels > 0, "avatars.max_pixels", "must be positive")
+	v.check(c.Avatars.ThumbnailSize > 0 && c.Avatars.ThumbnailSize <= 1024, "avatars.thumbnail_size", "must be between 1 and 1024")
+	v.check(c.Avatars.CacheMaxAge >= 0, "avatars.cache_max_age", "must not be negative")
+
+	v.check(len(c.CORS.AllowedOrigins) > 0, "cors.allowed_origins", "must not be empty")
+	v.check(len(c.CORS.AllowedMethods) > 0, "cors.allowed_methods", "must not be empty")
+	v.check(c.CORS.MaxAge >= 0, "cors.max_age", "must not be negative")
+
+	if c.RateLimit.Enabled {
+		v.check(oneOf(c.RateLimit.Store, "memory", "postgres"), "rate_limit.store", "must be one of memory, postgres")
+		v.check(c.RateLimit.CleanupInterval > 0, "rate_limit.cleanup_interval", "must be positive")
+	}
+
+	v.check(oneOf(c.Database.Backend, "postgres", "memory"), "db.backend", "must be one of postgres, memory")
+	v.check(c.Database.Backend != "memory" || !c.RateLimit.Enabled || c.RateLimit.Store != "postgres",
+		"rate_limit.store", "postgres store requires the postgres db.backend")
+
+	v.check(c.Database.Host != "", "db.host", "must not be empty")
+	v.check(c.Database.Port > 0 && c.Database.Port <= 65535, "db.port", "must be between 1 and 65535")
+	v.check(c.Database.User != "", "db.user", "must not be empty")
+	v.check(c.Database.Name != "", "db.name", "must not be empty")
+	v.check(oneOf(c.Database.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full"),
+		"db.sslmode", "unknown sslmode %q", c.Database.SSLMode)
+	v.check(c.Database.MaxOpenConns >= 0, "db.max_open_conns", "must not be negative")
+	v.check(c.Database.MaxIdleConns >= 0, "db.max_idle_conns", "must not be negative")
+	v.check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"db.max_idle_conns", "must not exceed db.max_open_conns")
+	v.check(c.Database.ConnMaxLifetime >= 0, "db.conn_max_lifetime", "must not be negative")
+	v.check(c.Database.ConnMaxIdleTime >= 0, "db.conn_max_idle_time", "must not be negative")
+	v.check(c.Database.Retry.MaxWait >= 0, "db.retry.max_wait", "must not be negative")
+	v.check(c.Database.Retry.MaxWait == 0 || c.Database.Retry.InitialInterval > 0,
+		"db.retry.initial_interval", "must be positive when retries are enabled")
+	v.check(c.Database.Retry.MaxInterval == 0 || c.Database.Retry.MaxInterval >= c.Database.Retry.InitialInterval,
+		"db.retry.max_interval", "must not be less than db.retry.initial_interval")
+	v.check(c.Database.Replicas.HealthCheckInterval >= 0, "db.replicas.health_check_interval", "must not be negative")
+	v.check(c.Database.Replicas.StickyWindow >= 0, "db.replicas.sticky_window", "must not be negative")
+
+	v.checkLevel("log.level", c.Log.Level)
+	for component, level := range c.Log.Components {
+		v.checkLevel("log.component_levels."+component, level)
+	}
+	v.checkFormat("log.format", c.Log.Format)
+	v.check(len(c.Log.Outputs) > 0, "log.outputs", "must not be empty")
+	for _, output := range c.Log.Outputs {
+		v.check(oneOf(output, "stdout", "stderr", "file"), "log.outputs", "unknown output %q", output)
+		if output == "file" {
+			v.check(c.Log.File.Path != "", "log.file.path", "must not be empty when file output is enabled")
+			v.checkFormat("log.file.format", c.Log.File.Format)
+		}
+	}
+	v.check(c.Log.File.MaxSizeMB >= 0, "log.file.max_size_mb", "must not be negative")
+	v.check(c.Log.File.RotateEvery >= 0, "log.file.rotate_every", "must not be negative")
+	v.check(c.Log.File.MaxBackups >= 0, "log.file.max_backups", "must not be negative")
+	v.check(c.Log.File.MaxAge >= 0, "log.file.max_age", "must not be negative")
+	v.check(len(c.Log.Sampling.Components) == 0 || c.Log.Sampling.Period > 0,
+		"log.sampling.period", "must be positive when sampling is enabled")
+
+	if len(v.errs) > 0 {
+		return &ValidationError{Fields: v.errs}
+	}
+	return nil
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, item := range allowed {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"crud-without-db/pkg/logger"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type primaryKey struct{}
+
+// WithPrimary marks the context so that reads are served by the primary,
+// used for read-your-writes consistency
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsePrimary reports whether reads for the context must go to the primary
+func UsePrimary(ctx context.Context) bool {
+	usePrimary, _ := ctx.Value(primaryKey{}).(bool)
+	return usePrimary
+}
+
+// Cluster routes queries between the primary pool and read replica pools.
+// Replicas are health-checked in the background and picked round-robin;
+// reads fall back to the primary when no replica is healthy.
+type Cluster struct {
+	primary  *sql.DB
+	replicas []*replica
+	next     uint64
+
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	logger zerolog.Logger
+}
+
+type replica struct {
+	addr    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// NewCluster connects to the primary (failing if it is unreachable) and to
+// every configured replica (unreachable replicas are marked unhealthy)
+func NewCluster(config *Config) (*Cluster, error) {
+	primary, err := NewPostgresConnection(config)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cluster{
+		primary: primary,
+		stop:    make(chan struct{}),
+		logger:  logger.GetLogger("database"),
+	}
+
+	for _, addr := range config.Replicas {
+		replicaConfig, err := config.replicaConfig(addr)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		db, err := sql.Open("postgres", replicaConfig.ConnectionString())
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to open replica connection: %w", err)
+		}
+		configurePool(db, replicaConfig)
+
+		// Start as healthy so that an unreachable replica is reported by the first check
+		r := &replica{addr: addr, db: db}
+		r.healthy.Store(true)
+		c.replicas = append(c.replicas, r)
+		c.check(r)
+	}
+
+	if len(c.replicas) > 0 && config.HealthCheckInterval > 0 {
+		c.wg.Add(1)
+		go c.healthLoop(config.HealthCheckInterval)
+	}
+
+	return c, nil
+}
+
+// Primary returns the pool for writes
+func (c *Cluster) Primary() *sql.DB {
+	return c.primary
+}
+
+// Reader returns the pool for reads, honouring WithPrimary
+func (c *Cluster) Reader(ctx context.Context) *sql.DB {
+	if UsePrimary(ctx) || len(c.replicas) == 0 {
+		return c.primary
+	}
+
+	start := atomic.AddUint64(&c.next, 1)
+	for i := 0; i < len(c.replicas); i++ {
+		r := c.replicas[(start+uint64(i))%uint64(len(c.replicas))]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+
+	return c.primary
+}
+
+// Close stops health checks and closes all pools
+func (c *Cluster) Close() error {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+	c.wg.Wait()
+
+	var errs []error
+	for _, r := range c.replicas {
+		errs = append(errs, r.db.Close())
+	}
+	errs = append(errs, c.primary.Close())
+	return errors.Join(errs...)
+}
+
+func (c *Cluster) healthLoop(interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			for _, r := range c.replicas {
+				c.check(r)
+			}
+		}
+	}
+}
+
+func (c *Cluster) check(r *replica) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := r.db.PingContext(ctx)
+	healthy := err == nil
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+
+	if healthy {
+		c.logger.Info().Str("replica", r.addr).Msg("Read replica is healthy")
+	} else {
+		c.logger.Warn().Err(err).Str("replica", r.addr).Msg("Read replica is unhealthy, routing reads elsewhere")
+	}
+}
+
+// replicaConfig returns a copy of the primary config pointing at a "host[:port]" replica
+func (c *Config) replicaConfig(addr string) (*Config, error) {
+	replicaConfig := *c
+	replicaConfig.Host = addr
+
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replica port in %q: %w", addr, err)
+		}
+		replicaConfig.Host = host
+		replicaConfig.Port = p
+	}
+
+	return &replicaConfig, nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"crud-without-db/pkg/logger"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+const (
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+	// listenerPingInterval detects dead connections while no notifications arrive
+	listenerPingInterval = 90 * time.Second
+)
+
+// NotificationHandler receives the notifications of a Listener
+type NotificationHandler interface {
+	// Notify is called for every notification, in commit order
+	Notify(payload string)
+	// Reconnected is called when the connection was restored after a loss;
+	// notifications sent in between are lost
+	Reconnected()
+}
+
+// Listener receives notifications on a channel of the primary, which is
+// the only server notifications are sent on. It reconnects with backoff
+// when the connection is lost.
+type Listener struct {
+	config  *Config
+	channel string
+	handler NotificationHandler
+	logger  zerolog.Logger
+}
+
+func NewListener(config *Config, channel string, handler NotificationHandler) *Listener {
+	return &Listener{
+		config:  config,
+		channel: channel,
+		handler: handler,
+		logger:  logger.GetLogger("database").With().Str("channel", channel).Logger(),
+	}
+}
+
+// Run listens until the context is canceled
+func (l *Listener) Run(ctx context.Context) {
+	listener := pq.NewListener(l.config.ConnectionString(), minReconnectInterval, maxReconnectInterval, l.event)
+
+	// Listen blocks until connected, closing the listener ends the wait
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stopped:
+		}
+		listener.Close()
+	}()
+
+	if err := listener.Listen(l.channel); err != nil {
+		if ctx.Err() == nil {
+			l.logger.Error().Err(err).Msg("Failed to listen for notifications")
+		}
+		return
+	}
+	l.logger.Info().Msg("Listening for notifications")
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification follows a reconnect
+			if n == nil {
+				l.handler.Reconnected()
+				continue
+			}
+			l.handler.Notify(n.Extra)
+		case <-ping.C:
+			go func() {
+				if err := listener.Ping(); err != nil {
+					l.logger.Debug().Err(err).Msg("Notification listener ping failed")
+				}
+			}()
+		}
+	}
+}
+
+func (l *Listener) event(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventConnected:
+		l.logger.Debug().Msg("Notification listener connected")
+	case pq.ListenerEventDisconnected:
+		l.logger.Warn().Err(err).Msg("Notification listener disconnected")
+	case pq.ListenerEventReconnected:
+		l.logger.Info().Msg("Notification listener reconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		l.logger.Warn().Err(err).Msg("Notification listener failed to connect")
+	}
+}
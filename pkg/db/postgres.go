@@ -4,11 +4,11 @@ import (
 	"crud-without-db/pkg/logger"
 	"database/sql"
 	"fmt"
-	"os"
-	"strconv"
+	"math/rand"
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/rs/zerolog"
 )
 
 type Config struct {
@@ -18,19 +18,27 @@ type Config struct {
 	Password string
 	DBName   string
 	SSLMode  string
-}
 
-func NewConfigFromEnv() *Config {
-	port, _ := strconv.Atoi(getEnv("DB_PORT", "5432"))
+	// Connection pool
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
 
-	return &Config{
-		Host:     getEnv("DB_HOST", "localhost"),
-		Port:     port,
-		User:     getEnv("DB_USER", "postgres"),
-		Password: getEnv("DB_PASSWORD", ""),
-		DBName:   getEnv("DB_NAME", "postgres"),
-		SSLMode:  getEnv("DB_SSLMODE", "disable"),
-	}
+	Retry RetryConfig
+
+	// Read replicas as "host[:port]", sharing credentials and pool settings
+	Replicas            []string
+	HealthCheckInterval time.Duration
+}
+
+// RetryConfig controls connection attempts on startup. The delay between
+// attempts starts at InitialInterval and doubles up to MaxInterval, with
+// random jitter; attempts stop once MaxWait has passed. Zero MaxWait disables retries.
+type RetryConfig struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	MaxWait         time.Duration
 }
 
 func (c *Config) ConnectionString() string {
@@ -56,18 +64,17 @@ func NewPostgresConnection(config *Config) (*sql.DB, error) {
 	}
 
 	// Configure connection pool
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	configurePool(db, config)
 
 	dbLogger.Debug().
-		Int("max_open_conns", 25).
-		Int("max_idle_conns", 25).
-		Dur("conn_max_lifetime", 5*time.Minute).
+		Int("max_open_conns", config.MaxOpenConns).
+		Int("max_idle_conns", config.MaxIdleConns).
+		Dur("conn_max_lifetime", config.ConnMaxLifetime).
+		Dur("conn_max_idle_time", config.ConnMaxIdleTime).
 		Msg("Database connection pool configured")
 
-	// Test the connection
-	if err := db.Ping(); err != nil {
+	// Test the connection, retrying while the database is starting up
+	if err := pingWithRetry(db.Ping, config.Retry, dbLogger); err != nil {
 		db.Close()
 		dbLogger.Error().Err(err).Msg("Failed to ping database")
 		return nil, fmt.Errorf("failed to ping database: %w", err)
@@ -77,9 +84,44 @@ func NewPostgresConnection(config *Config) (*sql.DB, error) {
 	return db, nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func configurePool(db *sql.DB, config *Config) {
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+}
+
+func pingWithRetry(ping func() error, retry RetryConfig, dbLogger zerolog.Logger) error {
+	start := time.Now()
+	interval := retry.InitialInterval
+
+	for attempt := 1; ; attempt++ {
+		err := ping()
+		if err == nil {
+			return nil
+		}
+
+		elapsed := time.Since(start)
+		if retry.MaxWait <= 0 || elapsed >= retry.MaxWait {
+			return fmt.Errorf("giving up after %d attempts in %s: %w", attempt, elapsed.Round(time.Millisecond), err)
+		}
+
+		// Equal jitter keeps several instances from reconnecting in lockstep,
+		// the last attempt is made when MaxWait is up
+		delay := interval/2 + time.Duration(rand.Int63n(int64(interval/2)+1))
+		delay = min(delay, retry.MaxWait-elapsed)
+
+		dbLogger.Warn().Err(err).
+			Int("attempt", attempt).
+			Dur("retry_in", delay).
+			Dur("elapsed", elapsed).
+			Msg("Database is not available, retrying")
+
+		time.Sleep(delay)
+
+		interval *= 2
+		if retry.MaxInterval > 0 && interval > retry.MaxInterval {
+			interval = retry.MaxInterval
+		}
 	}
-	return defaultValue
 }
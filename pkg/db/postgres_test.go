@@ -0,0 +1,68 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestPingWithRetry(t *testing.T) {
+	errDown := errors.New("connection refused")
+
+	t.Run("last attempt when the wait is up", func(t *testing.T) {
+		retry := RetryConfig{InitialInterval: 40 * time.Millisecond, MaxInterval: 40 * time.Millisecond, MaxWait: 50 * time.Millisecond}
+		start := time.Now()
+		var attempts []time.Duration
+		ping := func() error {
+			attempts = append(attempts, time.Since(start))
+			return errDown
+		}
+
+		err := pingWithRetry(ping, retry, zerolog.Nop())
+
+		if !errors.Is(err, errDown) {
+			t.Fatalf("error = %v, want the ping error", err)
+		}
+		if len(attempts) < 2 {
+			t.Fatalf("attempts = %d, want a retry", len(attempts))
+		}
+		if last := attempts[len(attempts)-1]; last < retry.MaxWait {
+			t.Errorf("last attempt after %s, want it when MaxWait %s is up", last, retry.MaxWait)
+		}
+	})
+
+	t.Run("succeeds on the last attempt", func(t *testing.T) {
+		retry := RetryConfig{InitialInterval: time.Second, MaxWait: 20 * time.Millisecond}
+		start := time.Now()
+		ping := func() error {
+			if time.Since(start) < retry.MaxWait {
+				return errDown
+			}
+			return nil
+		}
+
+		if err := pingWithRetry(ping, retry, zerolog.Nop()); err != nil {
+			t.Fatalf("error = %v, want the attempt at MaxWait to succeed", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("waited %s, want the delay cut to MaxWait", elapsed)
+		}
+	})
+
+	t.Run("no retries", func(t *testing.T) {
+		attempts := 0
+		ping := func() error {
+			attempts++
+			return errDown
+		}
+
+		if err := pingWithRetry(ping, RetryConfig{InitialInterval: time.Second}, zerolog.Nop()); !errors.Is(err, errDown) {
+			t.Fatalf("error = %v, want the ping error", err)
+		}
+		if attempts != 1 {
+			t.Errorf("attempts = %d, want 1", attempts)
+		}
+	})
+}
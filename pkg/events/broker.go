@@ -0,0 +1,264 @@
+// Package events distributes user change events to in-process subscribers
+package events
+
+import (
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/logger"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSlowConsumer ends a subscription that didn't keep up with events
+	ErrSlowConsumer = errors.New("subscriber is too slow")
+	// ErrClosed ends subscriptions when the broker shuts down
+	ErrClosed = errors.New("broker is closed")
+	// ErrReset ends subscriptions when events may have been missed
+	ErrReset = errors.New("event stream was reset")
+)
+
+type Config struct {
+	// ReplaySize is the number of recent events kept for resuming clients
+	ReplaySize int
+	// SubscriberBuffer is the number of events queued per subscriber before
+	// it is dropped as a slow consumer
+	SubscriberBuffer int
+}
+
+// Event is a published user change with its position in the stream
+type Event struct {
+	Seq uint64
+	domain.UserEvent
+	epoch int64
+}
+
+// ID identifies the event for resuming. It includes the broker start time,
+// so IDs handed out before a restart are recognized as stale.
+func (e Event) ID() string {
+	return fmt.Sprintf("%d-%d", e.epoch, e.Seq)
+}
+
+// Filter selects events by user ID and type, empty fields match everything
+type Filter struct {
+	UserIDs []int64
+	Types   []domain.EventType
+}
+
+func (f Filter) Match(event domain.UserEvent) bool {
+	return (len(f.UserIDs) == 0 || containsID(f.UserIDs, event.User.ID)) &&
+		(len(f.Types) == 0 || containsType(f.Types, event.Type))
+}
+
+// Broker fans out published events to subscribers and keeps a bounded
+// buffer of recent events for resumption
+type Broker struct {
+	config Config
+	epoch  int64
+
+	mu     sync.Mutex
+	seq    uint64
+	replay []Event
+	subs   map[*Subscription]struct{}
+	closed bool
+
+	logger zerolog.Logger
+}
+
+func NewBroker(config Config) *Broker {
+	return &Broker{
+		config: config,
+		epoch:  time.Now().UnixNano(),
+		replay: make([]Event, 0, config.ReplaySize),
+		subs:   make(map[*Subscription]struct{}),
+		logger: logger.GetLogger("events"),
+	}
+}
+
+// Publish assigns the next sequence number to the event and delivers it.
+// It never blocks: subscribers with a full queue are dropped.
+func (b *Broker) Publish(event domain.UserEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.seq++
+	e := Event{Seq: b.seq, UserEvent: event, epoch: b.epoch}
+
+	if b.config.ReplaySize > 0 {
+		if len(b.replay) == b.config.ReplaySize {
+			copy(b.replay, b.replay[1:])
+			b.replay = b.replay[:len(b.replay)-1]
+		}
+		b.replay = append(b.replay, e)
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Match(event) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			b.logger.Warn().Uint64("seq", e.Seq).Msg("Dropping slow subscriber")
+			b.remove(sub, ErrSlowConsumer)
+		}
+	}
+
+	b.logger.Debug().
+		Uint64("seq", e.Seq).
+		Str("type", string(event.Type)).
+		Int64("user_id", event.User.ID).
+		Int("subscribers", len(b.subs)).
+		Msg("Event published")
+}
+
+// Subscribe starts a subscription. With a lastEventID the matching events
+// published after it are returned for replay; complete is false when they
+// are no longer all in the buffer (or the ID is from before a restart) and
+// the client has to reload its state instead.
+func (b *Broker) Subscribe(filter Filter, lastEventID string) (sub *Subscription, replay []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &Subscription{
+		broker: b,
+		filter: filter,
+		events: make(chan Event, b.config.SubscriberBuffer),
+		done:   make(chan struct{}),
+	}
+	if b.closed {
+		sub.err = ErrClosed
+		close(sub.done)
+		return sub, nil, true
+	}
+	b.subs[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+
+	seq, ok := b.parseID(lastEventID)
+	if !ok || seq > b.seq {
+		return sub, nil, false
+	}
+	// The event right after seq must still be buffered
+	if seq < b.seq && (len(b.replay) == 0 || b.replay[0].Seq > seq+1) {
+		return sub, nil, false
+	}
+
+	for _, e := range b.replay {
+		if e.Seq > seq && filter.Match(e.UserEvent) {
+			replay = append(replay, e)
+		}
+	}
+	return sub, replay, true
+}
+
+// Close ends all subscriptions, used on shutdown so streaming responses
+// don't hold the HTTP server open
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.remove(sub, ErrClosed)
+	}
+}
+
+// Reset starts a new stream after events may have been lost, e.g. while
+// the change feed was disconnected. Subscriptions end with ErrReset and the
+// IDs handed out so far become stale, so resuming clients reload their state.
+func (b *Broker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.epoch = time.Now().UnixNano()
+	b.replay = b.replay[:0]
+	for sub := range b.subs {
+		b.remove(sub, ErrReset)
+	}
+	b.logger.Warn().Msg("Event stream reset")
+}
+
+func (b *Broker) parseID(id string) (uint64, bool) {
+	epoch, seq, found := strings.Cut(id, "-")
+	if !found || epoch != strconv.FormatInt(b.epoch, 10) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
+
+// remove must be called with the lock held
+func (b *Broker) remove(sub *Subscription, err error) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	sub.err = err
+	close(sub.done)
+}
+
+// Subscription receives events matching its filter until it is closed
+type Subscription struct {
+	broker *Broker
+	filter Filter
+	events chan Event
+	done   chan struct{}
+	err    error
+}
+
+// Events delivers matching events in publishing order
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed when the broker ends the subscription, see Err
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err reports why the broker ended the subscription
+func (s *Subscription) Err() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.err
+}
+
+// Close unsubscribes
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s, nil)
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, item := range ids {
+		if item == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsType(types []domain.EventType, eventType domain.EventType) bool {
+	for _, item := range types {
+		if item == eventType {
+			return true
+		}
+	}
+	return false
+}
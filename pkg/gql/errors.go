@@ -0,0 +1,60 @@
+package gql
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"errors"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// Error codes reported in the "extensions" of GraphQL errors
+const (
+	codeBadUserInput = "BAD_USER_INPUT"
+	codeNotFound     = "NOT_FOUND"
+	codeConflict     = "CONFLICT"
+	codeInternal     = "INTERNAL_SERVER_ERROR"
+)
+
+// resolverError is an error with a machine readable code for clients
+type resolverError struct {
+	message    string
+	extensions map[string]interface{}
+}
+
+func newError(code, message string) *resolverError {
+	return &resolverError{message: message, extensions: map[string]interface{}{"code": code}}
+}
+
+func (e *resolverError) Error() string {
+	return e.message
+}
+
+func (e *resolverError) Extensions() map[string]interface{} {
+	return e.extensions
+}
+
+// publicError converts a service error into one that is safe to return to
+// clients. It reports false for unexpected errors, which should be logged.
+func publicError(err error) (gqlerrors.ExtendedError, bool) {
+	var resolverErr *resolverError
+	var validationErr *domain.ValidationError
+	switch {
+	case errors.As(err, &resolverErr):
+		return resolverErr, true
+	case errors.Is(err, domain.ErrUserNotFound):
+		return newError(codeNotFound, err.Error()), true
+	case errors.Is(err, domain.ErrUserConflict):
+		return newError(codeConflict, err.Error()), true
+	case errors.As(err, &validationErr):
+		fields := make(map[string]interface{}, len(validationErr.Violations))
+		for _, v := range validationErr.Violations {
+			fields[v.Field] = v.Description
+		}
+		public := newError(codeBadUserInput, err.Error())
+		public.extensions["fields"] = fields
+		return public, true
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return newError(codeInternal, err.Error()), true
+	}
+	return newError(codeInternal, "internal error"), false
+}
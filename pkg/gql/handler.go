@@ -0,0 +1,102 @@
+package gql
+
+import (
+	"crud-without-db/pkg/logger"
+	"encoding/json"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/rs/zerolog"
+	"net/http"
+)
+
+// maxRequestSize limits the size of a GraphQL request body
+const maxRequestSize = 1 << 20
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Handler serves GraphQL requests over HTTP POST. Only POST is accepted so
+// that mutations can't be triggered by cross-site links.
+type Handler struct {
+	users  Users
+	schema graphql.Schema
+	logger zerolog.Logger
+}
+
+func NewHandler(users Users) (*Handler, error) {
+	schema, err := newSchema(users)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{
+		users:  users,
+		schema: schema,
+		logger: logger.GetLogger("graphql"),
+	}, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		h.logger.Warn().Err(err).Msg("Invalid GraphQL request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if req.Query == "" {
+		h.logger.Warn().Str("reason", "missing query").Msg("Invalid GraphQL request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// A new loader per request, so batching and caching never leak between clients
+	ctx := withLoader(r.Context(), newUserLoader(h.users))
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+	result.Errors = h.publicErrors(result.Errors)
+
+	response, err := json.Marshal(result)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal GraphQL response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Debug().
+		Str("operation", req.OperationName).
+		Int("errors_count", len(result.Errors)).
+		Msg("GraphQL request processed")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// publicErrors hides unexpected resolver errors from clients and logs them
+func (h *Handler) publicErrors(errs []gqlerrors.FormattedError) []gqlerrors.FormattedError {
+	for i, formatted := range errs {
+		original := formatted.OriginalError()
+		if located, ok := original.(*gqlerrors.Error); ok {
+			original = located.OriginalError
+		}
+		if original == nil {
+			// Syntax and validation errors of the query itself
+			continue
+		}
+
+		public, ok := publicError(original)
+		if !ok {
+			h.logger.Error().Err(original).Interface("path", formatted.Path).Msg("GraphQL resolver failed")
+		}
+		errs[i].Message = public.Error()
+		errs[i].Extensions = public.Extensions()
+	}
+	return errs
+}
@@ -0,0 +1,88 @@
+package gql
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"sync"
+)
+
+type loaderKey struct{}
+
+// userLoader batches user lookups made while resolving one level of a query.
+// Resolvers register IDs and return thunks; graphql-go calls the thunks only
+// after every field of the level has been resolved, so the first thunk
+// fetches all pending IDs with a single GetByIDs call. Results are cached
+// for the rest of the request.
+type userLoader struct {
+	users Users
+
+	mu      sync.Mutex
+	pending []int64
+	// loaded holds nil for IDs that were fetched but don't exist
+	loaded map[int64]*domain.User
+	failed map[int64]error
+}
+
+func newUserLoader(users Users) *userLoader {
+	return &userLoader{
+		users:  users,
+		loaded: make(map[int64]*domain.User),
+		failed: make(map[int64]error),
+	}
+}
+
+func withLoader(ctx context.Context, loader *userLoader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, loader)
+}
+
+func loaderFrom(ctx context.Context) *userLoader {
+	loader, _ := ctx.Value(loaderKey{}).(*userLoader)
+	return loader
+}
+
+// load schedules id for the next batch and returns a thunk resolving to the
+// user, or to nil when it doesn't exist
+func (l *userLoader) load(ctx context.Context, id int64) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.loaded[id]; !ok {
+		l.pending = append(l.pending, id)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.dispatch(ctx)
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if err, ok := l.failed[id]; ok {
+			return nil, err
+		}
+		if user := l.loaded[id]; user != nil {
+			return *user, nil
+		}
+		return nil, nil
+	}
+}
+
+func (l *userLoader) dispatch(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.pending) == 0 {
+		return
+	}
+	ids := l.pending
+	l.pending = nil
+
+	users, err := l.users.GetByIDs(ctx, ids)
+	for _, id := range ids {
+		if err != nil {
+			l.failed[id] = err
+			continue
+		}
+		l.loaded[id] = nil
+	}
+	for i := range users {
+		l.loaded[users[i].ID] = &users[i]
+	}
+}
@@ -0,0 +1,111 @@
+package gql
+
+import (
+	"bytes"
+	"context"
+	"crud-without-db/internal/domain"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// countingUsers serves GetByIDs from a map and records every call; other
+// methods are left to the nil embedded interface
+type countingUsers struct {
+	Users
+
+	mu    sync.Mutex
+	users map[int64]domain.User
+	calls [][]int64
+}
+
+func (u *countingUsers) GetByIDs(ctx context.Context, ids []int64) ([]domain.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.calls = append(u.calls, append([]int64(nil), ids...))
+	var found []domain.User
+	for _, id := range ids {
+		if user, ok := u.users[id]; ok {
+			found = append(found, user)
+		}
+	}
+	return found, nil
+}
+
+func TestUserFieldsAreBatched(t *testing.T) {
+	users := &countingUsers{users: map[int64]domain.User{
+		1: {ID: 1, Name: "Ann", Age: 30, Sex: "female"},
+		2: {ID: 2, Name: "Bob", Age: 40, Sex: "male"},
+		3: {ID: 3, Name: "Cid", Age: 50, Sex: "other"},
+	}}
+	handler, err := NewHandler(users)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	body, _ := json.Marshal(request{Query: `{
+		a: user(id: 1) { name }
+		b: user(id: 2) { name }
+		c: user(id: 3) { name }
+		again: user(id: 1) { name }
+		missing: user(id: 4) { name }
+	}`})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var result struct {
+		Data   map[string]*struct{ Name string }
+		Errors []json.RawMessage
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode %s: %v", rec.Body, err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("errors = %s", result.Errors)
+	}
+	for alias, want := range map[string]string{"a": "Ann", "b": "Bob", "c": "Cid", "again": "Ann"} {
+		if got := result.Data[alias]; got == nil || got.Name != want {
+			t.Errorf("%s = %+v, want %s", alias, got, want)
+		}
+	}
+	if got, ok := result.Data["missing"]; !ok || got != nil {
+		t.Errorf("missing = %+v, want null", got)
+	}
+
+	if len(users.calls) != 1 {
+		t.Fatalf("GetByIDs calls = %v, want one", users.calls)
+	}
+	ids := users.calls[0]
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if len(ids) < 4 || ids[0] != 1 || ids[len(ids)-1] != 4 {
+		t.Errorf("GetByIDs ids = %v, want 1 to 4", ids)
+	}
+}
+
+func TestHandlerRejectsInvalidRequests(t *testing.T) {
+	handler, err := NewHandler(&countingUsers{})
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	for name, body := range map[string]string{
+		"invalid JSON":  `{"query":`,
+		"missing query": `{"variables":{}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewBufferString(body)))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
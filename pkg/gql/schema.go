@@ -0,0 +1,332 @@
+package gql
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"encoding/json"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 100
+)
+
+type Users interface {
+	Create(ctx context.Context, user domain.User) (domain.User, error)
+	GetByIDs(ctx context.Context, ids []int64) ([]domain.User, error)
+	List(ctx context.Context, filter domain.UserFilter) ([]domain.User, error)
+	Delete(ctx context.Context, id int64) error
+	Update(ctx context.Context, id int64, inp domain.User) (domain.User, error)
+}
+
+// userPage is a window of users.list results
+type userPage struct {
+	Items   []domain.User `json:"items"`
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+	HasMore bool          `json:"hasMore"`
+}
+
+var sexEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "Sex",
+	Values: graphql.EnumValueConfigMap{
+		"MALE":   &graphql.EnumValueConfig{Value: "male"},
+		"FEMALE": &graphql.EnumValueConfig{Value: "female"},
+		"OTHER":  &graphql.EnumValueConfig{Value: "other"},
+	},
+})
+
+// attributesScalar carries custom attributes as a JSON object of scalar
+// values. Numbers are float64 like in JSON decoded elsewhere.
+var attributesScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Attributes",
+	Description: "Custom attributes as a JSON object of strings, numbers and booleans",
+	Serialize: func(value interface{}) interface{} {
+		if attributes, ok := value.(map[string]interface{}); ok && len(attributes) > 0 {
+			return attributes
+		}
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		attributes, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for name, v := range attributes {
+			attributes[name] = attributeValue(v)
+		}
+		return attributes
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		object, ok := valueAST.(*ast.ObjectValue)
+		if !ok {
+			return nil
+		}
+		attributes := make(map[string]interface{}, len(object.Fields))
+		for _, field := range object.Fields {
+			switch v := field.Value.(type) {
+			case *ast.IntValue:
+				attributes[field.Name.Value], _ = strconv.ParseFloat(v.Value, 64)
+			case *ast.FloatValue:
+				attributes[field.Name.Value], _ = strconv.ParseFloat(v.Value, 64)
+			default:
+				attributes[field.Name.Value] = v.GetValue()
+			}
+		}
+		return attributes
+	},
+})
+
+var userType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "User",
+	Fields: graphql.Fields{
+		"id":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+		"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"age":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"sex":  &graphql.Field{Type: graphql.NewNonNull(sexEnum)},
+		"email": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return optional(p.Source.(domain.User).Email), nil
+		}},
+		"phone": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return optional(p.Source.(domain.User).Phone), nil
+		}},
+		"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(domain.User).CreatedAt, nil
+		}},
+		"updatedAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(domain.User).UpdatedAt, nil
+		}},
+		"attributes": &graphql.Field{Type: attributesScalar, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(domain.User).Attributes, nil
+		}},
+	},
+})
+
+var userPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserPage",
+	Fields: graphql.Fields{
+		"items":   &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType)))},
+		"limit":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"offset":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"hasMore": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+	},
+})
+
+var userFilterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UserFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":          &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Case-insensitive substring of the name"},
+		"sex":           &graphql.InputObjectFieldConfig{Type: sexEnum},
+		"minAge":        &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"maxAge":        &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"createdAfter":  &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+		"createdBefore": &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+		"updatedSince":  &graphql.InputObjectFieldConfig{Type: graphql.DateTime, Description: "Users updated at or after this time"},
+		"attributes":    &graphql.InputObjectFieldConfig{Type: attributesScalar, Description: "Users with these custom attribute values"},
+	},
+})
+
+var userInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UserInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"age":        &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+		"sex":        &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(sexEnum)},
+		"email":      &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Unique, stored in lower case"},
+		"phone":      &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Unique, international format like +14155550123"},
+		"attributes": &graphql.InputObjectFieldConfig{Type: attributesScalar, Description: "Custom attributes, each defined in the attribute registry"},
+	},
+})
+
+// resolver holds the field resolvers of the schema
+type resolver struct {
+	users Users
+}
+
+func newSchema(users Users) (graphql.Schema, error) {
+	r := &resolver{users: users}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type:        userType,
+				Description: "A user by ID, null when it doesn't exist",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: r.user,
+			},
+			"users": &graphql.Field{
+				Type:        graphql.NewNonNull(userPageType),
+				Description: "Users ordered by ID",
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: userFilterInput},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultLimit, Description: fmt.Sprintf("At most %d", maxLimit)},
+					"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+				},
+				Resolve: r.userList,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(userInput)},
+				},
+				Resolve: r.createUser,
+			},
+			"updateUser": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(userInput)},
+				},
+				Resolve: r.updateUser,
+			},
+			"deleteUser": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.ID),
+				Description: "Deletes a user and returns its ID",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: r.deleteUser,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func (r *resolver) user(p graphql.ResolveParams) (interface{}, error) {
+	id, err := idArg(p)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := loaderFrom(p.Context)
+	if loader == nil {
+		loader = newUserLoader(r.users)
+	}
+	return loader.load(p.Context, id), nil
+}
+
+func (r *resolver) userList(p graphql.ResolveParams) (interface{}, error) {
+	limit, _ := p.Args["limit"].(int)
+	offset, _ := p.Args["offset"].(int)
+	if limit < 1 || limit > maxLimit {
+		return nil, newError(codeBadUserInput, fmt.Sprintf("limit must be between 1 and %d", maxLimit))
+	}
+	if offset < 0 {
+		return nil, newError(codeBadUserInput, "offset must not be negative")
+	}
+
+	filter := domain.UserFilter{Limit: limit + 1, Offset: offset}
+	if args, ok := p.Args["filter"].(map[string]interface{}); ok {
+		filter.Name, _ = args["name"].(string)
+		filter.Sex, _ = args["sex"].(string)
+		filter.MinAge, _ = args["minAge"].(int)
+		filter.MaxAge, _ = args["maxAge"].(int)
+		filter.CreatedAfter, _ = args["createdAfter"].(time.Time)
+		filter.CreatedBefore, _ = args["createdBefore"].(time.Time)
+		filter.UpdatedSince, _ = args["updatedSince"].(time.Time)
+		filter.Attributes, _ = args["attributes"].(map[string]interface{})
+	}
+
+	users, err := r.users.List(p.Context, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra row tells whether there is a next page
+	page := userPage{Items: users, Limit: limit, Offset: offset}
+	if len(users) > limit {
+		page.Items = users[:limit]
+		page.HasMore = true
+	}
+	if page.Items == nil {
+		page.Items = []domain.User{}
+	}
+	return page, nil
+}
+
+func (r *resolver) createUser(p graphql.ResolveParams) (interface{}, error) {
+	return r.users.Create(p.Context, userFromInput(p.Args["input"]))
+}
+
+func (r *resolver) updateUser(p graphql.ResolveParams) (interface{}, error) {
+	id, err := idArg(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.users.Update(p.Context, id, userFromInput(p.Args["input"]))
+}
+
+func (r *resolver) deleteUser(p graphql.ResolveParams) (interface{}, error) {
+	id, err := idArg(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.users.Delete(p.Context, id); err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+func idArg(p graphql.ResolveParams) (int64, error) {
+	raw, _ := p.Args["id"].(string)
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 1 {
+		return 0, newError(codeBadUserInput, fmt.Sprintf("invalid user ID %q", raw))
+	}
+	return id, nil
+}
+
+func userFromInput(value interface{}) domain.User {
+	input, _ := value.(map[string]interface{})
+	var user domain.User
+	user.Name, _ = input["name"].(string)
+	user.Age, _ = input["age"].(int)
+	user.Sex, _ = input["sex"].(string)
+	user.Email, _ = input["email"].(string)
+	user.Phone, _ = input["phone"].(string)
+	user.Attributes, _ = input["attributes"].(map[string]interface{})
+	return user
+}
+
+// attributeValue converts the numbers of decoded variables to float64
+func attributeValue(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+// optional maps an empty string to null
+func optional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
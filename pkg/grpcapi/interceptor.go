@@ -0,0 +1,44 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// unaryLoggingInterceptor logs every unary call like the HTTP logging middleware
+func unaryLoggingInterceptor(log zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(log, ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// streamLoggingInterceptor logs streaming calls when they end
+func streamLoggingInterceptor(log zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(log, ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+func logCall(log zerolog.Logger, ctx context.Context, method string, start time.Time, err error) {
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	log.Info().
+		Str("method", method).
+		Str("remote_addr", remoteAddr).
+		Str("code", status.Code(err).String()).
+		Dur("duration", time.Since(start)).
+		Msg("gRPC request processed")
+}
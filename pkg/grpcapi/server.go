@@ -0,0 +1,89 @@
+package grpcapi
+
+import (
+	"context"
+	usersv1 "crud-without-db/api/users/v1"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/logger"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"net"
+)
+
+type Users interface {
+	Create(ctx context.Context, user domain.User) (domain.User, error)
+	GetByID(ctx context.Context, id int64) (domain.User, error)
+	List(ctx context.Context, filter domain.UserFilter) ([]domain.User, error)
+	Delete(ctx context.Context, id int64) error
+	Update(ctx context.Context, id int64, inp domain.User) (domain.User, error)
+}
+
+type Config struct {
+	// Reflection registers the server reflection service for tools like grpcurl
+	Reflection bool
+}
+
+// Server serves the users API over gRPC together with the standard health
+// service and, optionally, server reflection
+type Server struct {
+	grpcServer *grpc.Server
+	health     *health.Server
+	logger     zerolog.Logger
+}
+
+func NewServer(users Users, userEvents UserEvents, config Config) *Server {
+	log := logger.GetLogger("grpc")
+
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryLoggingInterceptor(log)),
+		grpc.ChainStreamInterceptor(streamLoggingInterceptor(log)),
+	)
+	usersv1.RegisterUsersServiceServer(grpcServer, &usersServer{
+		users:  users,
+		events: userEvents,
+		logger: log,
+	})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(usersv1.UsersService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	if config.Reflection {
+		reflection.Register(grpcServer)
+	}
+
+	return &Server{
+		grpcServer: grpcServer,
+		health:     healthServer,
+		logger:     log,
+	}
+}
+
+// Serve accepts connections on the listener until Shutdown is called
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpcServer.Serve(lis)
+}
+
+// Shutdown reports NOT_SERVING to health checks and waits for pending RPCs
+// to finish. Open streams are cut when the context expires.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		return ctx.Err()
+	}
+}
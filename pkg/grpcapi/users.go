@@ -0,0 +1,196 @@
+package grpcapi
+
+import (
+	"context"
+	usersv1 "crud-without-db/api/users/v1"
+	"crud-without-db/internal/domain"
+	"errors"
+	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+// usersServer implements usersv1.UsersServiceServer on top of the users service
+type usersServer struct {
+	usersv1.UnimplementedUsersServiceServer
+
+	users  Users
+	events UserEvents
+	logger zerolog.Logger
+}
+
+func (s *usersServer) CreateUser(ctx context.Context, req *usersv1.CreateUserRequest) (*usersv1.CreateUserResponse, error) {
+	user, err := s.users.Create(ctx, fromProto(req.GetUser()))
+	if err != nil {
+		return nil, s.toStatus(err, "CreateUser")
+	}
+
+	return &usersv1.CreateUserResponse{User: toProto(user)}, nil
+}
+
+func (s *usersServer) GetUser(ctx context.Context, req *usersv1.GetUserRequest) (*usersv1.GetUserResponse, error) {
+	if err := checkID(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetByID(ctx, req.GetId())
+	if err != nil {
+		return nil, s.toStatus(err, "GetUser")
+	}
+
+	return &usersv1.GetUserResponse{User: toProto(user)}, nil
+}
+
+func (s *usersServer) ListUsers(ctx context.Context, req *usersv1.ListUsersRequest) (*usersv1.ListUsersResponse, error) {
+	filter := domain.UserFilter{
+		CreatedAfter:  fromTimestamp(req.GetCreatedAfter()),
+		CreatedBefore: fromTimestamp(req.GetCreatedBefore()),
+		UpdatedSince:  fromTimestamp(req.GetUpdatedSince()),
+		Attributes:    fromStruct(req.GetAttributes()),
+	}
+	users, err := s.users.List(ctx, filter)
+	if err != nil {
+		return nil, s.toStatus(err, "ListUsers")
+	}
+
+	response := &usersv1.ListUsersResponse{Users: make([]*usersv1.User, 0, len(users))}
+	for _, user := range users {
+		response.Users = append(response.Users, toProto(user))
+	}
+	return response, nil
+}
+
+func (s *usersServer) UpdateUser(ctx context.Context, req *usersv1.UpdateUserRequest) (*usersv1.UpdateUserResponse, error) {
+	if err := checkID(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.Update(ctx, req.GetId(), fromProto(req.GetUser()))
+	if err != nil {
+		return nil, s.toStatus(err, "UpdateUser")
+	}
+
+	return &usersv1.UpdateUserResponse{User: toProto(user)}, nil
+}
+
+func (s *usersServer) DeleteUser(ctx context.Context, req *usersv1.DeleteUserRequest) (*usersv1.DeleteUserResponse, error) {
+	if err := checkID(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.users.Delete(ctx, req.GetId()); err != nil {
+		return nil, s.toStatus(err, "DeleteUser")
+	}
+
+	return &usersv1.DeleteUserResponse{}, nil
+}
+
+// toStatus maps service errors to gRPC status codes. Validation errors
+// carry a BadRequest detail with one violation per invalid field.
+func (s *usersServer) toStatus(err error, method string) error {
+	var validationErr *domain.ValidationError
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, domain.ErrUserConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.As(err, &validationErr):
+		badRequest := &errdetails.BadRequest{}
+		for _, v := range validationErr.Violations {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       "user." + v.Field,
+				Description: v.Description,
+			})
+		}
+		return withDetails(status.New(codes.InvalidArgument, err.Error()), badRequest)
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	s.logger.Error().Err(err).Str("method", method).Msg("Request failed")
+	return status.Error(codes.Internal, "internal error")
+}
+
+func checkID(id int64) error {
+	if id > 0 {
+		return nil
+	}
+	return withDetails(status.New(codes.InvalidArgument, "id must be positive"), &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "id", Description: "must be positive"}},
+	})
+}
+
+func withDetails(st *status.Status, details *errdetails.BadRequest) error {
+	if detailed, err := st.WithDetails(details); err == nil {
+		return detailed.Err()
+	}
+	return st.Err()
+}
+
+func toProto(user domain.User) *usersv1.User {
+	return &usersv1.User{
+		Id:         user.ID,
+		Name:       user.Name,
+		Age:        int32(user.Age),
+		Sex:        user.Sex,
+		Email:      user.Email,
+		Phone:      user.Phone,
+		CreatedAt:  toTimestamp(user.CreatedAt),
+		UpdatedAt:  toTimestamp(user.UpdatedAt),
+		Attributes: toStruct(user.Attributes),
+	}
+}
+
+func fromProto(user *usersv1.User) domain.User {
+	return domain.User{
+		Name:       user.GetName(),
+		Age:        int(user.GetAge()),
+		Sex:        user.GetSex(),
+		Email:      user.GetEmail(),
+		Phone:      user.GetPhone(),
+		Attributes: fromStruct(user.GetAttributes()),
+	}
+}
+
+// toStruct leaves users without attributes unset. Attribute values are
+// scalars, which always convert.
+func toStruct(attributes map[string]interface{}) *structpb.Struct {
+	if len(attributes) == 0 {
+		return nil
+	}
+	s, err := structpb.NewStruct(attributes)
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// fromStruct maps an unset struct to no attributes
+func fromStruct(s *structpb.Struct) map[string]interface{} {
+	if len(s.GetFields()) == 0 {
+		return nil
+	}
+	return s.AsMap()
+}
+
+// toTimestamp leaves the zero time, as in deletion events, unset
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// fromTimestamp maps an unset timestamp to the zero time
+func fromTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
@@ -0,0 +1,50 @@
+package grpcapi
+
+import (
+	usersv1 "crud-without-db/api/users/v1"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/events"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type UserEvents interface {
+	Subscribe(filter events.Filter, lastEventID string) (*events.Subscription, []events.Event, bool)
+}
+
+var changeTypes = map[domain.EventType]usersv1.ChangeType{
+	domain.EventUserCreated: usersv1.ChangeType_CHANGE_TYPE_CREATED,
+	domain.EventUserUpdated: usersv1.ChangeType_CHANGE_TYPE_UPDATED,
+	domain.EventUserDeleted: usersv1.ChangeType_CHANGE_TYPE_DELETED,
+}
+
+// WatchUsers streams changes published after the call starts. A client
+// that falls behind gets ResourceExhausted, and Aborted when changes may have
+// been missed; either way it should reload and watch again.
+func (s *usersServer) WatchUsers(req *usersv1.WatchUsersRequest, stream usersv1.UsersService_WatchUsersServer) error {
+	sub, _, _ := s.events.Subscribe(events.Filter{UserIDs: req.GetIds()}, "")
+	defer sub.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-sub.Done():
+			switch sub.Err() {
+			case events.ErrSlowConsumer:
+				return status.Error(codes.ResourceExhausted, sub.Err().Error())
+			case events.ErrReset:
+				return status.Error(codes.Aborted, "changes may have been missed, reload and watch again")
+			}
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case event := <-sub.Events():
+			err := stream.Send(&usersv1.WatchUsersResponse{
+				Type: changeTypes[event.Type],
+				User: toProto(event.User),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
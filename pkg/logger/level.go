@@ -0,0 +1,201 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LevelOverride describes a level set at runtime that replaces the configured one
+type LevelOverride struct {
+	Level     string     `json:"level"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// LevelsSnapshot is the current state of global and per-component log levels
+type LevelsSnapshot struct {
+	Global     string                   `json:"global"`
+	Components map[string]string        `json:"components"`
+	Overrides  map[string]LevelOverride `json:"overrides"`
+}
+
+type override struct {
+	level     zerolog.Level
+	expiresAt time.Time
+	timer     *time.Timer
+}
+
+// levelRegistry keeps configured and runtime log levels.
+// The empty component name refers to the global level.
+type levelRegistry struct {
+	mu         sync.RWMutex
+	global     zerolog.Level
+	components map[string]zerolog.Level
+	overrides  map[string]*override
+}
+
+var levels = &levelRegistry{
+	global:     zerolog.InfoLevel,
+	components: map[string]zerolog.Level{},
+	overrides:  map[string]*override{},
+}
+
+// configure replaces configured levels, keeping active runtime overrides
+func (lr *levelRegistry) configure(global zerolog.Level, components map[string]zerolog.Level) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	lr.global = global
+	lr.components = components
+	lr.apply()
+}
+
+func (lr *levelRegistry) set(component string, level zerolog.Level, ttl time.Duration) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	if prev, ok := lr.overrides[component]; ok && prev.timer != nil {
+		prev.timer.Stop()
+	}
+
+	ov := &override{level: level}
+	if ttl > 0 {
+		ov.expiresAt = time.Now().Add(ttl)
+		ov.timer = time.AfterFunc(ttl, func() {
+			lr.expire(component, ov)
+		})
+	}
+	lr.overrides[component] = ov
+	lr.apply()
+}
+
+func (lr *levelRegistry) reset(component string) bool {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	ov, ok := lr.overrides[component]
+	if !ok {
+		return false
+	}
+	if ov.timer != nil {
+		ov.timer.Stop()
+	}
+	delete(lr.overrides, component)
+	lr.apply()
+	return true
+}
+
+// expire removes the override only if it was not replaced in the meantime
+func (lr *levelRegistry) expire(component string, ov *override) {
+	lr.mu.Lock()
+	if lr.overrides[component] != ov {
+		lr.mu.Unlock()
+		return
+	}
+	delete(lr.overrides, component)
+	lr.apply()
+	lr.mu.Unlock()
+
+	expireLogger := GetLogger("logger")
+	expireLogger.Info().
+		Str("target", componentName(component)).
+		Msg("Runtime log level override expired")
+}
+
+// effective returns the level for a component, must be called with mu held
+func (lr *levelRegistry) effective(component string) zerolog.Level {
+	if ov, ok := lr.overrides[component]; ok {
+		return ov.level
+	}
+	if component != "" {
+		if level, ok := lr.components[component]; ok {
+			return level
+		}
+	}
+	if ov, ok := lr.overrides[""]; ok {
+		return ov.level
+	}
+	return lr.global
+}
+
+// apply lowers the zerolog global level to the most verbose level in use,
+// so that component hooks are able to filter events themselves
+func (lr *levelRegistry) apply() {
+	lowest := lr.effective("")
+	for component := range lr.components {
+		if level := lr.effective(component); level < lowest {
+			lowest = level
+		}
+	}
+	for component := range lr.overrides {
+		if level := lr.effective(component); level < lowest {
+			lowest = level
+		}
+	}
+	zerolog.SetGlobalLevel(lowest)
+}
+
+func (lr *levelRegistry) snapshot() LevelsSnapshot {
+	lr.mu.RLock()
+	defer lr.mu.RUnlock()
+
+	snapshot := LevelsSnapshot{
+		Global:     lr.effective("").String(),
+		Components: make(map[string]string),
+		Overrides:  make(map[string]LevelOverride),
+	}
+	for component := range lr.components {
+		snapshot.Components[component] = lr.effective(component).String()
+	}
+	for component, ov := range lr.overrides {
+		if component != "" {
+			snapshot.Components[component] = ov.level.String()
+		}
+		item := LevelOverride{Level: ov.level.String()}
+		if !ov.expiresAt.IsZero() {
+			expiresAt := ov.expiresAt
+			item.ExpiresAt = &expiresAt
+		}
+		snapshot.Overrides[componentName(component)] = item
+	}
+	return snapshot
+}
+
+// levelHook discards events below the effective level of its component
+type levelHook struct {
+	component string
+}
+
+func (h levelHook) Run(e *zerolog.Event, level zerolog.Level, _ string) {
+	levels.mu.RLock()
+	min := levels.effective(h.component)
+	levels.mu.RUnlock()
+
+	if level < min {
+		e.Discard()
+	}
+}
+
+// SetLevel overrides the level of a component (or the global level when
+// component is empty). A positive ttl reverts the override automatically.
+func SetLevel(component string, level zerolog.Level, ttl time.Duration) {
+	levels.set(component, level, ttl)
+}
+
+// ResetLevel removes a runtime override, returning false if none was set
+func ResetLevel(component string) bool {
+	return levels.reset(component)
+}
+
+// Levels returns the current global and per-component levels
+func Levels() LevelsSnapshot {
+	return levels.snapshot()
+}
+
+func componentName(component string) string {
+	if component == "" {
+		return "global"
+	}
+	return component
+}
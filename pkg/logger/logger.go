@@ -1,8 +1,11 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -12,60 +15,197 @@ import (
 // Config holds logger configuration
 type Config struct {
 	Level      string
-	Format     string // "json" or "console"
+	Components map[string]string // per-component levels, keyed by GetLogger component
+	Format     string            // "json" or "console"
 	TimeFormat string
+	AppName    string // used as APP-NAME in syslog formatted outputs
+	Outputs    []OutputConfig
+	Sampling   SamplingConfig
 }
 
-// NewConfigFromEnv creates logger config from environment variables
-func NewConfigFromEnv() *Config {
-	return &Config{
-		Level:      getEnv("LOG_LEVEL", "info"),
-		Format:     getEnv("LOG_FORMAT", "json"),
-		TimeFormat: getEnv("LOG_TIME_FORMAT", time.RFC3339),
-	}
+// OutputConfig describes a single log destination
+type OutputConfig struct {
+	Type   string // "stdout", "stderr" or "file"
+	Format string // "json", "console" or "syslog"
+
+	// File outputs only
+	Path        string
+	MaxSizeMB   int           // rotate when the file grows over this size, 0 disables
+	RotateEvery time.Duration // rotate when the file gets older than this, 0 disables
+	MaxBackups  int           // rotated files to keep, 0 keeps all
+	MaxAge      time.Duration // remove rotated files older than this, 0 keeps all
+}
+
+// SamplingConfig limits info logs of noisy components: the first Burst
+// events of every Period are written, then only every Every-th one
+type SamplingConfig struct {
+	Components []string
+	Burst      uint32
+	Period     time.Duration
+	Every      uint32
 }
 
+var (
+	closers []io.Closer
+
+	// mu guards the global logger and the sampling settings, InitLogger
+	// replaces them while GetLogger may run concurrently
+	mu      sync.RWMutex
+	sampler zerolog.Sampler
+	sampled = map[string]bool{}
+)
+
 // InitLogger initializes the global logger with the given configuration
-func InitLogger(config *Config) {
-	// Set log level
-	level, err := zerolog.ParseLevel(config.Level)
-	if err != nil {
-		level = zerolog.InfoLevel
-	}
-	zerolog.SetGlobalLevel(level)
+func InitLogger(config *Config) error {
+	// Set log levels
+	level := configureLevels(config)
 
 	// Configure time format
 	zerolog.TimeFieldFormat = config.TimeFormat
 
-	// Configure output format
-	if strings.ToLower(config.Format) == "console" {
-		// Pretty console output for development
-		log.Logger = log.Output(zerolog.ConsoleWriter{
-			Out:        os.Stdout,
-			TimeFormat: "15:04:05",
-		})
-	} else {
-		// JSON output for production
-		log.Logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+	// Release outputs of a previous initialization
+	if err := Close(); err != nil {
+		return err
 	}
 
+	// Configure outputs, stdout in the configured format by default
+	outputs := config.Outputs
+	if len(outputs) == 0 {
+		outputs = []OutputConfig{{Type: "stdout", Format: config.Format}}
+	}
+
+	writers := make([]io.Writer, 0, len(outputs))
+	for _, output := range outputs {
+		writer, err := newOutputWriter(output, config.AppName)
+		if err != nil {
+			Close()
+			return err
+		}
+		writers = append(writers, writer)
+	}
+
+	logger := zerolog.New(zerolog.MultiLevelWriter(writers...)).With().Timestamp().Logger()
+
 	// Add caller information for debugging
 	if level <= zerolog.DebugLevel {
-		log.Logger = log.Logger.With().Caller().Logger()
+		logger = logger.With().Caller().Logger()
+	}
+
+	// Configure sampling of noisy components
+	var componentSampler zerolog.Sampler
+	sampledComponents := map[string]bool{}
+	if len(config.Sampling.Components) > 0 {
+		burst := &zerolog.BurstSampler{
+			Burst:  config.Sampling.Burst,
+			Period: config.Sampling.Period,
+		}
+		if config.Sampling.Every > 0 {
+			burst.NextSampler = &zerolog.BasicSampler{N: config.Sampling.Every}
+		}
+		componentSampler = zerolog.LevelSampler{InfoSampler: burst}
+		for _, component := range config.Sampling.Components {
+			sampledComponents[component] = true
+		}
+	}
+
+	mu.Lock()
+	log.Logger = logger
+	sampler = componentSampler
+	sampled = sampledComponents
+	mu.Unlock()
+
+	return nil
+}
+
+// Close flushes and closes file outputs opened by InitLogger
+func Close() error {
+	var firstErr error
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	closers = nil
+	return firstErr
+}
+
+func newOutputWriter(output OutputConfig, appName string) (io.Writer, error) {
+	var out io.Writer
+	switch strings.ToLower(output.Type) {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	case "file":
+		file, err := newRotatingFile(output)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, file)
+		out = file
+	default:
+		return nil, fmt.Errorf("unknown log output type %q", output.Type)
+	}
+
+	switch strings.ToLower(output.Format) {
+	case "console":
+		// Pretty console output for development
+		return zerolog.ConsoleWriter{
+			Out:        out,
+			TimeFormat: "15:04:05",
+			NoColor:    out != os.Stdout && out != os.Stderr,
+		}, nil
+	case "syslog":
+		// RFC 5424 header followed by the JSON event
+		return newSyslogWriter(out, appName), nil
+	default:
+		// JSON output for production
+		return out, nil
 	}
 }
 
+// Reload re-applies log levels from the given configuration without
+// touching outputs, runtime overrides stay active until they expire
+func Reload(config *Config) {
+	configureLevels(config)
+
+	reloadLogger := GetLogger("logger")
+	reloadLogger.Info().
+		Str("level", config.Level).
+		Interface("components", config.Components).
+		Msg("Logger configuration reloaded")
+}
+
 // GetLogger returns a logger with optional fields
 func GetLogger(component string) zerolog.Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+
 	if component != "" {
-		return log.With().Str("component", component).Logger()
+		componentLogger := log.With().Str("component", component).Logger().Hook(levelHook{component: component})
+		if sampled[component] {
+			componentLogger = componentLogger.Sample(sampler)
+		}
+		return componentLogger
 	}
-	return log.Logger
+	return log.Logger.Hook(levelHook{})
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func configureLevels(config *Config) zerolog.Level {
+	level, err := zerolog.ParseLevel(config.Level)
+	if err != nil {
+		level = zerolog.InfoLevel
 	}
-	return defaultValue
+
+	components := make(map[string]zerolog.Level, len(config.Components))
+	for component, value := range config.Components {
+		componentLevel, err := zerolog.ParseLevel(value)
+		if err != nil || value == "" {
+			continue
+		}
+		components[component] = componentLevel
+	}
+
+	levels.configure(level, components)
+	return level
 }
@@ -0,0 +1,38 @@
+package logger
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestGetLoggerDuringInit fails under -race when GetLogger reads the
+// settings InitLogger replaces without synchronization
+func TestGetLoggerDuringInit(t *testing.T) {
+	config := &Config{
+		Level:    "info",
+		Outputs:  []OutputConfig{{Type: "stderr"}},
+		Sampling: SamplingConfig{Components: []string{"noisy"}, Burst: 1, Period: time.Second},
+	}
+	t.Cleanup(func() { InitLogger(&Config{Level: "info"}) })
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := InitLogger(config); err != nil {
+				t.Errorf("InitLogger: %v", err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			GetLogger("noisy")
+			GetLogger("")
+		}
+	}()
+	wg.Wait()
+}
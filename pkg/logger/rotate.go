@@ -0,0 +1,195 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// retryInterval is how long to keep appending to the current file after a
+// failed rotation or reopen before trying again
+const retryInterval = time.Minute
+
+// rotatingFile is an io.WriteCloser that rotates the underlying file when it
+// grows over maxSize or gets older than interval, keeping at most maxBackups
+// rotated files no older than maxAge
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+	interval   time.Duration
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	// retryAt delays rotating and reopening after a failure
+	retryAt time.Time
+	closed  bool
+}
+
+func newRotatingFile(config OutputConfig) (*rotatingFile, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("log file path is empty")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	f := &rotatingFile{
+		path:       config.Path,
+		maxSize:    int64(config.MaxSizeMB) * 1024 * 1024,
+		maxBackups: config.MaxBackups,
+		maxAge:     config.MaxAge,
+		interval:   config.RotateEvery,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Write appends p to the file. Rotation failures don't stop logging: the
+// current file is kept and rotation is retried after retryInterval.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	retry := !time.Now().Before(f.retryAt)
+	if f.file == nil && retry {
+		if err := f.open(); err != nil {
+			f.failed(err)
+		}
+	} else if f.file != nil && retry && f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			f.failed(err)
+		}
+	}
+	if f.file == nil {
+		return 0, fmt.Errorf("log file %s is not open", f.path)
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// failed reports an error on stderr, the log can't report its own errors,
+// and delays the next attempt
+func (f *rotatingFile) failed(err error) {
+	f.retryAt = time.Now().Add(retryInterval)
+	fmt.Fprintf(os.Stderr, "log file %s: %v, retrying in %s\n", f.path, err, retryInterval)
+}
+
+func (f *rotatingFile) shouldRotate(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+int64(n) > f.maxSize {
+		return true
+	}
+	return f.interval > 0 && time.Since(f.openedAt) >= f.interval
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	return nil
+}
+
+// rotate renames the file to a timestamped backup and opens a new one. When
+// the rename fails the current file is reopened to keep appending to it.
+func (f *rotatingFile) rotate() error {
+	closeErr := f.file.Close()
+	f.file = nil
+
+	ext := filepath.Ext(f.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.path, ext), time.Now().Format(backupTimeFormat), ext)
+	var renameErr error
+	if closeErr == nil {
+		renameErr = os.Rename(f.path, backup)
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close log file: %w", closeErr)
+	}
+	if renameErr != nil {
+		return fmt.Errorf("failed to rename log file: %w", renameErr)
+	}
+
+	f.cleanup()
+	return nil
+}
+
+// cleanup removes rotated files exceeding retention limits, errors are ignored
+// because a failed cleanup must not stop logging
+func (f *rotatingFile) cleanup() {
+	if f.maxBackups <= 0 && f.maxAge <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(f.path)
+	backups, err := filepath.Glob(strings.TrimSuffix(f.path, ext) + "-*" + ext)
+	if err != nil {
+		return
+	}
+
+	// Timestamped names sort chronologically, newest first after reversing
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for i, backup := range backups {
+		expired := false
+		if f.maxBackups > 0 && i >= f.maxBackups {
+			expired = true
+		}
+		if f.maxAge > 0 {
+			if info, err := os.Stat(backup); err == nil && time.Since(info.ModTime()) > f.maxAge {
+				expired = true
+			}
+		}
+		if expired {
+			os.Remove(backup)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestFile opens app.log in a temporary directory, rotating it after
+// maxSize bytes
+func newTestFile(t *testing.T, maxSize int64, config OutputConfig) *rotatingFile {
+	t.Helper()
+
+	config.Path = filepath.Join(t.TempDir(), "app.log")
+	f, err := newRotatingFile(config)
+	if err != nil {
+		t.Fatalf("newRotatingFile: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	f.maxSize = maxSize
+	return f
+}
+
+func backups(t *testing.T, f *rotatingFile) []string {
+	t.Helper()
+
+	names, err := filepath.Glob(strings.TrimSuffix(f.path, ".log") + "-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func write(t *testing.T, f *rotatingFile, line string) {
+	t.Helper()
+
+	if _, err := f.Write([]byte(line)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	// Backups are named by the time in milliseconds
+	time.Sleep(2 * time.Millisecond)
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	f := newTestFile(t, 12, OutputConfig{})
+
+	write(t, f, "first\n")
+	write(t, f, "second\n") // 13 bytes with the first line, rotates
+	write(t, f, "3rd\n")    // fits next to the second line
+
+	names := backups(t, f)
+	if len(names) != 1 {
+		t.Fatalf("backups = %v, want 1", names)
+	}
+	if got := readFile(t, names[0]); got != "first\n" {
+		t.Errorf("backup = %q, want the first line", got)
+	}
+	if got := readFile(t, f.path); got != "second\n3rd\n" {
+		t.Errorf("current file = %q, want the lines after rotation", got)
+	}
+}
+
+func TestRotatingFileKeepsWritingOversizedLines(t *testing.T) {
+	f := newTestFile(t, 4, OutputConfig{})
+
+	// An empty file isn't rotated, whatever the size of the line
+	write(t, f, "a long line\n")
+
+	if names := backups(t, f); len(names) != 0 {
+		t.Errorf("backups = %v, want none", names)
+	}
+	if got := readFile(t, f.path); got != "a long line\n" {
+		t.Errorf("current file = %q, want the line", got)
+	}
+}
+
+func TestRotatingFileRetention(t *testing.T) {
+	t.Run("max backups", func(t *testing.T) {
+		f := newTestFile(t, 5, OutputConfig{MaxBackups: 2})
+
+		for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+			write(t, f, line)
+		}
+
+		names := backups(t, f)
+		if len(names) != 2 {
+			t.Fatalf("backups = %v, want 2", names)
+		}
+		// Names sort chronologically, the newest backups are kept
+		if got := readFile(t, names[0]) + readFile(t, names[1]); got != "three\nfour\n" {
+			t.Errorf("kept backups = %q, want the newest", got)
+		}
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		f := newTestFile(t, 5, OutputConfig{MaxAge: time.Hour})
+
+		old := strings.TrimSuffix(f.path, ".log") + "-20200101T000000.000.log"
+		if err := os.WriteFile(old, []byte("old\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(-2 * time.Hour)
+		if err := os.Chtimes(old, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+
+		write(t, f, "one\n")
+		write(t, f, "two\n")
+
+		names := backups(t, f)
+		if len(names) != 1 || names[0] == old {
+			t.Fatalf("backups = %v, want only the new one", names)
+		}
+		if got := readFile(t, names[0]); got != "one\n" {
+			t.Errorf("backup = %q, want the first line", got)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// syslog facility "user-level messages" (RFC 5424, section 6.2.1)
+const syslogFacilityUser = 1
+
+// syslogWriter prefixes every JSON event with an RFC 5424 header so that the
+// output can be shipped by any syslog-compatible collector
+type syslogWriter struct {
+	out      io.Writer
+	hostname string
+	appName  string
+	pid      int
+}
+
+func newSyslogWriter(out io.Writer, appName string) *syslogWriter {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	if appName == "" {
+		appName = "-"
+	}
+
+	return &syslogWriter{
+		out:      out,
+		hostname: hostname,
+		appName:  appName,
+		pid:      os.Getpid(),
+	}
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w *syslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	priority := syslogFacilityUser*8 + syslogSeverity(level)
+	header := fmt.Sprintf("<%d>1 %s %s %s %d - - ",
+		priority, time.Now().Format(time.RFC3339Nano), w.hostname, w.appName, w.pid)
+
+	// Write header and event at once to keep lines intact under concurrent writes
+	line := append([]byte(header), p...)
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func syslogSeverity(level zerolog.Level) int {
+	switch level {
+	case zerolog.PanicLevel:
+		return 0 // emergency
+	case zerolog.FatalLevel:
+		return 2 // critical
+	case zerolog.ErrorLevel:
+		return 3 // error
+	case zerolog.WarnLevel:
+		return 4 // warning
+	case zerolog.InfoLevel:
+		return 6 // informational
+	default:
+		return 7 // debug
+	}
+}
@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSyslogWriter(t *testing.T) {
+	tests := []struct {
+		level    zerolog.Level
+		priority int
+	}{
+		{zerolog.ErrorLevel, 11},
+		{zerolog.WarnLevel, 12},
+		{zerolog.InfoLevel, 14},
+		{zerolog.DebugLevel, 15},
+		{zerolog.NoLevel, 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newSyslogWriter(&buf, "users")
+			w.hostname = "host"
+
+			event := []byte(`{"level":"x","message":"hello"}` + "\n")
+			n, err := w.WriteLevel(tt.level, event)
+			if err != nil {
+				t.Fatalf("WriteLevel: %v", err)
+			}
+			if n != len(event) {
+				t.Errorf("written = %d, want the event length %d", n, len(event))
+			}
+
+			// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+			header := regexp.MustCompile(fmt.Sprintf(`^<%d>1 (\S+) host users %d - - `, tt.priority, os.Getpid()))
+			m := header.FindStringSubmatch(buf.String())
+			if m == nil {
+				t.Fatalf("line = %q, want an RFC 5424 header with priority %d", buf.String(), tt.priority)
+			}
+			if _, err := time.Parse(time.RFC3339Nano, m[1]); err != nil {
+				t.Errorf("timestamp %q: %v", m[1], err)
+			}
+			if got := buf.String()[len(m[0]):]; got != string(event) {
+				t.Errorf("message = %q, want the event", got)
+			}
+		})
+	}
+}
+
+func TestSyslogWriterDefaults(t *testing.T) {
+	var buf bytes.Buffer
+	w := newSyslogWriter(&buf, "")
+	w.hostname = "host"
+
+	if _, err := w.Write([]byte("{}\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if !regexp.MustCompile(`^<15>1 \S+ host - \d+ - - \{\}\n$`).MatchString(buf.String()) {
+		t.Errorf("line = %q, want the nil APP-NAME and debug priority", buf.String())
+	}
+}
@@ -0,0 +1,204 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the JSON Schema (draft 2020-12) subset used by OpenAPI 3.1
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 TypeSet            `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+}
+
+// TypeSet is a JSON Schema "type", encoded as a string when it has one element
+type TypeSet []string
+
+func (t TypeSet) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *TypeSet) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = TypeSet{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// Has reports whether the set contains typ
+func (t TypeSet) Has(typ string) bool {
+	for _, item := range t {
+		if item == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Ref returns a reference to a component schema
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// ArrayOf returns an array schema of the given items
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: TypeSet{"array"}, Items: items}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf returns the schema for the type of v. Named structs are added to
+// the document components and referenced.
+//
+// Struct fields use their json names; the openapi tag adds constraints as a
+// comma separated list: required, readOnly, minimum=N, maximum=N,
+// minLength=N, maxLength=N, format=F, pattern=P, enum=a|b|c.
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	return d.schemaFor(reflect.TypeOf(v))
+}
+
+func (d *Document) schemaFor(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var s *Schema
+	switch {
+	case t == timeType:
+		s = &Schema{Type: TypeSet{"string"}, Format: "date-time"}
+	case t.Kind() == reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			// Register before building to support recursive types
+			d.Components.Schemas[t.Name()] = &Schema{}
+			*d.Components.Schemas[t.Name()] = *d.structSchema(t)
+		}
+		s = Ref(t.Name())
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			s = &Schema{Type: TypeSet{"string"}, Format: "byte"}
+		} else {
+			s = ArrayOf(d.schemaFor(t.Elem()))
+		}
+	case t.Kind() == reflect.Map:
+		s = &Schema{Type: TypeSet{"object"}, AdditionalProperties: d.schemaFor(t.Elem())}
+	case t.Kind() == reflect.String:
+		s = &Schema{Type: TypeSet{"string"}}
+	case t.Kind() == reflect.Bool:
+		s = &Schema{Type: TypeSet{"boolean"}}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		s = &Schema{Type: TypeSet{"integer"}}
+		if t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64 {
+			s.Format = "int64"
+		} else if t.Kind() == reflect.Int32 || t.Kind() == reflect.Uint32 {
+			s.Format = "int32"
+		}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s = &Schema{Type: TypeSet{"number"}}
+	default:
+		s = &Schema{}
+	}
+
+	if nullable {
+		if s.Ref != "" {
+			// A reference can't be extended with "null" without anyOf, keep it as is
+			return s
+		}
+		s.Type = append(s.Type, "null")
+	}
+	return s
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: TypeSet{"object"}, Properties: make(map[string]*Schema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := d.schemaFor(f.Type)
+		if applyTag(prop, f.Tag.Get("openapi")) {
+			s.Required = append(s.Required, name)
+		}
+		if description := f.Tag.Get("description"); description != "" {
+			prop.Description = description
+		}
+		s.Properties[name] = prop
+	}
+
+	return s
+}
+
+// applyTag applies openapi tag constraints and reports whether the field is required
+func applyTag(s *Schema, tag string) bool {
+	required := false
+	for _, item := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch key {
+		case "required":
+			required = true
+		case "readOnly":
+			s.ReadOnly = true
+		case "minimum":
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				s.Minimum = &n
+			}
+		case "maximum":
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				s.Maximum = &n
+			}
+		case "minLength":
+			if n, err := strconv.Atoi(value); err == nil {
+				s.MinLength = &n
+			}
+		case "maxLength":
+			if n, err := strconv.Atoi(value); err == nil {
+				s.MaxLength = &n
+			}
+		case "format":
+			s.Format = value
+		case "pattern":
+			s.Pattern = value
+		case "enum":
+			for _, option := range strings.Split(value, "|") {
+				s.Enum = append(s.Enum, option)
+			}
+		}
+	}
+	return required
+}
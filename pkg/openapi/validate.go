@@ -0,0 +1,396 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Violation is a single validation failure. Body and response problems are
+// located with a JSON pointer, parameter problems with the parameter name.
+type Violation struct {
+	In      string `json:"in"` // "body", "path", "query", "header" or "response"
+	Name    string `json:"name,omitempty"`
+	Pointer string `json:"pointer,omitempty"`
+	Detail  string `json:"detail"`
+}
+
+var (
+	patternsMu sync.Mutex
+	patterns   = map[string]*regexp.Regexp{}
+)
+
+// Operation returns the documented operation for a method and path template
+func (d *Document) Operation(method, path string) *Operation {
+	item, ok := d.Paths[path]
+	if !ok {
+		return nil
+	}
+	return item.Operation(method)
+}
+
+// ValidateRequest checks parameters, content type and body of a request.
+// It returns the HTTP status to reply with (400, 413 or 415) and the
+// violations, or zero when the request is valid. The body is restored for
+// the handler. Bodies of documented media types other than JSON, like
+// uploads, are left unread for the handler to check; other bodies are read
+// up to maxBodySize bytes.
+func (d *Document) ValidateRequest(op *Operation, r *http.Request, pathParams map[string]string, maxBodySize int64) (int, []Violation) {
+	var violations []Violation
+
+	query := r.URL.Query()
+	for _, param := range op.Parameters {
+		var raw string
+		var present bool
+		switch param.In {
+		case "path":
+			raw, present = pathParams[param.Name]
+		case "query":
+			present = query.Has(param.Name)
+			raw = query.Get(param.Name)
+		case "header":
+			raw = r.Header.Get(param.Name)
+			present = raw != ""
+		}
+
+		if !present {
+			if param.Required {
+				violations = append(violations, Violation{In: param.In, Name: param.Name, Detail: "is required"})
+			}
+			continue
+		}
+
+		value, err := parseParameter(raw, d.resolve(param.Schema))
+		if err != nil {
+			violations = append(violations, Violation{In: param.In, Name: param.Name, Detail: err.Error()})
+			continue
+		}
+		for _, v := range d.validate(param.Schema, value, "", false) {
+			violations = append(violations, Violation{In: param.In, Name: param.Name, Detail: v.Detail})
+		}
+	}
+
+	if op.RequestBody == nil {
+		return statusFor(violations), violations
+	}
+
+	// Undocumented media types are rejected without reading the body
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, mediaErr := mime.ParseMediaType(contentType)
+	documented, content, ok := lookupContent(op.RequestBody.Content, mediaType)
+	if contentType != "" && (mediaErr != nil || !ok) {
+		return http.StatusUnsupportedMediaType, append(violations, unsupportedMediaType(mediaType, op.RequestBody))
+	}
+	if ok && !IsJSON(documented) {
+		return statusFor(violations), violations
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		violations = append(violations, Violation{In: "body", Detail: "failed to read body"})
+		return http.StatusBadRequest, violations
+	}
+	if int64(len(body)) > maxBodySize {
+		violations = append(violations, Violation{In: "body", Detail: fmt.Sprintf("must be at most %d bytes", maxBodySize)})
+		return http.StatusRequestEntityTooLarge, violations
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(body) == 0 {
+		if op.RequestBody.Required {
+			violations = append(violations, Violation{In: "body", Pointer: "", Detail: "is required"})
+		}
+		return statusFor(violations), violations
+	}
+
+	if !ok {
+		return http.StatusUnsupportedMediaType, append(violations, unsupportedMediaType(mediaType, op.RequestBody))
+	}
+
+	value, err := decodeJSON(body)
+	if err != nil {
+		violations = append(violations, Violation{In: "body", Pointer: "", Detail: "invalid JSON: " + err.Error()})
+		return http.StatusBadRequest, violations
+	}
+	violations = append(violations, d.validate(content.Schema, value, "", false)...)
+
+	return statusFor(violations), violations
+}
+
+// ValidateResponse checks that a response status and body match the operation
+func (d *Document) ValidateResponse(op *Operation, status int, header http.Header, body []byte) []Violation {
+	response, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		response, ok = op.Responses["default"]
+	}
+	if !ok {
+		return []Violation{{In: "response", Detail: fmt.Sprintf("undocumented status %d", status)}}
+	}
+
+	if len(response.Content) == 0 {
+		if len(body) > 0 {
+			return []Violation{{In: "response", Detail: fmt.Sprintf("status %d must not have a body", status)}}
+		}
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	documented, content, ok := lookupContent(response.Content, mediaType)
+	if !ok {
+		return []Violation{{
+			In:     "response",
+			Detail: fmt.Sprintf("unexpected content type %q, expected one of %s", mediaType, mediaTypes(response.Content)),
+		}}
+	}
+	if !IsJSON(documented) {
+		return nil
+	}
+
+	value, err := decodeJSON(body)
+	if err != nil {
+		return []Violation{{In: "response", Detail: "invalid JSON: " + err.Error()}}
+	}
+
+	violations := d.validate(content.Schema, value, "", true)
+	for i := range violations {
+		violations[i].In = "response"
+	}
+	return violations
+}
+
+// validate checks a decoded JSON value against a schema. readOnly properties
+// are only required in responses.
+func (d *Document) validate(schema *Schema, value interface{}, pointer string, response bool) []Violation {
+	schema = d.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	fail := func(format string, args ...interface{}) []Violation {
+		return []Violation{{In: "body", Pointer: pointer, Detail: fmt.Sprintf(format, args...)}}
+	}
+
+	if len(schema.Type) > 0 && !matchesType(schema.Type, value) {
+		return fail("must be of type %s", strings.Join(schema.Type, " or "))
+	}
+
+	if len(schema.Enum) > 0 {
+		found := false
+		for _, option := range schema.Enum {
+			if fmt.Sprint(option) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail("must be one of %v", schema.Enum)
+		}
+	}
+
+	var violations []Violation
+	switch v := value.(type) {
+	case json.Number:
+		n, _ := v.Float64()
+		if schema.Minimum != nil && n < *schema.Minimum {
+			violations = append(violations, fail("must be greater than or equal to %v", *schema.Minimum)...)
+		}
+		if schema.Maximum != nil && n > *schema.Maximum {
+			violations = append(violations, fail("must be less than or equal to %v", *schema.Maximum)...)
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			violations = append(violations, fail("must be at least %d characters long", *schema.MinLength)...)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			violations = append(violations, fail("must be at most %d characters long", *schema.MaxLength)...)
+		}
+		if schema.Pattern != "" {
+			if re := compilePattern(schema.Pattern); re != nil && !re.MatchString(v) {
+				violations = append(violations, fail("must match pattern %s", schema.Pattern)...)
+			}
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				violations = append(violations, fail("must be an RFC 3339 date-time")...)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			violations = append(violations, d.validate(schema.Items, item, pointer+"/"+strconv.Itoa(i), response)...)
+		}
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; ok {
+				continue
+			}
+			if prop := d.resolve(schema.Properties[name]); !response && prop != nil && prop.ReadOnly {
+				continue
+			}
+			violations = append(violations, Violation{In: "body", Pointer: pointer + "/" + escapePointer(name), Detail: "is required"})
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := schema.Properties[name]
+			if !ok {
+				prop = schema.AdditionalProperties
+			}
+			violations = append(violations, d.validate(prop, v[name], pointer+"/"+escapePointer(name), response)...)
+		}
+	}
+
+	return violations
+}
+
+// resolve follows component references
+func (d *Document) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+func matchesType(types TypeSet, value interface{}) bool {
+	for _, typ := range types {
+		switch v := value.(type) {
+		case nil:
+			if typ == "null" {
+				return true
+			}
+		case bool:
+			if typ == "boolean" {
+				return true
+			}
+		case string:
+			if typ == "string" {
+				return true
+			}
+		case json.Number:
+			if typ == "number" {
+				return true
+			}
+			if _, err := v.Int64(); typ == "integer" && err == nil {
+				return true
+			}
+		case []interface{}:
+			if typ == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if typ == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseParameter converts a raw parameter into a JSON-like value for validation
+func parseParameter(raw string, schema *Schema) (interface{}, error) {
+	if schema == nil || len(schema.Type) == 0 {
+		return raw, nil
+	}
+
+	switch {
+	case schema.Type.Has("integer"):
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return json.Number(raw), nil
+	case schema.Type.Has("number"):
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return json.Number(raw), nil
+	case schema.Type.Has("boolean"):
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return b, nil
+	}
+	return raw, nil
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return value, nil
+}
+
+func compilePattern(pattern string) *regexp.Regexp {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+
+	re, ok := patterns[pattern]
+	if !ok {
+		re, _ = regexp.Compile(pattern)
+		patterns[pattern] = re
+	}
+	return re
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// lookupContent finds the content documented for a media type, also by a
+// "type/*" or "*/*" range, and returns the documented media type. A missing
+// media type only matches "*/*".
+func lookupContent(content map[string]MediaType, mediaType string) (string, MediaType, bool) {
+	candidates := []string{"*/*"}
+	if typ, _, ok := strings.Cut(mediaType, "/"); ok {
+		candidates = []string{mediaType, typ + "/*", "*/*"}
+	}
+	for _, candidate := range candidates {
+		if c, ok := content[candidate]; ok {
+			return candidate, c, true
+		}
+	}
+	return "", MediaType{}, false
+}
+
+func unsupportedMediaType(mediaType string, body *RequestBody) Violation {
+	return Violation{
+		In:     "header",
+		Name:   "Content-Type",
+		Detail: fmt.Sprintf("unsupported media type %q, expected one of %s", mediaType, mediaTypes(body.Content)),
+	}
+}
+
+func mediaTypes(content map[string]MediaType) string {
+	types := make([]string, 0, len(content))
+	for mediaType := range content {
+		types = append(types, mediaType)
+	}
+	return strings.Join(types, ", ")
+}
+
+func statusFor(violations []Violation) int {
+	if len(violations) > 0 {
+		return http.StatusBadRequest
+	}
+	return 0
+}
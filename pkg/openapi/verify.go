@@ -0,0 +1,110 @@
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// pathVariable matches the variables of mux path templates, like {id} or
+// {id:[0-9]+}
+var pathVariable = regexp.MustCompile(`\{([^{}:]+)(?::[^{}]*)?\}`)
+
+// Verify compares the routes registered on the router with the documented
+// operations and returns an error listing every difference, including path
+// variables without a required path parameter and the other way round.
+// Routes whose path template starts with one of the ignored prefixes are
+// skipped. Response statuses can't be compared, handlers don't declare them.
+func Verify(doc *Document, router *mux.Router, ignore ...string) error {
+	registered := make(map[string]bool)
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Prefixes and routes without methods are not operations
+			return nil
+		}
+		for _, prefix := range ignore {
+			if strings.HasPrefix(template, prefix) {
+				return nil
+			}
+		}
+
+		for _, method := range methods {
+			if method == "OPTIONS" || method == "HEAD" {
+				continue
+			}
+			registered[method+" "+template] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk routes: %w", err)
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for _, method := range item.Methods() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	var problems []string
+	for route := range registered {
+		if !documented[route] {
+			problems = append(problems, "undocumented route "+route)
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			problems = append(problems, "documented operation without route "+route)
+		}
+	}
+	for path, item := range doc.Paths {
+		for _, method := range item.Methods() {
+			problems = append(problems, verifyPathParameters(method, path, item.Operation(method))...)
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("openapi spec is out of sync with routes:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// verifyPathParameters compares the variables of a path template with the
+// path parameters of its operation
+func verifyPathParameters(method, path string, op *Operation) []string {
+	vars := make(map[string]bool)
+	for _, match := range pathVariable.FindAllStringSubmatch(path, -1) {
+		vars[match[1]] = true
+	}
+
+	var problems []string
+	params := make(map[string]bool)
+	for _, param := range op.Parameters {
+		if param.In != "path" {
+			continue
+		}
+		params[param.Name] = true
+		if !vars[param.Name] {
+			problems = append(problems, fmt.Sprintf("path parameter %q not in route %s %s", param.Name, method, path))
+		} else if !param.Required {
+			problems = append(problems, fmt.Sprintf("path parameter %q of %s %s is not required", param.Name, method, path))
+		}
+	}
+	for name := range vars {
+		if !params[name] {
+			problems = append(problems, fmt.Sprintf("undocumented path parameter %q of %s %s", name, method, path))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,86 @@
+package outbox
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/logger"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+	"os"
+	"sync"
+)
+
+// LogPublisher writes every event to the "outbox.events" logger
+type LogPublisher struct {
+	logger zerolog.Logger
+}
+
+func NewLogPublisher() *LogPublisher {
+	return &LogPublisher{logger: logger.GetLogger("outbox.events")}
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, msg domain.OutboxMessage) error {
+	p.logger.Info().
+		Int64("outbox_id", msg.ID).
+		Str("type", string(msg.Type)).
+		Int64("user_id", msg.User.ID).
+		Time("event_time", msg.Time).
+		Msg("User event")
+	return nil
+}
+
+// FilePublisher appends events to a file as JSON lines, synced to disk
+// before the message is marked delivered
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox file: %w", err)
+	}
+	return &FilePublisher{file: file}, nil
+}
+
+func (p *FilePublisher) Publish(ctx context.Context, msg domain.OutboxMessage) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox message: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write outbox file: %w", err)
+	}
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync outbox file: %w", err)
+	}
+	return nil
+}
+
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
+
+// WebhookQueue queues webhook deliveries for an event
+type WebhookQueue interface {
+	Enqueue(ctx context.Context, event domain.UserEvent) error
+}
+
+// WebhookPublisher queues a delivery for every matching webhook subscription
+type WebhookPublisher struct {
+	queue WebhookQueue
+}
+
+func NewWebhookPublisher(queue WebhookQueue) *WebhookPublisher {
+	return &WebhookPublisher{queue: queue}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, msg domain.OutboxMessage) error {
+	return p.queue.Enqueue(ctx, msg.UserEvent)
+}
@@ -0,0 +1,112 @@
+// Package outbox relays user events from the transactional outbox to publishers
+package outbox
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/logger"
+	"fmt"
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// pruneInterval is how often delivered messages past the retention are deleted
+const pruneInterval = time.Hour
+
+// Store is the outbox table
+type Store interface {
+	Deliver(ctx context.Context, limit int, publish func(ctx context.Context, msg domain.OutboxMessage) error) (int, error)
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Publisher hands an event to a downstream system. Messages are delivered
+// at least once, publishers can deduplicate by message ID.
+type Publisher interface {
+	Publish(ctx context.Context, msg domain.OutboxMessage) error
+}
+
+type Config struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// Retention is how long delivered messages are kept, 0 keeps them forever
+	Retention time.Duration
+}
+
+// Relay publishes outbox messages in order and marks them delivered. A
+// message failing to publish is retried on the next poll and holds back the
+// messages after it.
+type Relay struct {
+	store      Store
+	publishers []Publisher
+	config     Config
+	logger     zerolog.Logger
+}
+
+func NewRelay(store Store, publishers []Publisher, config Config) *Relay {
+	return &Relay{
+		store:      store,
+		publishers: publishers,
+		config:     config,
+		logger:     logger.GetLogger("outbox"),
+	}
+}
+
+// Run relays messages until the context is canceled. Full batches are
+// followed immediately by the next one to drain backlogs quickly.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		for ctx.Err() == nil {
+			if r.relay(ctx) < r.config.BatchSize {
+				break
+			}
+		}
+
+		if r.config.Retention > 0 && time.Since(lastPrune) >= pruneInterval {
+			r.prune(ctx)
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) relay(ctx context.Context) int {
+	count, err := r.store.Deliver(ctx, r.config.BatchSize, r.publish)
+	if err != nil && ctx.Err() == nil {
+		r.logger.Error().Err(err).Int("delivered", count).Msg("Failed to relay outbox messages")
+	}
+	if count > 0 {
+		r.logger.Debug().Int("delivered", count).Msg("Outbox messages relayed")
+	}
+	return count
+}
+
+func (r *Relay) publish(ctx context.Context, msg domain.OutboxMessage) error {
+	for _, publisher := range r.publishers {
+		if err := publisher.Publish(ctx, msg); err != nil {
+			return fmt.Errorf("failed to publish outbox message %d: %w", msg.ID, err)
+		}
+	}
+	return nil
+}
+
+func (r *Relay) prune(ctx context.Context) {
+	count, err := r.store.Prune(ctx, time.Now().Add(-r.config.Retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Error().Err(err).Msg("Failed to prune outbox")
+		}
+		return
+	}
+	if count > 0 {
+		r.logger.Info().Int64("deleted", count).Msg("Delivered outbox messages pruned")
+	}
+}
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{in: "100/1m", want: Limit{Requests: 100, Period: time.Minute}},
+		{in: "10/s", want: Limit{Requests: 10, Period: time.Second}},
+		{in: "5/10s", want: Limit{Requests: 5, Period: 10 * time.Second}},
+		{in: " 1/h ", want: Limit{Requests: 1, Period: time.Hour}},
+		{in: "100", wantErr: true},
+		{in: "0/1m", wantErr: true},
+		{in: "-1/1m", wantErr: true},
+		{in: "x/1m", wantErr: true},
+		{in: "10/", wantErr: true},
+		{in: "10/0s", wantErr: true},
+		{in: "10/fortnight", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLimit(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseLimit(%q) = %v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("ParseLimit(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTake(t *testing.T) {
+	limit := Limit{Requests: 2, Period: time.Minute} // a token every 30s
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		wantTokens float64
+		want       Result
+	}{
+		{
+			name:       "full bucket",
+			tokens:     2,
+			wantTokens: 1,
+			want:       Result{Limit: limit, Allowed: true, Remaining: 1, Reset: 30 * time.Second},
+		},
+		{
+			name:       "partly refilled",
+			tokens:     0,
+			elapsed:    15 * time.Second,
+			wantTokens: 0.5,
+			want:       Result{Limit: limit, Remaining: 0, Reset: 45 * time.Second, RetryAfter: 15 * time.Second},
+		},
+		{
+			name:       "refilled token",
+			tokens:     0.5,
+			elapsed:    15 * time.Second,
+			wantTokens: 0,
+			want:       Result{Limit: limit, Allowed: true, Remaining: 0, Reset: time.Minute},
+		},
+		{
+			name:       "refill capped at the burst",
+			tokens:     0,
+			elapsed:    time.Hour,
+			wantTokens: 1,
+			want:       Result{Limit: limit, Allowed: true, Remaining: 1, Reset: 30 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, result := take(tt.tokens, tt.elapsed, limit)
+			if tokens != tt.wantTokens {
+				t.Errorf("tokens = %v, want %v", tokens, tt.wantTokens)
+			}
+			if result != tt.want {
+				t.Errorf("result = %+v, want %+v", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreBurst(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(0)
+	limit := Limit{Requests: 3, Period: time.Hour}
+
+	for i := 0; i < limit.Requests; i++ {
+		result, err := store.Take(ctx, "a", limit)
+		if err != nil || !result.Allowed || result.Remaining != limit.Requests-1-i {
+			t.Fatalf("take %d = %+v, %v; want allowed with %d remaining", i+1, result, err, limit.Requests-1-i)
+		}
+	}
+
+	result, err := store.Take(ctx, "a", limit)
+	if err != nil || result.Allowed {
+		t.Fatalf("take over the burst = %+v, %v; want denied", result, err)
+	}
+	if result.RetryAfter <= 19*time.Minute || result.RetryAfter > 20*time.Minute {
+		t.Errorf("retry after = %s, want about 20m for the next token", result.RetryAfter)
+	}
+
+	if result, _ := store.Take(ctx, "b", limit); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("take of another key = %+v, want its own full bucket", result)
+	}
+}
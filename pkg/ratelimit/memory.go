@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets in process memory, suitable for a single instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	stop    chan struct{}
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	idleAfter time.Time
+}
+
+// NewMemoryStore creates a store that drops full buckets every cleanupInterval
+func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+	s := &MemoryStore{
+		buckets: make(map[string]*bucket),
+		stop:    make(chan struct{}),
+	}
+
+	if cleanupInterval > 0 {
+		go s.cleanupLoop(cleanupInterval)
+	}
+
+	return s
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), updatedAt: now}
+		s.buckets[key] = b
+	}
+
+	tokens, result := take(b.tokens, now.Sub(b.updatedAt), limit)
+	b.tokens = tokens
+	b.updatedAt = now
+	b.idleAfter = now.Add(result.Reset)
+
+	return result, nil
+}
+
+// Close stops the cleanup goroutine
+func (s *MemoryStore) Close() {
+	close(s.stop)
+}
+
+// cleanupLoop removes buckets that have refilled completely, since a new
+// bucket for the same key would be identical
+func (s *MemoryStore) cleanupLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, b := range s.buckets {
+				if now.After(b.idleAfter) {
+					delete(s.buckets, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
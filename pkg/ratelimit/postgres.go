@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"crud-without-db/migrations"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PostgresStore keeps buckets in a table shared by all application instances.
+// Each Take locks the bucket row, so concurrent requests for the same key
+// are serialized by the database.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to begin rate limit transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+		VALUES ($1, $2, now())
+		ON CONFLICT (key) DO NOTHING`, key, float64(limit.Requests))
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create rate limit bucket: %w", err)
+	}
+
+	// Elapsed time is computed by the database to avoid clock skew between instances
+	var tokens, elapsed float64
+	err = tx.QueryRowContext(ctx, `
+		SELECT tokens, GREATEST(EXTRACT(EPOCH FROM now() - updated_at), 0)
+		FROM rate_limit_buckets
+		WHERE key = $1
+		FOR UPDATE`, key).Scan(&tokens, &elapsed)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to get rate limit bucket: %w", err)
+	}
+
+	tokens, result := take(tokens, secondsToDuration(elapsed), limit)
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE rate_limit_buckets
+		SET tokens = $2, updated_at = now(), expires_at = now() + $3 * INTERVAL '1 second'
+		WHERE key = $1`, key, tokens, result.Reset.Seconds())
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to update rate limit bucket: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Result{}, fmt.Errorf("failed to commit rate limit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+// Cleanup removes buckets that have refilled completely
+func (s *PostgresStore) Cleanup(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE expires_at < now()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clean up rate limit buckets: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// RunCleanup calls Cleanup every interval until ctx is done
+func (s *PostgresStore) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Cleanup(ctx)
+		}
+	}
+}
+
+// InitSchema creates the rate_limit_buckets table if it doesn't exist, using
+// its migration
+func (s *PostgresStore) InitSchema() error {
+	query, err := migrations.FS.ReadFile("002_create_rate_limit_buckets_table.sql")
+	if err != nil {
+		return fmt.Errorf("failed to read rate_limit_buckets migration: %w", err)
+	}
+
+	if _, err := s.db.Exec(string(query)); err != nil {
+		return fmt.Errorf("failed to create rate_limit_buckets table: %w", err)
+	}
+
+	return nil
+}
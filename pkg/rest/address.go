@@ -0,0 +1,321 @@
+package rest
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/logger"
+	"crud-without-db/pkg/openapi"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+type Addresses interface {
+	List(ctx context.Context, userID int64) ([]domain.Address, error)
+	Get(ctx context.Context, userID, id int64) (domain.Address, error)
+	Create(ctx context.Context, userID int64, address domain.Address) (domain.Address, error)
+	Update(ctx context.Context, userID, id int64, address domain.Address) (domain.Address, error)
+	Delete(ctx context.Context, userID, id int64) error
+}
+
+// AddressHandler serves the postal addresses of users
+type AddressHandler struct {
+	addresses Addresses
+	logger    zerolog.Logger
+}
+
+func NewAddressHandler(addresses Addresses) *AddressHandler {
+	return &AddressHandler{
+		addresses: addresses,
+		logger:    logger.GetLogger("addresses"),
+	}
+}
+
+// InitRoutes registers the address routes and documents them
+func (h *AddressHandler) InitRoutes(r *mux.Router, doc *openapi.Document) {
+	doc.Tags = append(doc.Tags, openapi.Tag{Name: "addresses", Description: "Postal addresses of users"})
+
+	for _, route := range h.routes() {
+		r.HandleFunc(route.path, route.handler).Methods(route.method)
+		doc.AddOperation(route.method, route.path, route.op(doc))
+	}
+}
+
+func (h *AddressHandler) routes() []route {
+	addressIDParameter := openapi.Parameter{
+		Name:        "address_id",
+		In:          "path",
+		Description: "Address ID",
+		Required:    true,
+		Schema:      &openapi.Schema{Type: openapi.TypeSet{"integer"}, Format: "int64", Minimum: float64Ptr(1)},
+	}
+
+	return []route{
+		{
+			method:  http.MethodGet,
+			path:    "/users/{id}/addresses",
+			handler: h.listAddresses,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "listAddresses",
+					Summary:     "List the addresses of a user",
+					Tags:        []string{"addresses"},
+					Parameters:  []openapi.Parameter{userIDParameter},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(openapi.ArrayOf(doc.SchemaOf(domain.Address{})))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodPost,
+			path:    "/users/{id}/addresses",
+			handler: h.createAddress,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "createAddress",
+					Summary:     "Add an address to a user",
+					Description: "The first address of a user becomes the default.",
+					Tags:        []string{"addresses"},
+					Parameters:  []openapi.Parameter{userIDParameter},
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content:  openapi.JSONContent(doc.SchemaOf(domain.Address{})),
+					},
+					Responses: map[string]*openapi.Response{
+						"201": {Description: "Created", Content: openapi.JSONContent(doc.SchemaOf(domain.Address{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/users/{id}/addresses/{address_id}",
+			handler: h.getAddress,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "getAddress",
+					Summary:     "Get an address of a user",
+					Tags:        []string{"addresses"},
+					Parameters:  []openapi.Parameter{userIDParameter, addressIDParameter},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.Address{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodPut,
+			path:    "/users/{id}/addresses/{address_id}",
+			handler: h.updateAddress,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "updateAddress",
+					Summary:     "Update an address of a user",
+					Description: "Replaces the address. The default address stays the default until another " +
+						"address is made the default.",
+					Tags:       []string{"addresses"},
+					Parameters: []openapi.Parameter{userIDParameter, addressIDParameter},
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content:  openapi.JSONContent(doc.SchemaOf(domain.Address{})),
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.Address{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodDelete,
+			path:    "/users/{id}/addresses/{address_id}",
+			handler: h.deleteAddress,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "deleteAddress",
+					Summary:     "Delete an address of a user",
+					Description: "Deleting the default address makes the oldest remaining address the default.",
+					Tags:        []string{"addresses"},
+					Parameters:  []openapi.Parameter{userIDParameter, addressIDParameter},
+					Responses: map[string]*openapi.Response{
+						"204": {Description: "No Content"},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+	}
+}
+
+func (h *AddressHandler) listAddresses(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	addresses, err := h.addresses.List(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, err, "listAddresses")
+		return
+	}
+
+	if addresses == nil {
+		addresses = []domain.Address{}
+	}
+	h.writeJSON(w, http.StatusOK, addresses)
+}
+
+func (h *AddressHandler) createAddress(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	address, ok := h.readAddress(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := h.addresses.Create(r.Context(), userID, address)
+	if err != nil {
+		h.writeError(w, err, "createAddress")
+		return
+	}
+
+	h.logger.Info().Int64("user_id", userID).Int64("address_id", created.ID).Msg("Address created")
+	w.Header().Set("Location", "/users/"+strconv.FormatInt(userID, 10)+"/addresses/"+strconv.FormatInt(created.ID, 10))
+	h.writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *AddressHandler) getAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := addressIDs(w, r)
+	if !ok {
+		return
+	}
+
+	address, err := h.addresses.Get(r.Context(), userID, id)
+	if err != nil {
+		h.writeError(w, err, "getAddress")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, address)
+}
+
+func (h *AddressHandler) updateAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := addressIDs(w, r)
+	if !ok {
+		return
+	}
+
+	address, ok := h.readAddress(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := h.addresses.Update(r.Context(), userID, id, address)
+	if err != nil {
+		h.writeError(w, err, "updateAddress")
+		return
+	}
+
+	h.logger.Info().Int64("user_id", userID).Int64("address_id", id).Msg("Address updated")
+	h.writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *AddressHandler) deleteAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := addressIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.addresses.Delete(r.Context(), userID, id); err != nil {
+		h.writeError(w, err, "deleteAddress")
+		return
+	}
+
+	h.logger.Info().Int64("user_id", userID).Int64("address_id", id).Msg("Address deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addressIDs returns the user and address IDs of an address route,
+// responding 400 when one is invalid
+func addressIDs(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	userID, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+	id, err := pathID(r, "address_id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return userID, id, true
+}
+
+func (h *AddressHandler) readAddress(w http.ResponseWriter, r *http.Request) (domain.Address, bool) {
+	var address domain.Address
+
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to read request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return address, false
+	}
+
+	if err = json.Unmarshal(reqBytes, &address); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to unmarshal address")
+		w.WriteHeader(http.StatusBadRequest)
+		return address, false
+	}
+
+	return address, true
+}
+
+func (h *AddressHandler) writeError(w http.ResponseWriter, err error, method string) {
+	var validationErr *domain.ValidationError
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound), errors.Is(err, domain.ErrAddressNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.As(err, &validationErr):
+		h.logger.Warn().Err(err).Str("method", method).Msg("Invalid address")
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		h.logger.Error().Err(err).Str("method", method).Msg("Address request failed")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (h *AddressHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal address response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
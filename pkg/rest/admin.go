@@ -0,0 +1,142 @@
+package rest
+
+import (
+	"crud-without-db/pkg/logger"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"io"
+	"net/http"
+	"time"
+)
+
+// AdminHandler serves operational endpoints protected by a static bearer token
+type AdminHandler struct {
+	token  string
+	stats  map[string]func() interface{}
+	logger zerolog.Logger
+}
+
+type logLevelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+	TTL       string `json:"ttl"`
+}
+
+func NewAdminHandler(token string) *AdminHandler {
+	return &AdminHandler{
+		token:  token,
+		stats:  make(map[string]func() interface{}),
+		logger: logger.GetLogger("admin"),
+	}
+}
+
+// AddStats exposes statistics under name on GET /admin/stats, it must be
+// called before the server starts
+func (h *AdminHandler) AddStats(name string, stats func() interface{}) {
+	h.stats[name] = stats
+}
+
+// InitRoutes registers admin routes on the given router.
+// Nothing is registered when no token is configured.
+func (h *AdminHandler) InitRoutes(r *mux.Router) {
+	if h.token == "" {
+		h.logger.Warn().Msg("Admin token is not set, admin endpoints are disabled")
+		return
+	}
+
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(BearerAuth(h.token))
+	{
+		admin.HandleFunc("/log-level", h.getLogLevels).Methods("GET")
+		admin.HandleFunc("/log-level", h.setLogLevel).Methods("PUT")
+		admin.HandleFunc("/log-level", h.resetLogLevel).Methods("DELETE")
+	}
+}
+
+func (h *AdminHandler) getLogLevels(w http.ResponseWriter, r *http.Request) {
+	h.writeLevels(w)
+}
+
+func (h *AdminHandler) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.logger.Error().Err(err).Str("method", "setLogLevel").Msg("Failed to read request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var inp logLevelRequest
+	if err = json.Unmarshal(reqBytes, &inp); err != nil {
+		h.logger.Error().Err(err).Str("method", "setLogLevel").Msg("Failed to unmarshal log level request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	level, err := zerolog.ParseLevel(inp.Level)
+	if err != nil || inp.Level == "" {
+		h.logger.Warn().Str("level", inp.Level).Msg("Invalid log level")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if inp.TTL != "" {
+		ttl, err = time.ParseDuration(inp.TTL)
+		if err != nil || ttl < 0 {
+			h.logger.Warn().Str("ttl", inp.TTL).Msg("Invalid log level ttl")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	logger.SetLevel(inp.Component, level, ttl)
+
+	h.logger.Info().
+		Str("target", inp.Component).
+		Str("level", level.String()).
+		Dur("ttl", ttl).
+		Msg("Log level changed")
+	h.writeLevels(w)
+}
+
+func (h *AdminHandler) resetLogLevel(w http.ResponseWriter, r *http.Request) {
+	component := r.URL.Query().Get("component")
+
+	if !logger.ResetLevel(component) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	h.logger.Info().Str("target", component).Msg("Log level override removed")
+	h.writeLevels(w)
+}
+
+func (h *AdminHandler) getStats(w http.ResponseWriter, r *http.Request) {
+	stats := make(map[string]interface{}, len(h.stats))
+	for name, get := range h.stats {
+		stats[name] = get()
+	}
+
+	response, err := json.Marshal(stats)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal stats response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func (h *AdminHandler) writeLevels(w http.ResponseWriter) {
+	response, err := json.Marshal(logger.Levels())
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal log levels response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
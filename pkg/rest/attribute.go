@@ -0,0 +1,251 @@
+package rest
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/logger"
+	"crud-without-db/pkg/openapi"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"io"
+	"net/http"
+)
+
+type Attributes interface {
+	List(ctx context.Context) ([]domain.AttributeDefinition, error)
+	Get(ctx context.Context, name string) (domain.AttributeDefinition, error)
+	Put(ctx context.Context, definition domain.AttributeDefinition) (domain.AttributeDefinition, bool, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// AttributeHandler manages the registry of custom user attributes.
+// Definitions change what every user may hold, so the routes require the
+// admin token.
+type AttributeHandler struct {
+	token      string
+	attributes Attributes
+	logger     zerolog.Logger
+}
+
+func NewAttributeHandler(token string, attributes Attributes) *AttributeHandler {
+	return &AttributeHandler{
+		token:      token,
+		attributes: attributes,
+		logger:     logger.GetLogger("attributes"),
+	}
+}
+
+// InitRoutes registers the attribute routes and documents them. Nothing is
+// registered when no token is configured.
+func (h *AttributeHandler) InitRoutes(r *mux.Router, doc *openapi.Document) {
+	if h.token == "" {
+		h.logger.Warn().Msg("Admin token is not set, attribute endpoints are disabled")
+		return
+	}
+
+	attributes := r.PathPrefix("/attributes").Subrouter()
+	attributes.Use(BearerAuth(h.token))
+
+	addAdminTokenScheme(doc)
+	doc.Tags = append(doc.Tags, openapi.Tag{Name: "attributes", Description: "Custom user attributes and their validation rules"})
+
+	for _, route := range h.routes() {
+		attributes.HandleFunc(route.path, route.handler).Methods(route.method)
+		op := route.op(doc)
+		op.Security = []openapi.SecurityRequirement{{AdminTokenScheme: {}}}
+		op.Responses["401"] = &openapi.Response{Description: "Unauthorized"}
+		doc.AddOperation(route.method, "/attributes"+route.path, op)
+	}
+}
+
+func (h *AttributeHandler) routes() []route {
+	nameParameter := openapi.Parameter{
+		Name:        "name",
+		In:          "path",
+		Description: "Attribute name",
+		Required:    true,
+		Schema:      &openapi.Schema{Type: openapi.TypeSet{"string"}, Pattern: `^[a-z][a-z0-9_]{0,62}$`},
+	}
+
+	return []route{
+		{
+			method:  http.MethodGet,
+			path:    "",
+			handler: h.listAttributes,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "listAttributes",
+					Summary:     "List custom user attributes",
+					Tags:        []string{"attributes"},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(openapi.ArrayOf(doc.SchemaOf(domain.AttributeDefinition{})))},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/{name}",
+			handler: h.getAttribute,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "getAttribute",
+					Summary:     "Get a custom user attribute",
+					Tags:        []string{"attributes"},
+					Parameters:  []openapi.Parameter{nameParameter},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.AttributeDefinition{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodPut,
+			path:    "/{name}",
+			handler: h.putAttribute,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "putAttribute",
+					Summary:     "Define a custom user attribute",
+					Description: "Creates the attribute or replaces its definition. Users are validated " +
+						"against the definitions when they are created or updated, so existing values " +
+						"that break new rules are reported on the next update.",
+					Tags:       []string{"attributes"},
+					Parameters: []openapi.Parameter{nameParameter},
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content:  openapi.JSONContent(doc.SchemaOf(domain.AttributeDefinition{})),
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.AttributeDefinition{}))},
+						"201": {Description: "Created", Content: openapi.JSONContent(doc.SchemaOf(domain.AttributeDefinition{}))},
+						"400": {Description: "Bad Request"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodDelete,
+			path:    "/{name}",
+			handler: h.deleteAttribute,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "deleteAttribute",
+					Summary:     "Delete a custom user attribute",
+					Description: "Only attributes no user has a value for can be deleted.",
+					Tags:        []string{"attributes"},
+					Parameters:  []openapi.Parameter{nameParameter},
+					Responses: map[string]*openapi.Response{
+						"204": {Description: "No Content"},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"409": {Description: "Conflict, users have a value for the attribute"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+	}
+}
+
+func (h *AttributeHandler) listAttributes(w http.ResponseWriter, r *http.Request) {
+	definitions, err := h.attributes.List(r.Context())
+	if err != nil {
+		h.logger.Error().Err(err).Str("method", "listAttributes").Msg("Failed to list attributes")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if definitions == nil {
+		definitions = []domain.AttributeDefinition{}
+	}
+	h.writeJSON(w, http.StatusOK, definitions)
+}
+
+func (h *AttributeHandler) getAttribute(w http.ResponseWriter, r *http.Request) {
+	definition, err := h.attributes.Get(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		h.writeError(w, err, "getAttribute")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, definition)
+}
+
+func (h *AttributeHandler) putAttribute(w http.ResponseWriter, r *http.Request) {
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to read request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var definition domain.AttributeDefinition
+	if err = json.Unmarshal(reqBytes, &definition); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to unmarshal attribute definition")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	definition.Name = mux.Vars(r)["name"]
+
+	definition, created, err := h.attributes.Put(r.Context(), definition)
+	if err != nil {
+		h.writeError(w, err, "putAttribute")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	h.logger.Info().Str("attribute", definition.Name).Bool("created", created).Msg("Attribute defined")
+	h.writeJSON(w, status, definition)
+}
+
+func (h *AttributeHandler) deleteAttribute(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := h.attributes.Delete(r.Context(), name); err != nil {
+		h.writeError(w, err, "deleteAttribute")
+		return
+	}
+
+	h.logger.Info().Str("attribute", name).Msg("Attribute deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AttributeHandler) writeError(w http.ResponseWriter, err error, method string) {
+	var validationErr *domain.ValidationError
+	switch {
+	case errors.Is(err, domain.ErrAttributeNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, domain.ErrAttributeInUse):
+		h.logger.Warn().Err(err).Str("method", method).Msg("Attribute is in use")
+		w.WriteHeader(http.StatusConflict)
+	case errors.As(err, &validationErr):
+		h.logger.Warn().Err(err).Str("method", method).Msg("Invalid attribute definition")
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		h.logger.Error().Err(err).Str("method", method).Msg("Attribute request failed")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (h *AttributeHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal attribute response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
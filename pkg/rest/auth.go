@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"crud-without-db/pkg/logger"
+	"crud-without-db/pkg/openapi"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// AdminTokenScheme is the security scheme of routes behind BearerAuth with
+// the admin token
+const AdminTokenScheme = "adminToken"
+
+// bearerProtocolPrefix carries the token in Sec-WebSocket-Protocol, as
+// browsers can't set an Authorization header on WebSocket handshakes
+const bearerProtocolPrefix = "bearer."
+
+// BearerAuth rejects requests without a matching "Authorization: Bearer <token>"
+// header. WebSocket handshakes may offer the token as a "bearer.<token>"
+// subprotocol instead.
+func BearerAuth(token string) func(http.Handler) http.Handler {
+	authLogger := logger.GetLogger("auth")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(requestToken(r)), []byte(token)) != 1 {
+				authLogger.Warn().Str("remote_addr", r.RemoteAddr).Str("uri", r.RequestURI).Msg("Unauthorized request")
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// addAdminTokenScheme documents AdminTokenScheme
+func addAdminTokenScheme(doc *openapi.Document) {
+	if doc.Components.SecuritySchemes == nil {
+		doc.Components.SecuritySchemes = make(map[string]*openapi.SecurityScheme)
+	}
+	doc.Components.SecuritySchemes[AdminTokenScheme] = &openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "Admin token from the admin.token setting",
+	}
+}
+
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+			for _, protocol := range strings.Split(header, ",") {
+				if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), bearerProtocolPrefix); ok {
+					return token
+				}
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,310 @@
+package rest
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/blob"
+	"crud-without-db/pkg/logger"
+	"crud-without-db/pkg/openapi"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// avatarFormField is the multipart field holding the image
+	avatarFormField = "avatar"
+	// multipartOverhead is allowed on top of the image size for the
+	// boundaries and part headers of multipart uploads
+	multipartOverhead = 64 << 10
+)
+
+type Avatars interface {
+	MaxSize() int64
+	Put(ctx context.Context, userID int64, r io.Reader) (domain.Avatar, error)
+	// Open returns the object of a variant and the version of the upload
+	Open(ctx context.Context, userID int64, variant domain.AvatarVariant) (*blob.Object, string, error)
+	Delete(ctx context.Context, userID int64) error
+}
+
+// AvatarHandler uploads and serves the profile pictures of users
+type AvatarHandler struct {
+	avatars Avatars
+	maxAge  time.Duration
+	logger  zerolog.Logger
+}
+
+// NewAvatarHandler creates the handler, maxAge is how long clients and
+// proxies may cache avatars without revalidating
+func NewAvatarHandler(avatars Avatars, maxAge time.Duration) *AvatarHandler {
+	return &AvatarHandler{
+		avatars: avatars,
+		maxAge:  maxAge,
+		logger:  logger.GetLogger("avatars"),
+	}
+}
+
+// InitRoutes registers the avatar routes and documents them
+func (h *AvatarHandler) InitRoutes(r *mux.Router, doc *openapi.Document) {
+	doc.Tags = append(doc.Tags, openapi.Tag{Name: "avatars", Description: "Profile pictures of users"})
+
+	for _, route := range h.routes() {
+		r.HandleFunc(route.path, route.handler).Methods(route.method)
+		doc.AddOperation(route.method, route.path, route.op(doc))
+	}
+}
+
+func (h *AvatarHandler) routes() []route {
+	imageContent := openapi.BinaryContent(domain.AvatarFormats...)
+
+	return []route{
+		{
+			method:  http.MethodPut,
+			path:    "/users/{id}/avatar",
+			handler: h.putAvatar,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				// Any Content-Type is accepted for raw uploads, the format is
+				// detected from the content
+				uploadContent := openapi.BinaryContent(append([]string{"*/*", "application/octet-stream"}, domain.AvatarFormats...)...)
+				uploadContent["multipart/form-data"] = openapi.MediaType{Schema: &openapi.Schema{
+					Type:     openapi.TypeSet{"object"},
+					Required: []string{avatarFormField},
+					Properties: map[string]*openapi.Schema{
+						avatarFormField: {Type: openapi.TypeSet{"string"}, Format: "binary"},
+					},
+				}}
+
+				return &openapi.Operation{
+					OperationID: "putAvatar",
+					Summary:     "Upload the avatar of a user",
+					Description: fmt.Sprintf("Replaces the avatar with an image sent as the body, with any Content-Type, "+
+						"or as the %q field of a multipart form. The format is detected from the content and must be "+
+						"PNG, JPEG, GIF or WebP; a square thumbnail is generated.", avatarFormField),
+					Tags:       []string{"avatars"},
+					Parameters: []openapi.Parameter{userIDParameter},
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content:  uploadContent,
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.Avatar{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"413": {Description: "Payload Too Large"},
+						"415": {Description: "Unsupported Media Type"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/users/{id}/avatar",
+			handler: h.getAvatar,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "getAvatar",
+					Summary:     "Get the avatar of a user",
+					Description: "Serves the image with ETag and Last-Modified for revalidation and supports " +
+						"range requests.",
+					Tags: []string{"avatars"},
+					Parameters: []openapi.Parameter{
+						userIDParameter,
+						{
+							Name:        "size",
+							In:          "query",
+							Description: "original as uploaded or a square PNG thumbnail",
+							Schema: &openapi.Schema{
+								Type: openapi.TypeSet{"string"},
+								Enum: []interface{}{string(domain.AvatarOriginal), string(domain.AvatarThumbnail)},
+							},
+						},
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: imageContent},
+						"206": {Description: "Partial Content", Content: imageContent},
+						"304": {Description: "Not Modified"},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"412": {Description: "Precondition Failed"},
+						"416": {
+							Description: "Range Not Satisfiable",
+							Content:     map[string]openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: openapi.TypeSet{"string"}}}},
+						},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodDelete,
+			path:    "/users/{id}/avatar",
+			handler: h.deleteAvatar,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "deleteAvatar",
+					Summary:     "Delete the avatar of a user",
+					Tags:        []string{"avatars"},
+					Parameters:  []openapi.Parameter{userIDParameter},
+					Responses: map[string]*openapi.Response{
+						"204": {Description: "No Content"},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+	}
+}
+
+func (h *AvatarHandler) putAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.avatars.MaxSize()+multipartOverhead)
+	image, ok := h.readImage(w, r)
+	if !ok {
+		return
+	}
+
+	avatar, err := h.avatars.Put(r.Context(), userID, image)
+	if err != nil {
+		h.writeError(w, err, "putAvatar")
+		return
+	}
+
+	h.logger.Info().
+		Int64("user_id", userID).
+		Str("content_type", avatar.ContentType).
+		Int64("size", avatar.Size).
+		Msg("Avatar uploaded")
+	h.writeJSON(w, http.StatusOK, avatar)
+}
+
+func (h *AvatarHandler) getAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	variant := domain.AvatarOriginal
+	switch size := r.URL.Query().Get("size"); size {
+	case "", string(domain.AvatarOriginal):
+	case string(domain.AvatarThumbnail):
+		variant = domain.AvatarThumbnail
+	default:
+		h.logger.Debug().Str("size", size).Msg("Unknown avatar size")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	object, version, err := h.avatars.Open(r.Context(), userID, variant)
+	if err != nil {
+		h.writeError(w, err, "getAvatar")
+		return
+	}
+	defer object.Close()
+
+	// ServeContent answers conditional and range requests using these
+	// headers and sniffs the Content-Type from the content
+	w.Header().Set("ETag", `"`+version+"-"+string(variant)+`"`)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(h.maxAge.Seconds())))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", object.ModTime, object)
+}
+
+func (h *AvatarHandler) deleteAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.avatars.Delete(r.Context(), userID); err != nil {
+		h.writeError(w, err, "deleteAvatar")
+		return
+	}
+
+	h.logger.Info().Int64("user_id", userID).Msg("Avatar deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readImage returns the image of an upload: the avatar field of a
+// multipart form or else the body itself. It responds 400 when a form has
+// no avatar field.
+func (h *AvatarHandler) readImage(w http.ResponseWriter, r *http.Request) (io.Reader, bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, true
+	}
+
+	form, err := r.MultipartReader()
+	if err != nil {
+		h.logger.Warn().Err(err).Msg("Failed to read multipart form")
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	for {
+		part, err := form.NextPart()
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.logger.Warn().Err(err).Msg("Avatar too large")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		if err != nil {
+			h.logger.Warn().Err(err).Str("field", avatarFormField).Msg("Multipart form without the avatar field")
+			w.WriteHeader(http.StatusBadRequest)
+			return nil, false
+		}
+		if part.FormName() == avatarFormField {
+			return part, true
+		}
+	}
+}
+
+func (h *AvatarHandler) writeError(w http.ResponseWriter, err error, method string) {
+	var validationErr *domain.ValidationError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound), errors.Is(err, domain.ErrAvatarNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, domain.ErrAvatarTooLarge), errors.As(err, &maxBytesErr):
+		h.logger.Warn().Err(err).Str("method", method).Msg("Avatar too large")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	case errors.Is(err, domain.ErrAvatarUnsupported):
+		h.logger.Warn().Err(err).Str("method", method).Msg("Unsupported avatar format")
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+	case errors.As(err, &validationErr):
+		h.logger.Warn().Err(err).Str("method", method).Msg("Invalid avatar")
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		h.logger.Error().Err(err).Str("method", method).Msg("Avatar request failed")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (h *AvatarHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal avatar response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
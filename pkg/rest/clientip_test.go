@@ -0,0 +1,56 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := NewTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("NewTrustedProxies: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{name: "direct client", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "untrusted peer can't forward", remote: "203.0.113.7:5000", forwarded: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted proxy", remote: "10.1.2.3:5000", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "chain of trusted proxies", remote: "10.1.2.3:5000", forwarded: []string{"198.51.100.1, 192.0.2.1, 10.9.9.9"}, want: "198.51.100.1"},
+		{name: "spoofed left-most entries", remote: "10.1.2.3:5000", forwarded: []string{"1.1.1.1, 8.8.8.8, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "spoofed trusted entry before client", remote: "10.1.2.3:5000", forwarded: []string{"10.0.0.1, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "several headers", remote: "10.1.2.3:5000", forwarded: []string{"1.1.1.1", "198.51.100.1, 10.0.0.2"}, want: "198.51.100.1"},
+		{name: "garbage entry is the client", remote: "10.1.2.3:5000", forwarded: []string{"198.51.100.1, unknown"}, want: "unknown"},
+		{name: "empty entries skipped", remote: "10.1.2.3:5000", forwarded: []string{"198.51.100.1, , "}, want: "198.51.100.1"},
+		{name: "only trusted hops", remote: "10.1.2.3:5000", forwarded: []string{"10.0.0.1, 10.0.0.2"}, want: "10.0.0.1"},
+		{name: "trusted proxy without header", remote: "10.1.2.3:5000", want: "10.1.2.3"},
+		{name: "IPv6 proxy", remote: "[2001:db8::1]:5000", forwarded: []string{"2001:db9::5"}, want: "2001:db9::5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := proxies.ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTrustedProxiesRejectsInvalid(t *testing.T) {
+	for _, proxy := range []string{"proxy.local", "10.0.0.0/33", "10.0.0"} {
+		if _, err := NewTrustedProxies([]string{proxy}); err == nil {
+			t.Errorf("NewTrustedProxies(%q) succeeded, want an error", proxy)
+		}
+	}
+}
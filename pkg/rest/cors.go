@@ -0,0 +1,248 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig is the cross-origin policy applied by CORS.
+//
+// Origins are either "*", exact origins ("https://app.example.com") or
+// wildcard subdomain patterns ("https://*.example.com", which does not match
+// the apex domain). "*" can't be combined with AllowCredentials.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+
+	// Routes overrides allowed origins per mux path template, e.g. "/users/{id}"
+	Routes map[string][]string
+}
+
+// CORS handles preflight requests and adds CORS headers to responses.
+// It wraps the whole router so preflights are answered before routing.
+type CORS struct {
+	config  CORSConfig
+	router  *mux.Router
+	origins originMatcher
+	routes  map[string]originMatcher
+	methods map[string]bool
+	headers map[string]bool
+}
+
+func NewCORS(config CORSConfig, router *mux.Router) (*CORS, error) {
+	origins, err := newOriginMatcher(config.AllowedOrigins, config.AllowCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &CORS{
+		config:  config,
+		router:  router,
+		origins: origins,
+		routes:  make(map[string]originMatcher, len(config.Routes)),
+		methods: make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+
+	for route, routeOrigins := range config.Routes {
+		matcher, err := newOriginMatcher(routeOrigins, config.AllowCredentials)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route, err)
+		}
+		c.routes[route] = matcher
+	}
+	for _, method := range config.AllowedMethods {
+		c.methods[strings.ToUpper(method)] = true
+	}
+	for _, header := range config.AllowedHeaders {
+		c.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return c, nil
+}
+
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Responses differ per origin, caches must not mix them up
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		matcher := c.matcher(r)
+		if !matcher.allowed(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if preflight {
+			c.handlePreflight(w, r, matcher, origin)
+			return
+		}
+
+		c.setAllowOrigin(w, matcher, origin)
+		if len(c.config.ExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.config.ExposedHeaders, ", "))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *CORS) handlePreflight(w http.ResponseWriter, r *http.Request, matcher originMatcher, origin string) {
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !c.methods[method] {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var requested []string
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.TrimSpace(header); header == "" {
+				continue
+			}
+			if !c.headers[http.CanonicalHeaderKey(header)] && !(c.headers["*"] && !c.config.AllowCredentials) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			requested = append(requested, header)
+		}
+	}
+
+	c.setAllowOrigin(w, matcher, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.config.AllowedMethods, ", "))
+	if len(requested) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if c.config.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.config.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *CORS) setAllowOrigin(w http.ResponseWriter, matcher originMatcher, origin string) {
+	if matcher.any && !c.config.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.config.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// matcher returns the origin policy of the route targeted by the request;
+// preflights are matched using the method they ask for
+func (c *CORS) matcher(r *http.Request) originMatcher {
+	if len(c.routes) == 0 || c.router == nil {
+		return c.origins
+	}
+
+	target := r
+	if method := r.Header.Get("Access-Control-Request-Method"); r.Method == http.MethodOptions && method != "" {
+		target = r.Clone(r.Context())
+		target.Method = strings.ToUpper(method)
+	}
+
+	var match mux.RouteMatch
+	if c.router.Match(target, &match) && match.Route != nil {
+		if template, err := match.Route.GetPathTemplate(); err == nil {
+			if matcher, ok := c.routes[template]; ok {
+				return matcher
+			}
+		}
+	}
+	return c.origins
+}
+
+type originMatcher struct {
+	any      bool
+	exact    map[string]bool
+	patterns []originPattern
+}
+
+type originPattern struct {
+	scheme string
+	suffix string // ".example.com" or ".example.com:8080"
+}
+
+// ValidateCORSOrigins checks origins the same way NewCORS does
+func ValidateCORSOrigins(origins []string, allowCredentials bool) error {
+	_, err := newOriginMatcher(origins, allowCredentials)
+	return err
+}
+
+func newOriginMatcher(origins []string, allowCredentials bool) (originMatcher, error) {
+	m := originMatcher{exact: make(map[string]bool)}
+
+	for _, origin := range origins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			if allowCredentials {
+				return m, fmt.Errorf("origin \"*\" can't be used with credentials")
+			}
+			m.any = true
+		case strings.Contains(origin, "://*."):
+			scheme, host, _ := strings.Cut(origin, "://*.")
+			if scheme == "" || host == "" || strings.ContainsAny(host, "*/") {
+				return m, fmt.Errorf("invalid origin pattern %q", origin)
+			}
+			m.patterns = append(m.patterns, originPattern{scheme: scheme, suffix: "." + host})
+		default:
+			u, err := url.Parse(origin)
+			if err != nil || u.Scheme == "" || u.Host == "" || strings.Contains(origin, "*") || (u.Path != "" && u.Path != "/") {
+				return m, fmt.Errorf("invalid origin %q", origin)
+			}
+			m.exact[u.Scheme+"://"+u.Host] = true
+		}
+	}
+
+	return m, nil
+}
+
+func (m originMatcher) allowed(origin string) bool {
+	if m.any {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if m.exact[origin] {
+		return true
+	}
+
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok {
+		return false
+	}
+	for _, p := range m.patterns {
+		if p.scheme == scheme && strings.HasSuffix(host, p.suffix) && len(host) > len(p.suffix) {
+			return true
+		}
+	}
+	return false
+}
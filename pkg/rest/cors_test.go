@@ -0,0 +1,286 @@
+package rest
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.com"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		ExposedHeaders: []string{"ETag"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+// corsRouter routes GET and POST /users and GET and DELETE /users/{id}
+func corsRouter() *mux.Router {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	router := mux.NewRouter()
+	router.HandleFunc("/users", ok).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/users/{id}", ok).Methods(http.MethodGet, http.MethodDelete)
+	return router
+}
+
+func serveCORS(t *testing.T, config CORSConfig, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+
+	router := corsRouter()
+	cors, err := NewCORS(config, router)
+	if err != nil {
+		t.Fatalf("NewCORS: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	cors.Handler(router).ServeHTTP(rec, req)
+	return rec
+}
+
+func preflight(path, origin, method string, headers ...string) *http.Request {
+	req := httptest.NewRequest(http.MethodOptions, path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if len(headers) > 0 {
+		req.Header.Set("Access-Control-Request-Headers", strings.Join(headers, ", "))
+	}
+	return req
+}
+
+func TestCORSOrigins(t *testing.T) {
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"https://a.example.com", true},
+		{"https://A.Example.com", true},
+		{"https://b.a.example.com", true},
+		{"https://example.com", false},
+		{"https://evilexample.com", false},
+		{"https://a.example.com.evil.com", false},
+		{"http://a.example.com", false},
+		{"https://other.org", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("Origin", tt.origin)
+			rec := serveCORS(t, testCORSConfig(), req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			got := rec.Header().Get("Access-Control-Allow-Origin")
+			if tt.allowed && got != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.origin)
+			}
+			if !tt.allowed && got != "" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+			}
+			if got := rec.Header().Values("Vary"); len(got) != 1 || got[0] != "Origin" {
+				t.Errorf("Vary = %q, want [Origin]", got)
+			}
+		})
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	t.Run("without origin", func(t *testing.T) {
+		rec := serveCORS(t, testCORSConfig(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+		if len(rec.Header()) != 0 {
+			t.Errorf("headers = %v, want none", rec.Header())
+		}
+	})
+
+	t.Run("exposed headers", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		rec := serveCORS(t, testCORSConfig(), req)
+
+		if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "ETag" {
+			t.Errorf("Access-Control-Expose-Headers = %q, want ETag", got)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("Access-Control-Allow-Credentials = %q, want none", got)
+		}
+	})
+
+	t.Run("any origin", func(t *testing.T) {
+		config := testCORSConfig()
+		config.AllowedOrigins = []string{"*"}
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("Origin", "https://other.org")
+		rec := serveCORS(t, config, req)
+
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+		}
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		config := testCORSConfig()
+		config.AllowCredentials = true
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("Origin", "https://a.example.com")
+		rec := serveCORS(t, config, req)
+
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://a.example.com" {
+			t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+		}
+	})
+}
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          *http.Request
+		status       int
+		allowHeaders string
+	}{
+		{
+			name:   "allowed method",
+			req:    preflight("/users", "https://app.example.com", http.MethodPost),
+			status: http.StatusNoContent,
+		},
+		{
+			name:         "allowed headers",
+			req:          preflight("/users", "https://a.example.com", http.MethodPost, "content-type", "Authorization"),
+			status:       http.StatusNoContent,
+			allowHeaders: "content-type, Authorization",
+		},
+		{
+			name:   "denied origin",
+			req:    preflight("/users", "https://evilexample.com", http.MethodPost),
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "disallowed method",
+			req:    preflight("/users", "https://app.example.com", http.MethodPut),
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "disallowed header",
+			req:    preflight("/users", "https://app.example.com", http.MethodPost, "Content-Type", "X-Custom"),
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveCORS(t, testCORSConfig(), tt.req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			wantVary := []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}
+			if got := rec.Header().Values("Vary"); strings.Join(got, ",") != strings.Join(wantVary, ",") {
+				t.Errorf("Vary = %q, want %q", got, wantVary)
+			}
+			if tt.status != http.StatusNoContent {
+				if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+					t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+				}
+				return
+			}
+
+			origin := tt.req.Header.Get("Origin")
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, origin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST, DELETE" {
+				t.Errorf("Access-Control-Allow-Methods = %q, want GET, POST, DELETE", got)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Headers"); got != tt.allowHeaders {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, tt.allowHeaders)
+			}
+			if got := rec.Header().Get("Access-Control-Max-Age"); got != "600" {
+				t.Errorf("Access-Control-Max-Age = %q, want 600", got)
+			}
+		})
+	}
+}
+
+func TestCORSRouteOverride(t *testing.T) {
+	config := testCORSConfig()
+	config.Routes = map[string][]string{"/users/{id}": {"https://admin.example.org"}}
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"override allows its origin", preflight("/users/1", "https://admin.example.org", http.MethodDelete), http.StatusNoContent},
+		{"override replaces global origins", preflight("/users/1", "https://app.example.com", http.MethodDelete), http.StatusForbidden},
+		{"other routes keep global origins", preflight("/users", "https://app.example.com", http.MethodPost), http.StatusNoContent},
+		{"other routes deny override origin", preflight("/users", "https://admin.example.org", http.MethodPost), http.StatusForbidden},
+		{"requested method without route uses global origins", preflight("/users/1", "https://app.example.com", http.MethodPost), http.StatusNoContent},
+		{"requested method selects the route", preflight("/users/1", "https://admin.example.org", http.MethodGet), http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serveCORS(t, config, tt.req); rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestNewCORSValidatesOrigins(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  CORSConfig
+		wantErr string
+	}{
+		{
+			name:    "any origin with credentials",
+			config:  CORSConfig{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true},
+			wantErr: `origin "*" can't be used with credentials`,
+		},
+		{
+			name:    "any origin with credentials on a route",
+			config:  CORSConfig{AllowCredentials: true, Routes: map[string][]string{"/users": {"*"}}},
+			wantErr: `route /users: origin "*" can't be used with credentials`,
+		},
+		{
+			name:    "invalid pattern",
+			config:  CORSConfig{AllowedOrigins: []string{"https://*.*.example.com"}},
+			wantErr: "invalid origin pattern",
+		},
+		{
+			name:    "origin with path",
+			config:  CORSConfig{AllowedOrigins: []string{"https://app.example.com/path"}},
+			wantErr: "invalid origin",
+		},
+		{
+			name:   "any origin without credentials",
+			config: CORSConfig{AllowedOrigins: []string{"*"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCORS(tt.config, nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
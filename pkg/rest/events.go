@@ -0,0 +1,136 @@
+package rest
+
+import (
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/events"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sseHeartbeat keeps idle streams alive through proxies
+	sseHeartbeat = 15 * time.Second
+	// sseRetry is the reconnection delay suggested to clients
+	sseRetry = 3 * time.Second
+)
+
+type UserEvents interface {
+	Subscribe(filter events.Filter, lastEventID string) (*events.Subscription, []events.Event, bool)
+}
+
+// streamUserEvents streams user changes as Server-Sent Events. Clients
+// resume with the Last-Event-ID header; when the events after it are no
+// longer buffered a "reset" event tells them to reload users first.
+func (h *Handler) streamUserEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := eventFilterFromRequest(r)
+	if err != nil {
+		h.logger.Error().Err(err).Str("method", "streamUserEvents").Msg("Invalid event filter")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	sub, replay, complete := h.userEvents.Subscribe(filter, r.Header.Get("Last-Event-ID"))
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	h.logger.Info().
+		Interface("user_ids", filter.UserIDs).
+		Int("replayed", len(replay)).
+		Bool("complete", complete).
+		Msg("Event stream opened")
+
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range replay {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		h.logger.Error().Err(err).Msg("Streaming is not supported by the response writer")
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			h.logger.Debug().Msg("Event stream closed by client")
+			return
+		case <-sub.Done():
+			h.logger.Info().Err(sub.Err()).Msg("Event stream ended by broker")
+			return
+		case event := <-sub.Events():
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event.UserEvent)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID(), event.Type, data)
+	return err
+}
+
+// eventFilterFromRequest reads the comma separated id and type query parameters
+func eventFilterFromRequest(r *http.Request) (events.Filter, error) {
+	var filter events.Filter
+	query := r.URL.Query()
+
+	for _, raw := range splitList(query.Get("id")) {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id < 1 {
+			return filter, fmt.Errorf("invalid user id %q", raw)
+		}
+		filter.UserIDs = append(filter.UserIDs, id)
+	}
+
+	for _, raw := range splitList(query.Get("type")) {
+		eventType := domain.EventType(raw)
+		known := false
+		for _, t := range domain.EventTypes {
+			known = known || t == eventType
+		}
+		if !known {
+			return filter, fmt.Errorf("unknown event type %q", raw)
+		}
+		filter.Types = append(filter.Types, eventType)
+	}
+
+	return filter, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
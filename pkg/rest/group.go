@@ -0,0 +1,479 @@
+package rest
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/logger"
+	"crud-without-db/pkg/openapi"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// maxUserID is the largest ID users.id, a SERIAL, can hold. PostgreSQL
+// rejects larger IDs as parameters instead of matching no user.
+const maxUserID = math.MaxInt32
+
+type Groups interface {
+	Create(ctx context.Context, group domain.Group) (domain.Group, error)
+	GetByID(ctx context.Context, id int64) (domain.Group, error)
+	List(ctx context.Context) ([]domain.Group, error)
+	Update(ctx context.Context, id int64, group domain.Group) (domain.Group, error)
+	Delete(ctx context.Context, id int64) error
+	AddMember(ctx context.Context, groupID, userID int64) error
+	RemoveMember(ctx context.Context, groupID, userID int64) error
+	Members(ctx context.Context, groupID int64) ([]domain.User, error)
+	UserGroups(ctx context.Context, userID int64) ([]domain.Group, error)
+}
+
+// GroupHandler serves groups, their members and the groups of users
+type GroupHandler struct {
+	groups Groups
+	logger zerolog.Logger
+}
+
+func NewGroupHandler(groups Groups) *GroupHandler {
+	return &GroupHandler{
+		groups: groups,
+		logger: logger.GetLogger("groups"),
+	}
+}
+
+// InitRoutes registers the group routes and documents them
+func (h *GroupHandler) InitRoutes(r *mux.Router, doc *openapi.Document) {
+	doc.Tags = append(doc.Tags, openapi.Tag{Name: "groups", Description: "Groups of users"})
+
+	for _, route := range h.routes() {
+		r.HandleFunc(route.path, route.handler).Methods(route.method)
+		doc.AddOperation(route.method, route.path, route.op(doc))
+	}
+}
+
+func (h *GroupHandler) routes() []route {
+	groupIDParameter := openapi.Parameter{
+		Name:        "id",
+		In:          "path",
+		Description: "Group ID",
+		Required:    true,
+		Schema:      &openapi.Schema{Type: openapi.TypeSet{"integer"}, Format: "int64", Minimum: float64Ptr(1)},
+	}
+	memberIDParameter := openapi.Parameter{
+		Name:        "user_id",
+		In:          "path",
+		Description: "User ID",
+		Required:    true,
+		Schema:      &openapi.Schema{Type: openapi.TypeSet{"integer"}, Format: "int64", Minimum: float64Ptr(1)},
+	}
+
+	return []route{
+		{
+			method:  http.MethodGet,
+			path:    "/groups",
+			handler: h.listGroups,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "listGroups",
+					Summary:     "List groups",
+					Tags:        []string{"groups"},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(openapi.ArrayOf(doc.SchemaOf(domain.Group{})))},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodPost,
+			path:    "/groups",
+			handler: h.createGroup,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "createGroup",
+					Summary:     "Create a group",
+					Tags:        []string{"groups"},
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content:  openapi.JSONContent(doc.SchemaOf(domain.Group{})),
+					},
+					Responses: map[string]*openapi.Response{
+						"201": {Description: "Created", Content: openapi.JSONContent(doc.SchemaOf(domain.Group{}))},
+						"400": {Description: "Bad Request"},
+						"409": {Description: "Conflict, another group has the name"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/groups/{id}",
+			handler: h.getGroup,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "getGroup",
+					Summary:     "Get a group",
+					Tags:        []string{"groups"},
+					Parameters:  []openapi.Parameter{groupIDParameter},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.Group{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodPut,
+			path:    "/groups/{id}",
+			handler: h.updateGroup,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "updateGroup",
+					Summary:     "Update a group",
+					Tags:        []string{"groups"},
+					Parameters:  []openapi.Parameter{groupIDParameter},
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content:  openapi.JSONContent(doc.SchemaOf(domain.Group{})),
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.Group{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"409": {Description: "Conflict, another group has the name"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodDelete,
+			path:    "/groups/{id}",
+			handler: h.deleteGroup,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "deleteGroup",
+					Summary:     "Delete a group",
+					Description: "Removes the group and its memberships, the users are kept.",
+					Tags:        []string{"groups"},
+					Parameters:  []openapi.Parameter{groupIDParameter},
+					Responses: map[string]*openapi.Response{
+						"204": {Description: "No Content"},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/groups/{id}/members",
+			handler: h.listMembers,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "listGroupMembers",
+					Summary:     "List the members of a group",
+					Tags:        []string{"groups"},
+					Parameters:  []openapi.Parameter{groupIDParameter},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(openapi.ArrayOf(doc.SchemaOf(domain.User{})))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodPut,
+			path:    "/groups/{id}/members/{user_id}",
+			handler: h.addMember,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "addGroupMember",
+					Summary:     "Add a user to a group",
+					Description: "Adding a member again does nothing.",
+					Tags:        []string{"groups"},
+					Parameters:  []openapi.Parameter{groupIDParameter, memberIDParameter},
+					Responses: map[string]*openapi.Response{
+						"204": {Description: "No Content"},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found, the group or the user doesn't exist"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodDelete,
+			path:    "/groups/{id}/members/{user_id}",
+			handler: h.removeMember,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "removeGroupMember",
+					Summary:     "Remove a user from a group",
+					Tags:        []string{"groups"},
+					Parameters:  []openapi.Parameter{groupIDParameter, memberIDParameter},
+					Responses: map[string]*openapi.Response{
+						"204": {Description: "No Content"},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found, the user isn't a member of the group"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/users/{id}/groups",
+			handler: h.listUserGroups,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "listUserGroups",
+					Summary:     "List the groups of a user",
+					Tags:        []string{"groups"},
+					Parameters:  []openapi.Parameter{userIDParameter},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(openapi.ArrayOf(doc.SchemaOf(domain.Group{})))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+	}
+}
+
+func (h *GroupHandler) listGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.groups.List(r.Context())
+	if err != nil {
+		h.logger.Error().Err(err).Str("method", "listGroups").Msg("Failed to list groups")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if groups == nil {
+		groups = []domain.Group{}
+	}
+	h.writeJSON(w, http.StatusOK, groups)
+}
+
+func (h *GroupHandler) createGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.readGroup(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := h.groups.Create(r.Context(), group)
+	if err != nil {
+		h.writeError(w, err, "createGroup")
+		return
+	}
+
+	h.logger.Info().Int64("group_id", created.ID).Str("group_name", created.Name).Msg("Group created")
+	w.Header().Set("Location", "/groups/"+strconv.FormatInt(created.ID, 10))
+	h.writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *GroupHandler) getGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	group, err := h.groups.GetByID(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err, "getGroup")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, group)
+}
+
+func (h *GroupHandler) updateGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	group, ok := h.readGroup(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := h.groups.Update(r.Context(), id, group)
+	if err != nil {
+		h.writeError(w, err, "updateGroup")
+		return
+	}
+
+	h.logger.Info().Int64("group_id", id).Msg("Group updated")
+	h.writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *GroupHandler) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.groups.Delete(r.Context(), id); err != nil {
+		h.writeError(w, err, "deleteGroup")
+		return
+	}
+
+	h.logger.Info().Int64("group_id", id).Msg("Group deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *GroupHandler) listMembers(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	members, err := h.groups.Members(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err, "listMembers")
+		return
+	}
+
+	if members == nil {
+		members = []domain.User{}
+	}
+	h.writeJSON(w, http.StatusOK, members)
+}
+
+func (h *GroupHandler) addMember(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := membershipIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.groups.AddMember(r.Context(), id, userID); err != nil {
+		h.writeError(w, err, "addMember")
+		return
+	}
+
+	h.logger.Info().Int64("group_id", id).Int64("user_id", userID).Msg("Group member added")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *GroupHandler) removeMember(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := membershipIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.groups.RemoveMember(r.Context(), id, userID); err != nil {
+		h.writeError(w, err, "removeMember")
+		return
+	}
+
+	h.logger.Info().Int64("group_id", id).Int64("user_id", userID).Msg("Group member removed")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *GroupHandler) listUserGroups(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if id > maxUserID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	groups, err := h.groups.UserGroups(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err, "listUserGroups")
+		return
+	}
+
+	if groups == nil {
+		groups = []domain.Group{}
+	}
+	h.writeJSON(w, http.StatusOK, groups)
+}
+
+// membershipIDs returns the group and user IDs of a membership route,
+// responding 400 when one is invalid and 404 when no user can have the ID
+func membershipIDs(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+	userID, err := pathID(r, "user_id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+	if userID > maxUserID {
+		w.WriteHeader(http.StatusNotFound)
+		return 0, 0, false
+	}
+	return id, userID, true
+}
+
+func (h *GroupHandler) readGroup(w http.ResponseWriter, r *http.Request) (domain.Group, bool) {
+	var group domain.Group
+
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to read request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return group, false
+	}
+
+	if err = json.Unmarshal(reqBytes, &group); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to unmarshal group")
+		w.WriteHeader(http.StatusBadRequest)
+		return group, false
+	}
+
+	return group, true
+}
+
+func (h *GroupHandler) writeError(w http.ResponseWriter, err error, method string) {
+	var validationErr *domain.ValidationError
+	switch {
+	case errors.Is(err, domain.ErrGroupNotFound), errors.Is(err, domain.ErrUserNotFound), errors.Is(err, domain.ErrMembershipNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, domain.ErrGroupConflict):
+		h.logger.Warn().Err(err).Str("method", method).Msg("Group conflicts with another group")
+		w.WriteHeader(http.StatusConflict)
+	case errors.As(err, &validationErr):
+		h.logger.Warn().Err(err).Str("method", method).Msg("Invalid group")
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		h.logger.Error().Err(err).Str("method", method).Msg("Group request failed")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (h *GroupHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal group response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
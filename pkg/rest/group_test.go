@@ -0,0 +1,67 @@
+package rest
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/openapi"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeGroups records the user IDs it gets; methods the tests don't call are
+// left to the nil embedded interface
+type fakeGroups struct {
+	Groups
+	userIDs []int64
+}
+
+func (f *fakeGroups) AddMember(ctx context.Context, groupID, userID int64) error {
+	f.userIDs = append(f.userIDs, userID)
+	return nil
+}
+
+func (f *fakeGroups) RemoveMember(ctx context.Context, groupID, userID int64) error {
+	f.userIDs = append(f.userIDs, userID)
+	return nil
+}
+
+func (f *fakeGroups) UserGroups(ctx context.Context, userID int64) ([]domain.Group, error) {
+	f.userIDs = append(f.userIDs, userID)
+	return nil, nil
+}
+
+func TestGroupHandlerUserIDRange(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPut, "/groups/1/members/2147483647", http.StatusNoContent},
+		{http.MethodPut, "/groups/1/members/2147483648", http.StatusNotFound},
+		{http.MethodDelete, "/groups/1/members/2147483647", http.StatusNoContent},
+		{http.MethodDelete, "/groups/1/members/9223372036854775807", http.StatusNotFound},
+		{http.MethodDelete, "/groups/1/members/9223372036854775808", http.StatusBadRequest},
+		{http.MethodGet, "/users/2147483647/groups", http.StatusOK},
+		{http.MethodGet, "/users/2147483648/groups", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			groups := &fakeGroups{}
+			router := mux.NewRouter()
+			NewGroupHandler(groups).InitRoutes(router, openapi.New(openapi.Info{Title: "test", Version: "1"}))
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status != http.StatusOK && tt.status != http.StatusNoContent && len(groups.userIDs) != 0 {
+				t.Errorf("repository got user IDs %v, want none", groups.userIDs)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"context"
 	"crud-without-db/internal/domain"
 	"crud-without-db/pkg/logger"
 	"encoding/json"
@@ -11,24 +12,46 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Users interface {
-	Create(user domain.User) error
-	GetByID(id int64) (domain.User, error)
-	GetAll() ([]domain.User, error)
-	Delete(id int64) error
-	Update(id int64, inp domain.User) error
+	Create(ctx context.Context, user domain.User) (domain.User, error)
+	GetByID(ctx context.Context, id int64) (domain.User, error)
+	GetByEmail(ctx context.Context, email string) (domain.User, error)
+	List(ctx context.Context, filter domain.UserFilter) ([]domain.User, error)
+	Search(ctx context.Context, search domain.UserSearch) ([]domain.UserSearchResult, error)
+	Changes(ctx context.Context, since string, limit int) (domain.UserChanges, error)
+	Delete(ctx context.Context, id int64) error
+	Update(ctx context.Context, id int64, inp domain.User) (domain.User, error)
 }
 
+const (
+	defaultSearchLimit  = 20
+	maxSearchLimit      = 100
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+
+	// attributeParameterPrefix marks list query parameters filtering on
+	// custom attributes, like attr.plan=pro
+	attributeParameterPrefix = "attr."
+)
+
 type Handler struct {
 	usersService Users
+	userEvents   UserEvents
+	addresses    Addresses
 	logger       zerolog.Logger
 }
 
-func NewHandler(users Users) *Handler {
+// NewHandler creates the users handler, addresses are embedded in users on
+// request
+func NewHandler(users Users, userEvents UserEvents, addresses Addresses) *Handler {
 	return &Handler{
 		usersService: users,
+		userEvents:   userEvents,
+		addresses:    addresses,
 		logger:       logger.GetLogger("handler"),
 	}
 }
@@ -37,25 +60,13 @@ func (h *Handler) InitRouter() *mux.Router {
 	r := mux.NewRouter()
 	r.Use(loggingMiddleware)
 
-	users := r.PathPrefix("/users").Subrouter()
-	{
-		users.HandleFunc("", h.createUser).Methods("POST")
-		users.HandleFunc("", h.getAllUsers).Methods("GET")
-		users.HandleFunc("/{id}", h.getUserByID).Methods("GET")
-		users.HandleFunc("/{id}", h.deleteUser).Methods("DELETE")
-		users.HandleFunc("/{id}", h.updateUser).Methods("PUT")
+	for _, route := range h.routes() {
+		r.HandleFunc(route.path, route.handler).Methods(route.method)
 	}
 
 	return r
 }
 
-// @Summary Get a user by ID
-// @Description Get a user by their ID
-// @Tags users
-// @Produce json
-// @Param id path int true "User ID"
-// @Success 200 {object} domain.User
-// @Router /users/{id} [get]
 func (h *Handler) getUserByID(w http.ResponseWriter, r *http.Request) {
 	id, err := getIdFromRequest(r)
 	if err != nil {
@@ -64,9 +75,25 @@ func (h *Handler) getUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expandAddresses := false
+	for _, expand := range strings.Split(r.URL.Query().Get("expand"), ",") {
+		switch expand {
+		case "":
+		case "addresses":
+			expandAddresses = true
+		default:
+			h.logger.Warn().Str("expand", expand).Str("method", "getUserByID").Msg("Unknown expansion")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
 	h.logger.Debug().Int64("user_id", id).Msg("Getting user by ID")
 
-	user, err := h.usersService.GetByID(id)
+	user, err := h.usersService.GetByID(r.Context(), id)
+	if err == nil && expandAddresses {
+		user.Addresses, err = h.addresses.List(r.Context(), id)
+	}
 	if err != nil {
 		if errors.Is(err, domain.ErrUserNotFound) {
 			h.logger.Warn().Int64("user_id", id).Msg("User not found")
@@ -91,14 +118,137 @@ func (h *Handler) getUserByID(w http.ResponseWriter, r *http.Request) {
 	w.Write(response)
 }
 
-// @Summary Create a new user
-// @Description Create a new user
-// @Tags users
-// @Accept json
-// @Produce json
-// @Param user body domain.User true "Create user"
-// @Success 201 {object} domain.User
-// @Router /users [post]
+func (h *Handler) getUserByEmail(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	user, err := h.usersService.GetByEmail(r.Context(), email)
+	if err != nil {
+		var validationErr *domain.ValidationError
+		if errors.As(err, &validationErr) {
+			h.logger.Warn().Err(err).Str("method", "getUserByEmail").Msg("Invalid email")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, domain.ErrUserNotFound) {
+			h.logger.Debug().Msg("User not found by email")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.logger.Error().Err(err).Msg("Failed to get user by email")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(user)
+	if err != nil {
+		h.logger.Error().Err(err).Int64("user_id", user.ID).Msg("Failed to marshal user response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func (h *Handler) searchUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := domain.UserSearch{Query: query.Get("q"), Limit: defaultSearchLimit}
+
+	var err error
+	if raw := query.Get("limit"); raw != "" {
+		search.Limit, err = strconv.Atoi(raw)
+		if err != nil || search.Limit < 1 || search.Limit > maxSearchLimit {
+			h.logger.Warn().Str("limit", raw).Msg("Invalid search limit")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if raw := query.Get("offset"); raw != "" {
+		search.Offset, err = strconv.Atoi(raw)
+		if err != nil || search.Offset < 0 {
+			h.logger.Warn().Str("offset", raw).Msg("Invalid search offset")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := h.usersService.Search(r.Context(), search)
+	if err != nil {
+		var validationErr *domain.ValidationError
+		if errors.As(err, &validationErr) {
+			h.logger.Warn().Err(err).Str("method", "searchUsers").Msg("Invalid search")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		h.logger.Error().Err(err).Str("query", search.Query).Msg("Failed to search users")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if results == nil {
+		results = []domain.UserSearchResult{}
+	}
+
+	response, err := json.Marshal(results)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal search response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Debug().Str("query", search.Query).Int("results", len(results)).Msg("Users searched")
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func (h *Handler) getUserChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since := query.Get("since")
+
+	limit := defaultChangesLimit
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxChangesLimit {
+			h.logger.Warn().Str("limit", raw).Msg("Invalid changes limit")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes, err := h.usersService.Changes(r.Context(), since, limit)
+	if err != nil {
+		var validationErr *domain.ValidationError
+		if errors.As(err, &validationErr) {
+			h.logger.Warn().Err(err).Str("method", "getUserChanges").Msg("Invalid change token")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, domain.ErrChangeTokenExpired) {
+			h.logger.Warn().Str("since", since).Msg("Change token expired")
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+
+		h.logger.Error().Err(err).Str("method", "getUserChanges").Msg("Failed to get user changes")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(changes)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal changes response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Debug().Int("changes", len(changes.Changes)).Bool("has_more", changes.HasMore).Msg("User changes retrieved")
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
 func (h *Handler) createUser(w http.ResponseWriter, r *http.Request) {
 	reqBytes, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -120,8 +270,20 @@ func (h *Handler) createUser(w http.ResponseWriter, r *http.Request) {
 		Str("user_sex", user.Sex).
 		Msg("Creating new user")
 
-	err = h.usersService.Create(user)
+	user, err = h.usersService.Create(r.Context(), user)
 	if err != nil {
+		var validationErr *domain.ValidationError
+		if errors.As(err, &validationErr) {
+			h.logger.Warn().Err(err).Str("method", "createUser").Msg("Invalid user data")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, domain.ErrUserConflict) {
+			h.logger.Warn().Err(err).Str("method", "createUser").Msg("User conflicts with another user")
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
 		h.logger.Error().Err(err).
 			Str("user_name", user.Name).
 			Msg("Failed to create user")
@@ -129,17 +291,19 @@ func (h *Handler) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.logger.Info().Str("user_name", user.Name).Msg("User created successfully")
+	response, err := json.Marshal(user)
+	if err != nil {
+		h.logger.Error().Err(err).Int64("user_id", user.ID).Msg("Failed to marshal user response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info().Int64("user_id", user.ID).Str("user_name", user.Name).Msg("User created successfully")
+	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
 }
 
-// @Summary Delete a user
-// @Description Delete a user by their ID
-// @Tags users
-// @Produce json
-// @Param id path int true "User ID"
-// @Success 204
-// @Router /users/{id} [delete]
 func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) {
 	id, err := getIdFromRequest(r)
 	if err != nil {
@@ -150,8 +314,13 @@ func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) {
 
 	h.logger.Debug().Int64("user_id", id).Msg("Deleting user")
 
-	err = h.usersService.Delete(id)
+	err = h.usersService.Delete(r.Context(), id)
 	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			h.logger.Warn().Int64("user_id", id).Msg("User not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		h.logger.Error().Err(err).Int64("user_id", id).Msg("Failed to delete user")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -161,22 +330,59 @@ func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// @Summary Get all users
-// @Description Get a list of all users
-// @Tags users
-// @Produce json
-// @Success 200 {array} domain.User
-// @Router /users [get]
 func (h *Handler) getAllUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var filter domain.UserFilter
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_since", &filter.UpdatedSince},
+	} {
+		raw := query.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		value, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			h.logger.Warn().Str(param.name, raw).Msg("Invalid time filter")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		*param.value = value
+	}
+	for name, values := range query {
+		if attribute, ok := strings.CutPrefix(name, attributeParameterPrefix); ok {
+			if filter.Attributes == nil {
+				filter.Attributes = make(map[string]interface{})
+			}
+			filter.Attributes[attribute] = values[0]
+		}
+	}
+
 	h.logger.Debug().Msg("Getting all users")
 
-	users, err := h.usersService.GetAll()
+	users, err := h.usersService.List(r.Context(), filter)
 	if err != nil {
+		var validationErr *domain.ValidationError
+		if errors.As(err, &validationErr) {
+			h.logger.Warn().Err(err).Str("method", "getAllUsers").Msg("Invalid user filter")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
 		h.logger.Error().Err(err).Str("method", "getAllUsers").Msg("Failed to get all users")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	// Always respond with an array, even when there are no users
+	if users == nil {
+		users = []domain.User{}
+	}
+
 	response, err := json.Marshal(users)
 	if err != nil {
 		h.logger.Error().Err(err).Str("method", "getAllUsers").Msg("Failed to marshal users response")
@@ -189,15 +395,6 @@ func (h *Handler) getAllUsers(w http.ResponseWriter, r *http.Request) {
 	w.Write(response)
 }
 
-// @Summary Update a user
-// @Description Update a user by their ID
-// @Tags users
-// @Accept json
-// @Produce json
-// @Param id path int true "User ID"
-// @Param user body domain.User true "Update user"
-// @Success 200 {object} domain.User
-// @Router /users/{id} [put]
 func (h *Handler) updateUser(w http.ResponseWriter, r *http.Request) {
 	id, err := getIdFromRequest(r)
 	if err != nil {
@@ -227,15 +424,40 @@ func (h *Handler) updateUser(w http.ResponseWriter, r *http.Request) {
 		Str("user_sex", inp.Sex).
 		Msg("Updating user")
 
-	err = h.usersService.Update(id, inp)
+	user, err := h.usersService.Update(r.Context(), id, inp)
 	if err != nil {
+		var validationErr *domain.ValidationError
+		if errors.As(err, &validationErr) {
+			h.logger.Warn().Err(err).Int64("user_id", id).Msg("Invalid user data")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, domain.ErrUserConflict) {
+			h.logger.Warn().Err(err).Int64("user_id", id).Msg("User conflicts with another user")
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if errors.Is(err, domain.ErrUserNotFound) {
+			h.logger.Warn().Int64("user_id", id).Msg("User not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
 		h.logger.Error().Err(err).Int64("user_id", id).Msg("Failed to update user")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	h.logger.Info().Int64("user_id", id).Str("user_name", inp.Name).Msg("User updated successfully")
-	w.WriteHeader(http.StatusOK)
+	response, err := json.Marshal(user)
+	if err != nil {
+		h.logger.Error().Err(err).Int64("user_id", id).Msg("Failed to marshal user response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info().Int64("user_id", id).Str("user_name", user.Name).Msg("User updated successfully")
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
 }
 
 func getIdFromRequest(r *http.Request) (int64, error) {
@@ -1,11 +1,24 @@
 package rest
 
 import (
+	"bufio"
+	"crud-without-db/pkg/db"
 	"crud-without-db/pkg/logger"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+const (
+	// readPrimaryHeader lets a client explicitly request reads from the primary
+	readPrimaryHeader = "X-Read-Primary"
+	// readPrimaryCookie is the session flag set after a write for read-your-writes
+	readPrimaryCookie = "read_primary"
+)
+
 // loggingMiddleware wraps an http.Handler to log the request details using zerolog
 // It logs request method, URI, and response time in a structured format
 func loggingMiddleware(next http.Handler) http.Handler {
@@ -35,6 +48,42 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	)
 }
 
+// ReadYourWritesMiddleware routes reads to the primary database for clients
+// that ask for it with the X-Read-Primary header, or that have written
+// within the last window (tracked with a short-lived cookie), so that
+// replication lag never hides their own changes
+func ReadYourWritesMiddleware(window time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			usePrimary, _ := strconv.ParseBool(r.Header.Get(readPrimaryHeader))
+			if _, err := r.Cookie(readPrimaryCookie); err == nil {
+				usePrimary = true
+			}
+
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+				if window > 0 {
+					http.SetCookie(w, &http.Cookie{
+						Name:     readPrimaryCookie,
+						Value:    "1",
+						Path:     "/",
+						MaxAge:   int(math.Ceil(window.Seconds())),
+						HttpOnly: true,
+						SameSite: http.SameSiteLaxMode,
+					})
+				}
+				usePrimary = true
+			}
+
+			if usePrimary {
+				r = r.WithContext(db.WithPrimary(r.Context()))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // responseWriter is a wrapper around http.ResponseWriter to capture the status code
 type responseWriter struct {
 	http.ResponseWriter
@@ -46,3 +95,28 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Flush sends buffered data to the client, used by streaming responses
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack hands the connection over, used by WebSocket upgrades
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err == nil {
+		rw.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
@@ -0,0 +1,34 @@
+package rest
+
+import (
+	"crud-without-db/pkg/openapi"
+	"encoding/json"
+	"net/http"
+)
+
+// problem is an RFC 9457 problem details response
+type problem struct {
+	Type   string              `json:"type"`
+	Title  string              `json:"title"`
+	Status int                 `json:"status"`
+	Detail string              `json:"detail,omitempty"`
+	Errors []openapi.Violation `json:"errors,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, status int, detail string, violations []openapi.Violation) {
+	response, err := json.Marshal(problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Errors: violations,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
@@ -0,0 +1,174 @@
+package rest
+
+import (
+	"crud-without-db/pkg/logger"
+	"crud-without-db/pkg/ratelimit"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate limit key sources, tried in the configured order
+const (
+	KeyByAPIKey     = "api_key" // X-API-Key header
+	KeyByJWTSubject = "jwt_sub" // "sub" claim of a bearer JWT
+	KeyByIP         = "ip"      // client IP, see TrustedProxies
+)
+
+// RateLimitConfig defines limits applied by RateLimiter.
+//
+// API keys and JWT subjects are not verified here, so they should only be
+// used as keys when an upstream gateway authenticates them; otherwise a
+// client could pick a fresh key for every request. They are combined with
+// the client IP, so that a forged key only ever shares a bucket with
+// requests from the same address.
+type RateLimitConfig struct {
+	Default ratelimit.Limit
+	Routes  map[string]ratelimit.Limit // keyed by "METHOD /path/template" or "/path/template"
+	KeyBy   []string
+}
+
+type RateLimiter struct {
+	store   ratelimit.Store
+	config  RateLimitConfig
+	proxies *TrustedProxies
+	logger  zerolog.Logger
+}
+
+func NewRateLimiter(store ratelimit.Store, config RateLimitConfig, proxies *TrustedProxies) *RateLimiter {
+	return &RateLimiter{
+		store:   store,
+		config:  config,
+		proxies: proxies,
+		logger:  logger.GetLogger("ratelimit"),
+	}
+}
+
+// Middleware rejects requests over the limit with 429 and reports the
+// bucket state in RateLimit-* headers. Store failures let requests keyed by
+// IP through; requests keyed by a client chosen value get 503 instead, as
+// they may be what made the store fail.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route, limit := l.routeLimit(r)
+		clientKey, chosen := l.clientKey(r)
+		key := clientKey + "|" + route
+
+		result, err := l.store.Take(r.Context(), key, limit)
+		if err != nil && chosen {
+			l.logger.Error().Err(err).Str("route", route).Msg("Rate limit store failed, rejecting request")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			l.logger.Error().Err(err).Str("route", route).Msg("Rate limit store failed, allowing request")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Period)))
+
+		if !result.Allowed {
+			l.logger.Warn().
+				Str("key", key).
+				Str("limit", limit.String()).
+				Dur("retry_after", result.RetryAfter).
+				Msg("Rate limit exceeded")
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeLimit finds the limit for the matched mux route, preferring
+// method-specific entries
+func (l *RateLimiter) routeLimit(r *http.Request) (string, ratelimit.Limit) {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			if limit, ok := l.config.Routes[r.Method+" "+template]; ok {
+				return r.Method + " " + template, limit
+			}
+			if limit, ok := l.config.Routes[template]; ok {
+				return template, limit
+			}
+		}
+	}
+	return "default", l.config.Default
+}
+
+// clientKey returns the bucket key of the client and whether the client
+// chose it, by sending an API key or a JWT subject
+func (l *RateLimiter) clientKey(r *http.Request) (string, bool) {
+	ip := "ip:" + l.proxies.ClientIP(r)
+	for _, source := range l.config.KeyBy {
+		switch source {
+		case KeyByAPIKey:
+			if key := r.Header.Get("X-API-Key"); key != "" {
+				return "api_key:" + shortHash(key) + "|" + ip, true
+			}
+		case KeyByJWTSubject:
+			if sub := jwtSubject(r); sub != "" {
+				return "jwt_sub:" + shortHash(sub) + "|" + ip, true
+			}
+		case KeyByIP:
+			return ip, false
+		}
+	}
+	return ip, false
+}
+
+// shortHash keeps secrets out of the store and bounds the key length
+func shortHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
+
+// jwtSubject extracts the "sub" claim of a bearer token without verifying it
+func jwtSubject(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return claims.Subject
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,197 @@
+package rest
+
+import (
+	"context"
+	"crud-without-db/pkg/ratelimit"
+	"encoding/base64"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingStore fails every Take
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store unavailable")
+}
+
+// recordingStore records the keys taken from another store
+type recordingStore struct {
+	ratelimit.Store
+	keys []string
+}
+
+func (s *recordingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	s.keys = append(s.keys, key)
+	return s.Store.Take(ctx, key, limit)
+}
+
+func rateLimitedRouter(t *testing.T, store ratelimit.Store, keyBy ...string) *mux.Router {
+	t.Helper()
+
+	proxies, err := NewTrustedProxies(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewRateLimiter(store, RateLimitConfig{
+		Default: ratelimit.Limit{Requests: 2, Period: time.Minute},
+		Routes: map[string]ratelimit.Limit{
+			"POST /users": {Requests: 1, Period: time.Hour},
+			"/users/{id}": {Requests: 5, Period: time.Second},
+		},
+		KeyBy: keyBy,
+	}, proxies)
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	router := mux.NewRouter()
+	router.HandleFunc("/users", ok).Methods(http.MethodGet, http.MethodPost, http.MethodOptions)
+	router.HandleFunc("/users/{id}", ok).Methods(http.MethodGet)
+	router.Use(limiter.Middleware)
+	return router
+}
+
+func serveFrom(router http.Handler, method, path, remote string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remote
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimiterHeaders(t *testing.T) {
+	router := rateLimitedRouter(t, ratelimit.NewMemoryStore(0), KeyByIP)
+
+	tests := []struct {
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{status: http.StatusOK, remaining: "1", reset: "30"},
+		{status: http.StatusOK, remaining: "0", reset: "60"},
+		{status: http.StatusTooManyRequests, remaining: "0", reset: "60", retryAfter: "30"},
+	}
+
+	for i, tt := range tests {
+		rec := serveFrom(router, http.MethodGet, "/users", "203.0.113.7:5000", nil)
+
+		if rec.Code != tt.status {
+			t.Fatalf("request %d: status = %d, want %d", i+1, rec.Code, tt.status)
+		}
+		want := map[string]string{
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": tt.remaining,
+			"RateLimit-Reset":     tt.reset,
+			"RateLimit-Policy":    "2;w=60",
+			"Retry-After":         tt.retryAfter,
+		}
+		for header, value := range want {
+			if got := rec.Header().Get(header); got != value {
+				t.Errorf("request %d: %s = %q, want %q", i+1, header, got, value)
+			}
+		}
+	}
+
+	// Other clients and preflights are not limited by this client
+	if rec := serveFrom(router, http.MethodGet, "/users", "203.0.113.8:5000", nil); rec.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := serveFrom(router, http.MethodOptions, "/users", "203.0.113.7:5000", nil); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("preflight status = %d with headers %v, want 200 without rate limit headers", rec.Code, rec.Header())
+	}
+}
+
+func TestRateLimiterRouteLimits(t *testing.T) {
+	router := rateLimitedRouter(t, ratelimit.NewMemoryStore(0), KeyByIP)
+
+	tests := []struct {
+		method string
+		path   string
+		limit  string
+		policy string
+	}{
+		{http.MethodPost, "/users", "1", "1;w=3600"},
+		{http.MethodGet, "/users/7", "5", "5;w=1"},
+		{http.MethodGet, "/users", "2", "2;w=60"},
+	}
+
+	for _, tt := range tests {
+		rec := serveFrom(router, tt.method, tt.path, "203.0.113.7:5000", nil)
+		if got := rec.Header().Get("RateLimit-Limit"); got != tt.limit {
+			t.Errorf("%s %s: RateLimit-Limit = %q, want %q", tt.method, tt.path, got, tt.limit)
+		}
+		if got := rec.Header().Get("RateLimit-Policy"); got != tt.policy {
+			t.Errorf("%s %s: RateLimit-Policy = %q, want %q", tt.method, tt.path, got, tt.policy)
+		}
+	}
+}
+
+func TestRateLimiterClientKeys(t *testing.T) {
+	jwt := func(sub string) string {
+		payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"` + sub + `"}`))
+		return "Bearer header." + payload + ".signature"
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   string
+	}{
+		{name: "ip", want: "ip:203.0.113.7|default"},
+		{
+			name:   "api key",
+			header: http.Header{"X-Api-Key": {"secret-key"}},
+			want:   "api_key:" + shortHash("secret-key") + "|ip:203.0.113.7|default",
+		},
+		{
+			name:   "jwt subject",
+			header: http.Header{"Authorization": {jwt("user-1")}},
+			want:   "jwt_sub:" + shortHash("user-1") + "|ip:203.0.113.7|default",
+		},
+		{
+			name:   "api key first",
+			header: http.Header{"X-Api-Key": {"secret-key"}, "Authorization": {jwt("user-1")}},
+			want:   "api_key:" + shortHash("secret-key") + "|ip:203.0.113.7|default",
+		},
+		{
+			name:   "malformed jwt",
+			header: http.Header{"Authorization": {"Bearer not-a-jwt"}},
+			want:   "ip:203.0.113.7|default",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &recordingStore{Store: ratelimit.NewMemoryStore(0)}
+			router := rateLimitedRouter(t, store, KeyByAPIKey, KeyByJWTSubject, KeyByIP)
+			serveFrom(router, http.MethodGet, "/users", "203.0.113.7:5000", tt.header)
+
+			if len(store.keys) != 1 || store.keys[0] != tt.want {
+				t.Fatalf("keys = %q, want %q", store.keys, tt.want)
+			}
+			if strings.Contains(store.keys[0], "secret-key") || strings.Contains(store.keys[0], "user-1") {
+				t.Errorf("key %q contains the client value", store.keys[0])
+			}
+		})
+	}
+}
+
+func TestRateLimiterStoreFailure(t *testing.T) {
+	router := rateLimitedRouter(t, failingStore{}, KeyByAPIKey, KeyByIP)
+
+	if rec := serveFrom(router, http.MethodGet, "/users", "203.0.113.7:5000", nil); rec.Code != http.StatusOK {
+		t.Errorf("IP keyed status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	header := http.Header{"X-Api-Key": {"key"}}
+	if rec := serveFrom(router, http.MethodGet, "/users", "203.0.113.7:5000", header); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("API key keyed status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
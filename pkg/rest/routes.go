@@ -0,0 +1,354 @@
+package rest
+
+import (
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/openapi"
+	"encoding/json"
+	"net/http"
+)
+
+// route is a single API operation. The route table registers handlers on
+// the router and generates the OpenAPI document, so both stay in sync.
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	op      func(doc *openapi.Document) *openapi.Operation
+}
+
+var apiInfo = openapi.Info{
+	Title:       "CRUD API with PostgreSQL",
+	Description: "This is a CRUD application with PostgreSQL database.",
+	Version:     "1.0",
+}
+
+func (h *Handler) routes() []route {
+	return []route{
+		{
+			method:  http.MethodGet,
+			path:    "/users",
+			handler: h.getAllUsers,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "getAllUsers",
+					Summary:     "Get all users",
+					Description: "Get a list of all users ordered by ID, optionally only those created or " +
+						"updated in a time range. Incremental syncs pass the latest updated_at they have " +
+						"seen as updated_since. Parameters named attr.<name> only return users whose custom " +
+						"attribute has that value, like attr.plan=pro.",
+					Tags: []string{"users"},
+					Parameters: []openapi.Parameter{
+						timeParameter("created_after", "Only users created after this time"),
+						timeParameter("created_before", "Only users created before this time"),
+						timeParameter("updated_since", "Only users updated at or after this time"),
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(openapi.ArrayOf(doc.SchemaOf(domain.User{})))},
+						"400": {Description: "Bad Request"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodPost,
+			path:    "/users",
+			handler: h.createUser,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "createUser",
+					Summary:     "Create a new user",
+					Description: "Create a new user",
+					Tags:        []string{"users"},
+					RequestBody: &openapi.RequestBody{
+						Description: "Create user",
+						Required:    true,
+						Content:     openapi.JSONContent(doc.SchemaOf(domain.User{})),
+					},
+					Responses: map[string]*openapi.Response{
+						"201": {Description: "Created", Content: openapi.JSONContent(doc.SchemaOf(domain.User{}))},
+						"400": {Description: "Bad Request"},
+						"409": {Description: "Conflict, the email or phone belongs to another user"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/users/events",
+			handler: h.streamUserEvents,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "streamUserEvents",
+					Summary:     "Stream user changes",
+					Description: "Server-Sent Events stream of created, updated and deleted users. " +
+						"Each event has an id to resume from with the Last-Event-ID header; a \"reset\" " +
+						"event means the missed events are no longer available and users should be reloaded.",
+					Tags: []string{"users"},
+					Parameters: []openapi.Parameter{
+						{
+							Name:        "id",
+							In:          "query",
+							Description: "Comma separated user IDs to watch",
+							Schema:      &openapi.Schema{Type: openapi.TypeSet{"string"}, Pattern: `^[1-9][0-9]*(,[1-9][0-9]*)*$`},
+						},
+						{
+							Name:        "type",
+							In:          "query",
+							Description: "Comma separated event types: created, updated, deleted",
+							Schema:      &openapi.Schema{Type: openapi.TypeSet{"string"}, Pattern: `^(created|updated|deleted)(,(created|updated|deleted))*$`},
+						},
+						{
+							Name:        "Last-Event-ID",
+							In:          "header",
+							Description: "ID of the last event received, to resume a stream",
+							Schema:      &openapi.Schema{Type: openapi.TypeSet{"string"}},
+						},
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: map[string]openapi.MediaType{
+							"text/event-stream": {Schema: doc.SchemaOf(domain.UserEvent{})},
+						}},
+						"400": {Description: "Bad Request"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/users/search",
+			handler: h.searchUsers,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "searchUsers",
+					Summary:     "Search users by name",
+					Description: "Finds users whose name has words starting with every query word, " +
+						"or words similar to them to allow for misspellings. Best matches come first.",
+					Tags: []string{"users"},
+					Parameters: []openapi.Parameter{
+						{
+							Name:        "q",
+							In:          "query",
+							Description: "Words to search for",
+							Required:    true,
+							Schema:      &openapi.Schema{Type: openapi.TypeSet{"string"}, MinLength: intPtr(1), MaxLength: intPtr(200)},
+						},
+						{
+							Name:   "limit",
+							In:     "query",
+							Schema: &openapi.Schema{Type: openapi.TypeSet{"integer"}, Minimum: float64Ptr(1), Maximum: float64Ptr(maxSearchLimit)},
+						},
+						{
+							Name:   "offset",
+							In:     "query",
+							Schema: &openapi.Schema{Type: openapi.TypeSet{"integer"}, Minimum: float64Ptr(0)},
+						},
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(openapi.ArrayOf(doc.SchemaOf(domain.UserSearchResult{})))},
+						"400": {Description: "Bad Request"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/users/changes",
+			handler: h.getUserChanges,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "getUserChanges",
+					Summary:     "Sync user changes",
+					Description: "Users created, updated and deleted since a token, in the order of their last change, " +
+						"each with its latest state. Start without a token to get every user, then pass next_token " +
+						"as since, right away while has_more is set. Deleted users only carry their ID.",
+					Tags: []string{"users"},
+					Parameters: []openapi.Parameter{
+						{
+							Name:        "since",
+							In:          "query",
+							Description: "next_token of the previous response",
+							Schema:      &openapi.Schema{Type: openapi.TypeSet{"string"}},
+						},
+						{
+							Name:   "limit",
+							In:     "query",
+							Schema: &openapi.Schema{Type: openapi.TypeSet{"integer"}, Minimum: float64Ptr(1), Maximum: float64Ptr(maxChangesLimit)},
+						},
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.UserChanges{}))},
+						"400": {Description: "Bad Request"},
+						"410": {Description: "Gone, the changes since the token are unknown and clients have to sync from scratch"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/users/by-email/{email}",
+			handler: h.getUserByEmail,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "getUserByEmail",
+					Summary:     "Get a user by email",
+					Description: "Get a user by their email address, ignoring case",
+					Tags:        []string{"users"},
+					Parameters: []openapi.Parameter{
+						{
+							Name:        "email",
+							In:          "path",
+							Description: "Email address",
+							Required:    true,
+							Schema:      &openapi.Schema{Type: openapi.TypeSet{"string"}, Format: "email", MaxLength: intPtr(254)},
+						},
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.User{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/users/{id}",
+			handler: h.getUserByID,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "getUserByID",
+					Summary:     "Get a user by ID",
+					Description: "Get a user by their ID",
+					Tags:        []string{"users"},
+					Parameters: []openapi.Parameter{
+						userIDParameter,
+						{
+							Name:        "expand",
+							In:          "query",
+							Description: "Comma separated related resources to embed: addresses",
+							Schema:      &openapi.Schema{Type: openapi.TypeSet{"string"}, Pattern: `^addresses(,addresses)*$`},
+						},
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.User{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodPut,
+			path:    "/users/{id}",
+			handler: h.updateUser,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "updateUser",
+					Summary:     "Update a user",
+					Description: "Update a user by their ID",
+					Tags:        []string{"users"},
+					Parameters:  []openapi.Parameter{userIDParameter},
+					RequestBody: &openapi.RequestBody{
+						Description: "Update user",
+						Required:    true,
+						Content:     openapi.JSONContent(doc.SchemaOf(domain.User{})),
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.User{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"409": {Description: "Conflict, the email or phone belongs to another user"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodDelete,
+			path:    "/users/{id}",
+			handler: h.deleteUser,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "deleteUser",
+					Summary:     "Delete a user",
+					Description: "Delete a user by their ID",
+					Tags:        []string{"users"},
+					Parameters:  []openapi.Parameter{userIDParameter},
+					Responses: map[string]*openapi.Response{
+						"204": {Description: "No Content"},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+	}
+}
+
+var userIDParameter = openapi.Parameter{
+	Name:        "id",
+	In:          "path",
+	Description: "User ID",
+	Required:    true,
+	Schema:      &openapi.Schema{Type: openapi.TypeSet{"integer"}, Format: "int64", Minimum: float64Ptr(1)},
+}
+
+// timeParameter is an optional RFC 3339 query parameter
+func timeParameter(name, description string) openapi.Parameter {
+	return openapi.Parameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Schema:      &openapi.Schema{Type: openapi.TypeSet{"string"}, Format: "date-time"},
+	}
+}
+
+// OpenAPI generates the API document from the route table
+func (h *Handler) OpenAPI() *openapi.Document {
+	doc := openapi.New(apiInfo)
+	doc.Tags = []openapi.Tag{{Name: "users", Description: "Users management"}}
+
+	for _, route := range h.routes() {
+		doc.AddOperation(route.method, route.path, route.op(doc))
+	}
+
+	return doc
+}
+
+// DocHandler serves the document with the server URL taken from the request,
+// so that "Try it out" works behind any host name
+func DocHandler(doc *openapi.Document) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+
+		response, err := json.Marshal(doc.WithServer(scheme + "://" + r.Host))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	}
+}
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
+
+func intPtr(v int) *int {
+	return &v
+}
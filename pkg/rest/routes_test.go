@@ -0,0 +1,96 @@
+package rest
+
+import (
+	"crud-without-db/pkg/openapi"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiRouter registers every documented route table like main does. The
+// services are never called, only the routes are inspected.
+func apiRouter(t *testing.T) (*mux.Router, *openapi.Document) {
+	t.Helper()
+
+	h := NewHandler(nil, nil, nil)
+	router := h.InitRouter()
+	doc := h.OpenAPI()
+
+	NewWebhookHandler("token", nil).InitRoutes(router, doc)
+	NewGroupHandler(nil).InitRoutes(router, doc)
+	NewAddressHandler(nil).InitRoutes(router, doc)
+	NewAvatarHandler(nil, time.Minute).InitRoutes(router, doc)
+	NewAttributeHandler("token", nil).InitRoutes(router, doc)
+	return router, doc
+}
+
+// TestRoutesMatchOpenAPI checks methods, paths and path parameters. Response
+// statuses aren't covered, handlers don't declare the statuses they write.
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	router, doc := apiRouter(t)
+
+	if err := openapi.Verify(doc, router); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoutesMatchOpenAPIDetectsDrift(t *testing.T) {
+	t.Run("undocumented route", func(t *testing.T) {
+		router, doc := apiRouter(t)
+		router.HandleFunc("/users/{id}/undocumented", func(http.ResponseWriter, *http.Request) {}).Methods(http.MethodGet)
+
+		err := openapi.Verify(doc, router)
+		if err == nil || !strings.Contains(err.Error(), "undocumented route GET /users/{id}/undocumented") {
+			t.Fatalf("expected undocumented route error, got %v", err)
+		}
+	})
+
+	t.Run("operation without route", func(t *testing.T) {
+		router, doc := apiRouter(t)
+		doc.AddOperation(http.MethodPost, "/users/{id}/missing", &openapi.Operation{OperationID: "missing"})
+
+		err := openapi.Verify(doc, router)
+		if err == nil || !strings.Contains(err.Error(), "documented operation without route POST /users/{id}/missing") {
+			t.Fatalf("expected missing route error, got %v", err)
+		}
+	})
+
+	t.Run("undocumented path parameter", func(t *testing.T) {
+		router, doc := apiRouter(t)
+		op := doc.Operation(http.MethodGet, "/users/{id}")
+		op.Parameters = op.Parameters[1:]
+
+		err := openapi.Verify(doc, router)
+		if err == nil || !strings.Contains(err.Error(), `undocumented path parameter "id" of GET /users/{id}`) {
+			t.Fatalf("expected undocumented path parameter error, got %v", err)
+		}
+	})
+
+	t.Run("path parameter without variable", func(t *testing.T) {
+		router, doc := apiRouter(t)
+		op := doc.Operation(http.MethodDelete, "/users/{id}")
+		op.Parameters = append(op.Parameters, openapi.Parameter{Name: "userId", In: "path", Required: true})
+
+		err := openapi.Verify(doc, router)
+		if err == nil || !strings.Contains(err.Error(), `path parameter "userId" not in route DELETE /users/{id}`) {
+			t.Fatalf("expected path parameter without variable error, got %v", err)
+		}
+	})
+
+	t.Run("optional path parameter", func(t *testing.T) {
+		router, doc := apiRouter(t)
+		op := doc.Operation(http.MethodGet, "/users/{id}")
+		for i := range op.Parameters {
+			if op.Parameters[i].In == "path" {
+				op.Parameters[i].Required = false
+			}
+		}
+
+		err := openapi.Verify(doc, router)
+		if err == nil || !strings.Contains(err.Error(), `path parameter "id" of GET /users/{id} is not required`) {
+			t.Fatalf("expected optional path parameter error, got %v", err)
+		}
+	})
+}
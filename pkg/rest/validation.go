@@ -0,0 +1,160 @@
+package rest
+
+import (
+	"bytes"
+	"crud-without-db/pkg/logger"
+	"crud-without-db/pkg/openapi"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"net/http"
+)
+
+// Validator checks requests (and optionally responses) of documented routes
+// against the OpenAPI document
+type Validator struct {
+	doc               *openapi.Document
+	validateResponses bool
+	maxBodySize       int64
+	auth              map[string]func(http.Handler) http.Handler
+	logger            zerolog.Logger
+}
+
+// NewValidator creates a validator. With validateResponses enabled,
+// responses that do not conform to the document are replaced by a 500
+// problem listing the differences; meant for tests and staging. JSON bodies
+// larger than maxBodySize bytes are rejected with 413.
+func NewValidator(doc *openapi.Document, validateResponses bool, maxBodySize int64) *Validator {
+	return &Validator{
+		doc:               doc,
+		validateResponses: validateResponses,
+		maxBodySize:       maxBodySize,
+		auth:              make(map[string]func(http.Handler) http.Handler),
+		logger:            logger.GetLogger("validation"),
+	}
+}
+
+// Authenticate runs auth before validating requests of operations secured
+// by the named security scheme, so that unauthenticated callers get 401
+// rather than details about the expected input
+func (v *Validator) Authenticate(scheme string, auth func(http.Handler) http.Handler) {
+	v.auth[scheme] = auth
+}
+
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := v.operation(r)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		validate := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			v.validate(op, next, w, r)
+		}))
+		for _, auth := range v.authFor(op) {
+			validate = auth(validate)
+		}
+		validate.ServeHTTP(w, r)
+	})
+}
+
+// authFor returns the auth middlewares of the first security requirement
+// of op whose schemes all have one
+func (v *Validator) authFor(op *openapi.Operation) []func(http.Handler) http.Handler {
+	for _, requirement := range op.Security {
+		var auths []func(http.Handler) http.Handler
+		for scheme := range requirement {
+			if auth, ok := v.auth[scheme]; ok {
+				auths = append(auths, auth)
+			}
+		}
+		if len(auths) > 0 && len(auths) == len(requirement) {
+			return auths
+		}
+	}
+	return nil
+}
+
+func (v *Validator) validate(op *openapi.Operation, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	if status, violations := v.doc.ValidateRequest(op, r, mux.Vars(r), v.maxBodySize); status != 0 {
+		v.logger.Debug().
+			Str("method", r.Method).
+			Str("uri", r.RequestURI).
+			Interface("errors", violations).
+			Msg("Request validation failed")
+		writeProblem(w, status, "Request validation failed", violations)
+		return
+	}
+
+	// Streams can't be buffered for validation
+	if !v.validateResponses || streams(op) {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	rec := &recordingWriter{header: make(http.Header), status: http.StatusOK}
+	next.ServeHTTP(rec, r)
+
+	if violations := v.doc.ValidateResponse(op, rec.status, rec.header, rec.body.Bytes()); len(violations) > 0 {
+		v.logger.Error().
+			Str("method", r.Method).
+			Str("uri", r.RequestURI).
+			Int("status_code", rec.status).
+			Interface("errors", violations).
+			Msg("Response does not match the OpenAPI document")
+		writeProblem(w, http.StatusInternalServerError, "Response validation failed", violations)
+		return
+	}
+
+	for key, values := range rec.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
+}
+
+func (v *Validator) operation(r *http.Request) *openapi.Operation {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+	return v.doc.Operation(r.Method, template)
+}
+
+func streams(op *openapi.Operation) bool {
+	for _, response := range op.Responses {
+		if _, ok := response.Content["text/event-stream"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// recordingWriter buffers a response so it can be validated before sending
+type recordingWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *recordingWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.status = code
+	rw.wroteHeader = true
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.body.Write(p)
+}
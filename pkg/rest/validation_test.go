@@ -0,0 +1,325 @@
+package rest
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/openapi"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testAdminToken  = "admin-token"
+	testMaxBodySize = 128
+)
+
+// fakeUsers keeps users in a map; methods the tests don't call are left to
+// the nil embedded interface
+type fakeUsers struct {
+	Users
+	users   map[int64]domain.User
+	created int
+}
+
+func (f *fakeUsers) Create(ctx context.Context, user domain.User) (domain.User, error) {
+	f.created++
+	user.ID = int64(len(f.users) + 1)
+	user.CreatedAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	user.UpdatedAt = user.CreatedAt
+	f.users[user.ID] = user
+	return user, nil
+}
+
+func (f *fakeUsers) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// validatedRouter wires the users and attributes routes with the validator
+// like main does
+func validatedRouter(t *testing.T, users *fakeUsers, validateResponses bool) *mux.Router {
+	t.Helper()
+
+	h := NewHandler(users, nil, nil)
+	router := h.InitRouter()
+	doc := h.OpenAPI()
+	NewAttributeHandler(testAdminToken, nil).InitRoutes(router, doc)
+
+	validator := NewValidator(doc, validateResponses, testMaxBodySize)
+	validator.Authenticate(AdminTokenScheme, BearerAuth(testAdminToken))
+	router.Use(validator.Middleware)
+	return router
+}
+
+// readTracker fails the test when the body is read
+type readTracker struct {
+	t *testing.T
+}
+
+func (r readTracker) Read(p []byte) (int, error) {
+	r.t.Error("body of an unsupported media type was read")
+	return 0, io.EOF
+}
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) problem {
+	t.Helper()
+
+	if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Fatalf("Content-Type = %q, want application/problem+json", got)
+	}
+	var p problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("failed to decode problem %s: %v", rec.Body, err)
+	}
+	return p
+}
+
+func TestValidatorRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		violations  []openapi.Violation
+	}{
+		{
+			name:        "valid",
+			method:      http.MethodPost,
+			path:        "/users",
+			contentType: "application/json",
+			body:        `{"name":"Ann","age":30,"sex":"female"}`,
+			status:      http.StatusCreated,
+		},
+		{
+			name:        "readOnly required fields are skipped",
+			method:      http.MethodPost,
+			path:        "/users",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name":"Ann","age":30,"sex":"female","id":7}`,
+			status:      http.StatusCreated,
+		},
+		{
+			name:        "body violations by pointer",
+			method:      http.MethodPost,
+			path:        "/users",
+			contentType: "application/json",
+			body:        `{"name":"","age":200,"addresses":["home"]}`,
+			status:      http.StatusBadRequest,
+			violations: []openapi.Violation{
+				{In: "body", Pointer: "/sex", Detail: "is required"},
+				{In: "body", Pointer: "/addresses/0", Detail: "must be of type object"},
+				{In: "body", Pointer: "/age", Detail: "must be less than or equal to 149"},
+				{In: "body", Pointer: "/name", Detail: "must be at least 1 characters long"},
+			},
+		},
+		{
+			name:        "wrong root type",
+			method:      http.MethodPost,
+			path:        "/users",
+			contentType: "application/json",
+			body:        `[]`,
+			status:      http.StatusBadRequest,
+			violations:  []openapi.Violation{{In: "body", Detail: "must be of type object"}},
+		},
+		{
+			name:        "invalid JSON",
+			method:      http.MethodPost,
+			path:        "/users",
+			contentType: "application/json",
+			body:        `{"name":`,
+			status:      http.StatusBadRequest,
+			violations:  []openapi.Violation{{In: "body", Detail: "invalid JSON: unexpected EOF"}},
+		},
+		{
+			name:        "missing body",
+			method:      http.MethodPost,
+			path:        "/users",
+			contentType: "application/json",
+			status:      http.StatusBadRequest,
+			violations:  []openapi.Violation{{In: "body", Detail: "is required"}},
+		},
+		{
+			name:   "path parameter",
+			method: http.MethodGet,
+			path:   "/users/abc",
+			status: http.StatusBadRequest,
+			violations: []openapi.Violation{
+				{In: "path", Name: "id", Detail: "must be an integer"},
+			},
+		},
+		{
+			name:        "too large",
+			method:      http.MethodPost,
+			path:        "/users",
+			contentType: "application/json",
+			body:        `{"name":"` + strings.Repeat("a", testMaxBodySize) + `","age":30,"sex":"female"}`,
+			status:      http.StatusRequestEntityTooLarge,
+			violations:  []openapi.Violation{{In: "body", Detail: "must be at most 128 bytes"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUsers{users: map[int64]domain.User{}}
+			router := validatedRouter(t, users, false)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.violations == nil {
+				if rec.Code == http.StatusCreated && users.created != 1 {
+					t.Errorf("handler created %d users, want 1", users.created)
+				}
+				return
+			}
+
+			if users.created != 0 {
+				t.Errorf("handler created %d users, want none", users.created)
+			}
+			p := decodeProblem(t, rec)
+			if p.Status != tt.status || p.Detail != "Request validation failed" {
+				t.Errorf("problem = %+v, want status %d", p, tt.status)
+			}
+			if len(p.Errors) != len(tt.violations) {
+				t.Fatalf("violations = %+v, want %+v", p.Errors, tt.violations)
+			}
+			for i := range tt.violations {
+				if p.Errors[i] != tt.violations[i] {
+					t.Errorf("violation %d = %+v, want %+v", i, p.Errors[i], tt.violations[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidatorUnsupportedMediaType(t *testing.T) {
+	users := &fakeUsers{users: map[int64]domain.User{}}
+	router := validatedRouter(t, users, false)
+
+	req := httptest.NewRequest(http.MethodPost, "/users", readTracker{t})
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+	p := decodeProblem(t, rec)
+	want := openapi.Violation{In: "header", Name: "Content-Type", Detail: `unsupported media type "text/plain", expected one of application/json`}
+	if len(p.Errors) != 1 || p.Errors[0] != want {
+		t.Errorf("violations = %+v, want %+v", p.Errors, want)
+	}
+}
+
+func TestValidatorAuthenticatesBeforeValidating(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"without token", "", http.StatusUnauthorized},
+		{"wrong token", "wrong", http.StatusUnauthorized},
+		{"admin token", testAdminToken, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := validatedRouter(t, &fakeUsers{users: map[int64]domain.User{}}, false)
+
+			req := httptest.NewRequest(http.MethodPut, "/attributes/plan", strings.NewReader(`{"type":"color"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && rec.Body.Len() != 0 {
+				t.Errorf("unauthenticated response has a body: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestValidatorResponses(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	users := &fakeUsers{users: map[int64]domain.User{
+		1: {ID: 1, Name: "Ann", Age: 30, Sex: "female", CreatedAt: created, UpdatedAt: created},
+		2: {ID: 2, Name: "Bob", Age: 0, Sex: "robot", CreatedAt: created, UpdatedAt: created},
+	}}
+
+	tests := []struct {
+		name       string
+		path       string
+		status     int
+		violations []openapi.Violation
+	}{
+		{name: "conforming", path: "/users/1", status: http.StatusOK},
+		{name: "documented error status", path: "/users/3", status: http.StatusNotFound},
+		{
+			name:   "nonconforming body",
+			path:   "/users/2",
+			status: http.StatusInternalServerError,
+			violations: []openapi.Violation{
+				{In: "response", Pointer: "/age", Detail: "must be greater than or equal to 1"},
+				{In: "response", Pointer: "/sex", Detail: "must be one of [male female other]"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := validatedRouter(t, users, true)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.violations == nil {
+				if tt.status == http.StatusOK {
+					var user domain.User
+					if err := json.Unmarshal(rec.Body.Bytes(), &user); err != nil || user.ID != 1 {
+						t.Errorf("body = %s, want user 1", rec.Body)
+					}
+				}
+				return
+			}
+
+			p := decodeProblem(t, rec)
+			if p.Detail != "Response validation failed" {
+				t.Errorf("detail = %q, want Response validation failed", p.Detail)
+			}
+			if len(p.Errors) != len(tt.violations) {
+				t.Fatalf("violations = %+v, want %+v", p.Errors, tt.violations)
+			}
+			for i := range tt.violations {
+				if p.Errors[i] != tt.violations[i] {
+					t.Errorf("violation %d = %+v, want %+v", i, p.Errors[i], tt.violations[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,443 @@
+package rest
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/logger"
+	"crud-without-db/pkg/openapi"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+type Webhooks interface {
+	Create(ctx context.Context, sub domain.WebhookSubscription) (domain.WebhookSubscription, error)
+	Get(ctx context.Context, id int64) (domain.WebhookSubscription, error)
+	List(ctx context.Context) ([]domain.WebhookSubscription, error)
+	Update(ctx context.Context, id int64, sub domain.WebhookSubscription) (domain.WebhookSubscription, error)
+	Delete(ctx context.Context, id int64) error
+	Deliveries(ctx context.Context, subscriptionID int64, status domain.DeliveryStatus, limit int) ([]domain.WebhookDelivery, error)
+	RetryDelivery(ctx context.Context, subscriptionID, deliveryID int64) error
+}
+
+// WebhookHandler manages webhook subscriptions. Subscriptions make the
+// server call arbitrary URLs, so the routes require the admin token.
+type WebhookHandler struct {
+	token    string
+	webhooks Webhooks
+	logger   zerolog.Logger
+}
+
+func NewWebhookHandler(token string, webhooks Webhooks) *WebhookHandler {
+	return &WebhookHandler{
+		token:    token,
+		webhooks: webhooks,
+		logger:   logger.GetLogger("webhooks"),
+	}
+}
+
+// InitRoutes registers the webhook routes and documents them. Nothing is
+// registered when no token is configured.
+func (h *WebhookHandler) InitRoutes(r *mux.Router, doc *openapi.Document) {
+	if h.token == "" {
+		h.logger.Warn().Msg("Admin token is not set, webhook endpoints are disabled")
+		return
+	}
+
+	webhooks := r.PathPrefix("/webhooks").Subrouter()
+	webhooks.Use(BearerAuth(h.token))
+
+	addAdminTokenScheme(doc)
+	doc.Tags = append(doc.Tags, openapi.Tag{Name: "webhooks", Description: "Outgoing webhooks on user events"})
+
+	for _, route := range h.routes() {
+		webhooks.HandleFunc(route.path, route.handler).Methods(route.method)
+		op := route.op(doc)
+		op.Security = []openapi.SecurityRequirement{{AdminTokenScheme: {}}}
+		op.Responses["401"] = &openapi.Response{Description: "Unauthorized"}
+		doc.AddOperation(route.method, "/webhooks"+route.path, op)
+	}
+}
+
+func (h *WebhookHandler) routes() []route {
+	subscriptionIDParameter := openapi.Parameter{
+		Name:        "id",
+		In:          "path",
+		Description: "Subscription ID",
+		Required:    true,
+		Schema:      &openapi.Schema{Type: openapi.TypeSet{"integer"}, Format: "int64", Minimum: float64Ptr(1)},
+	}
+
+	return []route{
+		{
+			method:  http.MethodGet,
+			path:    "",
+			handler: h.listSubscriptions,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "listWebhooks",
+					Summary:     "List webhook subscriptions",
+					Tags:        []string{"webhooks"},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(openapi.ArrayOf(doc.SchemaOf(domain.WebhookSubscription{})))},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodPost,
+			path:    "",
+			handler: h.createSubscription,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "createWebhook",
+					Summary:     "Create a webhook subscription",
+					Description: "Deliveries are signed with the secret, see the X-Webhook-Signature header. " +
+						"A secret is generated when none is given; it is only returned by this call.",
+					Tags: []string{"webhooks"},
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content:  openapi.JSONContent(doc.SchemaOf(domain.WebhookSubscription{})),
+					},
+					Responses: map[string]*openapi.Response{
+						"201": {Description: "Created", Content: openapi.JSONContent(doc.SchemaOf(domain.WebhookSubscription{}))},
+						"400": {Description: "Bad Request"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/{id}",
+			handler: h.getSubscription,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "getWebhook",
+					Summary:     "Get a webhook subscription",
+					Tags:        []string{"webhooks"},
+					Parameters:  []openapi.Parameter{subscriptionIDParameter},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.WebhookSubscription{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodPut,
+			path:    "/{id}",
+			handler: h.updateSubscription,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "updateWebhook",
+					Summary:     "Update a webhook subscription",
+					Description: "Replaces the subscription; an empty secret keeps the current one.",
+					Tags:        []string{"webhooks"},
+					Parameters:  []openapi.Parameter{subscriptionIDParameter},
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content:  openapi.JSONContent(doc.SchemaOf(domain.WebhookSubscription{})),
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(doc.SchemaOf(domain.WebhookSubscription{}))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodDelete,
+			path:    "/{id}",
+			handler: h.deleteSubscription,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "deleteWebhook",
+					Summary:     "Delete a webhook subscription and its deliveries",
+					Tags:        []string{"webhooks"},
+					Parameters:  []openapi.Parameter{subscriptionIDParameter},
+					Responses: map[string]*openapi.Response{
+						"204": {Description: "No Content"},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/{id}/deliveries",
+			handler: h.listDeliveries,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "listWebhookDeliveries",
+					Summary:     "Delivery log of a subscription",
+					Description: "Newest deliveries first. Dead deliveries ran out of attempts and can be retried.",
+					Tags:        []string{"webhooks"},
+					Parameters: []openapi.Parameter{
+						subscriptionIDParameter,
+						{
+							Name:   "status",
+							In:     "query",
+							Schema: &openapi.Schema{Type: openapi.TypeSet{"string"}, Enum: []interface{}{"pending", "delivered", "dead"}},
+						},
+						{
+							Name:   "limit",
+							In:     "query",
+							Schema: &openapi.Schema{Type: openapi.TypeSet{"integer"}, Minimum: float64Ptr(1), Maximum: float64Ptr(maxDeliveriesLimit)},
+						},
+					},
+					Responses: map[string]*openapi.Response{
+						"200": {Description: "OK", Content: openapi.JSONContent(openapi.ArrayOf(doc.SchemaOf(domain.WebhookDelivery{})))},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+		{
+			method:  http.MethodPost,
+			path:    "/{id}/deliveries/{delivery_id}/retry",
+			handler: h.retryDelivery,
+			op: func(doc *openapi.Document) *openapi.Operation {
+				return &openapi.Operation{
+					OperationID: "retryWebhookDelivery",
+					Summary:     "Requeue a delivery",
+					Description: "Queues the delivery for immediate sending with a fresh attempt budget.",
+					Tags:        []string{"webhooks"},
+					Parameters: []openapi.Parameter{
+						subscriptionIDParameter,
+						{
+							Name:     "delivery_id",
+							In:       "path",
+							Required: true,
+							Schema:   &openapi.Schema{Type: openapi.TypeSet{"integer"}, Format: "int64", Minimum: float64Ptr(1)},
+						},
+					},
+					Responses: map[string]*openapi.Response{
+						"202": {Description: "Accepted"},
+						"400": {Description: "Bad Request"},
+						"404": {Description: "Not Found"},
+						"500": {Description: "Internal Server Error"},
+					},
+				}
+			},
+		},
+	}
+}
+
+func (h *WebhookHandler) listSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.webhooks.List(r.Context())
+	if err != nil {
+		h.logger.Error().Err(err).Str("method", "listSubscriptions").Msg("Failed to list webhook subscriptions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if subs == nil {
+		subs = []domain.WebhookSubscription{}
+	}
+	h.writeJSON(w, http.StatusOK, subs)
+}
+
+func (h *WebhookHandler) createSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.readSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := h.webhooks.Create(r.Context(), sub)
+	if err != nil {
+		h.writeError(w, err, "createSubscription")
+		return
+	}
+
+	h.logger.Info().Int64("subscription_id", created.ID).Str("url", created.URL).Msg("Webhook subscription created")
+	w.Header().Set("Location", "/webhooks/"+strconv.FormatInt(created.ID, 10))
+	h.writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *WebhookHandler) getSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.webhooks.Get(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err, "getSubscription")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, sub)
+}
+
+func (h *WebhookHandler) updateSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	sub, ok := h.readSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := h.webhooks.Update(r.Context(), id, sub)
+	if err != nil {
+		h.writeError(w, err, "updateSubscription")
+		return
+	}
+
+	h.logger.Info().Int64("subscription_id", id).Msg("Webhook subscription updated")
+	h.writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *WebhookHandler) deleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.webhooks.Delete(r.Context(), id); err != nil {
+		h.writeError(w, err, "deleteSubscription")
+		return
+	}
+
+	h.logger.Info().Int64("subscription_id", id).Msg("Webhook subscription deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) listDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	status := domain.DeliveryStatus(query.Get("status"))
+	switch status {
+	case "", domain.DeliveryPending, domain.DeliveryDelivered, domain.DeliveryDead:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultDeliveriesLimit
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxDeliveriesLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	deliveries, err := h.webhooks.Deliveries(r.Context(), id, status, limit)
+	if err != nil {
+		h.writeError(w, err, "listDeliveries")
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = []domain.WebhookDelivery{}
+	}
+	h.writeJSON(w, http.StatusOK, deliveries)
+}
+
+func (h *WebhookHandler) retryDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	deliveryID, err := pathID(r, "delivery_id")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.webhooks.RetryDelivery(r.Context(), id, deliveryID); err != nil {
+		h.writeError(w, err, "retryDelivery")
+		return
+	}
+
+	h.logger.Info().Int64("subscription_id", id).Int64("delivery_id", deliveryID).Msg("Webhook delivery requeued")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *WebhookHandler) readSubscription(w http.ResponseWriter, r *http.Request) (domain.WebhookSubscription, bool) {
+	var sub domain.WebhookSubscription
+
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to read request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return sub, false
+	}
+
+	if err = json.Unmarshal(reqBytes, &sub); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to unmarshal webhook subscription")
+		w.WriteHeader(http.StatusBadRequest)
+		return sub, false
+	}
+
+	return sub, true
+}
+
+func (h *WebhookHandler) writeError(w http.ResponseWriter, err error, method string) {
+	var validationErr *domain.ValidationError
+	switch {
+	case errors.Is(err, domain.ErrWebhookNotFound), errors.Is(err, domain.ErrDeliveryNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.As(err, &validationErr):
+		h.logger.Warn().Err(err).Str("method", method).Msg("Invalid webhook subscription")
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		h.logger.Error().Err(err).Str("method", method).Msg("Webhook request failed")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (h *WebhookHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal webhook response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+func pathID(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)[name], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if id < 1 {
+		return 0, errors.New("id must be positive")
+	}
+	return id, nil
+}
@@ -0,0 +1,288 @@
+package rest
+
+import (
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/events"
+	"crud-without-db/pkg/logger"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// wsProtocol is the application subprotocol selected on handshake
+	wsProtocol = "users.v1"
+
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = wsPongWait * 9 / 10
+	wsMaxMessageSize = 4096
+	// wsMaxSubscriptions limits subscriptions per connection
+	wsMaxSubscriptions = 100
+	// wsReplyBuffer is the number of queued replies before a client that
+	// doesn't read them is dropped
+	wsReplyBuffer = 16
+)
+
+// wsMessage is sent by clients to manage subscriptions:
+//
+//	{"type": "subscribe", "id": "a", "filter": {"user_ids": [1, 2], "types": ["updated"]}}
+//	{"type": "unsubscribe", "id": "a"}
+type wsMessage struct {
+	Type   string   `json:"type"`
+	ID     string   `json:"id"`
+	Filter wsFilter `json:"filter"`
+}
+
+type wsFilter struct {
+	UserIDs []int64            `json:"user_ids,omitempty"`
+	Types   []domain.EventType `json:"types,omitempty"`
+}
+
+// wsReply is sent to clients. Events list the IDs of every subscription
+// they match, so each event is delivered once per connection.
+type wsReply struct {
+	Type          string            `json:"type"` // "subscribed", "unsubscribed", "event" or "error"
+	ID            string            `json:"id,omitempty"`
+	Subscriptions []string          `json:"subscriptions,omitempty"`
+	EventID       string            `json:"event_id,omitempty"`
+	Event         *domain.UserEvent `json:"event,omitempty"`
+	Message       string            `json:"message,omitempty"`
+}
+
+// WebSocketHandler serves live user updates at /ws. Clients manage their
+// own subscriptions on a single connection; connections that don't keep up
+// with events or pings are closed.
+type WebSocketHandler struct {
+	token    string
+	events   UserEvents
+	upgrader websocket.Upgrader
+	logger   zerolog.Logger
+}
+
+// NewWebSocketHandler creates the handler. Browser handshakes are accepted
+// from the given origins, matched like CORS origins.
+func NewWebSocketHandler(token string, userEvents UserEvents, allowedOrigins []string) (*WebSocketHandler, error) {
+	origins, err := newOriginMatcher(allowedOrigins, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebSocketHandler{
+		token:  token,
+		events: userEvents,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{wsProtocol},
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				return origin == "" || origins.allowed(origin)
+			},
+		},
+		logger: logger.GetLogger("websocket"),
+	}, nil
+}
+
+// InitRoutes registers /ws behind the same bearer authentication as the
+// admin endpoints. Browsers pass the token by offering the subprotocols
+// "users.v1" and "bearer.<token>". Nothing is registered when no token is
+// configured.
+func (h *WebSocketHandler) InitRoutes(r *mux.Router) {
+	if h.token == "" {
+		h.logger.Warn().Msg("Admin token is not set, WebSocket endpoint is disabled")
+		return
+	}
+
+	r.Handle("/ws", BearerAuth(h.token)(http.HandlerFunc(h.serveWS))).Methods("GET")
+}
+
+func (h *WebSocketHandler) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied with an error status
+		h.logger.Warn().Err(err).Str("remote_addr", r.RemoteAddr).Msg("WebSocket handshake failed")
+		return
+	}
+
+	c := &wsConn{
+		conn:          conn,
+		replies:       make(chan wsReply, wsReplyBuffer),
+		subscriptions: make(map[string]events.Filter),
+		done:          make(chan struct{}),
+		logger:        h.logger.With().Str("remote_addr", r.RemoteAddr).Logger(),
+	}
+	// Filtering happens per connection, the broker subscription takes everything
+	sub, _, _ := h.events.Subscribe(events.Filter{}, "")
+
+	c.logger.Info().Msg("WebSocket connection opened")
+	go c.writePump(sub)
+	c.readPump()
+	c.logger.Info().Msg("WebSocket connection closed")
+}
+
+type wsConn struct {
+	conn    *websocket.Conn
+	replies chan wsReply
+
+	mu            sync.Mutex
+	subscriptions map[string]events.Filter
+
+	done      chan struct{}
+	closeOnce sync.Once
+	logger    zerolog.Logger
+}
+
+// readPump handles subscription messages and pongs until the connection fails
+func (c *wsConn) readPump() {
+	defer c.close()
+
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				c.logger.Warn().Err(err).Msg("WebSocket read failed")
+			}
+			return
+		}
+
+		// Messages that don't decode get an error, the connection stays open
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			message := "invalid message"
+			if _, ok := err.(*json.SyntaxError); ok {
+				message = "invalid JSON"
+			}
+			c.reply(wsReply{Type: "error", Message: message})
+			continue
+		}
+
+		if reply, err := c.handle(msg); err != nil {
+			c.reply(wsReply{Type: "error", ID: msg.ID, Message: err.Error()})
+		} else {
+			c.reply(reply)
+		}
+	}
+}
+
+func (c *wsConn) handle(msg wsMessage) (wsReply, error) {
+	if msg.ID == "" {
+		return wsReply{}, fmt.Errorf("id is required")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch msg.Type {
+	case "subscribe":
+		for _, t := range msg.Filter.Types {
+			if t != domain.EventUserCreated && t != domain.EventUserUpdated && t != domain.EventUserDeleted {
+				return wsReply{}, fmt.Errorf("unknown event type %q", t)
+			}
+		}
+		if _, ok := c.subscriptions[msg.ID]; !ok && len(c.subscriptions) >= wsMaxSubscriptions {
+			return wsReply{}, fmt.Errorf("at most %d subscriptions per connection", wsMaxSubscriptions)
+		}
+		c.subscriptions[msg.ID] = events.Filter{UserIDs: msg.Filter.UserIDs, Types: msg.Filter.Types}
+		return wsReply{Type: "subscribed", ID: msg.ID}, nil
+	case "unsubscribe":
+		if _, ok := c.subscriptions[msg.ID]; !ok {
+			return wsReply{}, fmt.Errorf("unknown subscription %q", msg.ID)
+		}
+		delete(c.subscriptions, msg.ID)
+		return wsReply{Type: "unsubscribed", ID: msg.ID}, nil
+	}
+	return wsReply{}, fmt.Errorf("unknown message type %q", msg.Type)
+}
+
+// reply queues a message for the client, dropping clients that stopped reading
+func (c *wsConn) reply(reply wsReply) {
+	select {
+	case c.replies <- reply:
+	case <-c.done:
+	default:
+		c.logger.Warn().Msg("Dropping WebSocket client that doesn't read replies")
+		c.close()
+	}
+}
+
+// writePump is the only writer of the connection: replies, matching events
+// and pings. Slow clients are closed either by the broker (queue full) or
+// by the write deadline.
+func (c *wsConn) writePump(sub *events.Subscription) {
+	ping := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ping.Stop()
+		sub.Close()
+		c.close()
+	}()
+
+	for {
+		var err error
+		select {
+		case <-c.done:
+			return
+		case <-sub.Done():
+			code, text := websocket.CloseGoingAway, "server is shutting down"
+			switch sub.Err() {
+			case events.ErrSlowConsumer:
+				code, text = websocket.CloseTryAgainLater, "too slow to receive events"
+			case events.ErrReset:
+				code, text = websocket.CloseServiceRestart, "changes may have been missed, reload"
+			}
+			c.logger.Info().Err(sub.Err()).Msg("Closing WebSocket connection")
+			c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteWait))
+			return
+		case reply := <-c.replies:
+			err = c.write(reply)
+		case event := <-sub.Events():
+			if matched := c.match(event.UserEvent); len(matched) > 0 {
+				userEvent := event.UserEvent
+				err = c.write(wsReply{Type: "event", Subscriptions: matched, EventID: event.ID(), Event: &userEvent})
+			}
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			err = c.conn.WriteMessage(websocket.PingMessage, nil)
+		}
+		if err != nil {
+			c.logger.Warn().Err(err).Msg("WebSocket write failed")
+			return
+		}
+	}
+}
+
+func (c *wsConn) write(reply wsReply) error {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.conn.WriteJSON(reply)
+}
+
+func (c *wsConn) match(event domain.UserEvent) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matched []string
+	for id, filter := range c.subscriptions {
+		if filter.Match(event) {
+			matched = append(matched, id)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+func (c *wsConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
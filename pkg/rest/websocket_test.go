@@ -0,0 +1,64 @@
+package rest
+
+import (
+	"crud-without-db/pkg/events"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialWS starts /ws on a test server and connects with the admin token
+func dialWS(t *testing.T) *websocket.Conn {
+	t.Helper()
+
+	h, err := NewWebSocketHandler(testAdminToken, events.NewBroker(events.Config{SubscriberBuffer: 8}), nil)
+	if err != nil {
+		t.Fatalf("NewWebSocketHandler: %v", err)
+	}
+	router := mux.NewRouter()
+	h.InitRoutes(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	header := http.Header{"Authorization": {"Bearer " + testAdminToken}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestWebSocketRepliesToInvalidMessages(t *testing.T) {
+	conn := dialWS(t)
+
+	messages := []struct {
+		msg  string
+		want wsReply
+	}{
+		{`{"type":`, wsReply{Type: "error", Message: "invalid JSON"}},
+		{`{"type":1}`, wsReply{Type: "error", Message: "invalid message"}},
+		{`{"type":"subscribe","id":"a","filter":{"user_ids":["1"]}}`, wsReply{Type: "error", Message: "invalid message"}},
+		{`{"type":"subscribe"}`, wsReply{Type: "error", Message: "id is required"}},
+		// The connection is still read after the failures
+		{`{"type":"subscribe","id":"a"}`, wsReply{Type: "subscribed", ID: "a"}},
+	}
+
+	for _, m := range messages {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(m.msg)); err != nil {
+			t.Fatalf("write %s: %v", m.msg, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var reply wsReply
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("read reply to %s: %v", m.msg, err)
+		}
+		if reply.Type != m.want.Type || reply.ID != m.want.ID || reply.Message != m.want.Message {
+			t.Errorf("reply to %s = %+v, want %+v", m.msg, reply, m.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Package search implements the name matching used by user search: prefix
+// full-text matching of words plus trigram word similarity for misspellings.
+// It follows PostgreSQL's 'simple' text search configuration and pg_trgm, so
+// backends without them rank results the same way.
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// SimilarityThreshold is the word similarity from which a text matches a
+// query that isn't a prefix of its words, like pg_trgm's
+// word_similarity_threshold
+const SimilarityThreshold = 0.3
+
+// Token is a lowercased word of a text with its byte offsets
+type Token struct {
+	Text       string
+	Start, End int
+}
+
+// Tokenize splits text into words of letters and digits
+func Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			tokens = append(tokens, Token{Text: strings.ToLower(text[start:i]), Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, Token{Text: strings.ToLower(text[start:]), Start: start, End: len(text)})
+	}
+	return tokens
+}
+
+// Terms returns the lowercased words of text
+func Terms(text string) []string {
+	tokens := Tokenize(text)
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = token.Text
+	}
+	return terms
+}
+
+// Trigrams returns the distinct trigrams of a word the way pg_trgm does,
+// padded with two spaces in front and one behind
+func Trigrams(word string) []string {
+	runes := []rune("  " + strings.ToLower(word) + " ")
+	seen := make(map[string]bool, len(runes))
+	var trigrams []string
+	for i := 0; i+3 <= len(runes); i++ {
+		trigram := string(runes[i : i+3])
+		if !seen[trigram] {
+			seen[trigram] = true
+			trigrams = append(trigrams, trigram)
+		}
+	}
+	return trigrams
+}
+
+// PrefixMatch reports whether every query term starts a word of the text,
+// like a tsquery of "term:*" joined with &
+func PrefixMatch(queryTerms, textTerms []string) bool {
+	if len(queryTerms) == 0 {
+		return false
+	}
+	for _, q := range queryTerms {
+		if !hasPrefixTerm(textTerms, q) {
+			return false
+		}
+	}
+	return true
+}
+
+// WordSimilarity is the share of query trigrams found in the best matching
+// word of the text, averaged over the query terms. It approximates
+// pg_trgm's word_similarity(query, text).
+func WordSimilarity(queryTerms, textTerms []string) float64 {
+	if len(queryTerms) == 0 {
+		return 0
+	}
+	var total float64
+	for _, q := range queryTerms {
+		var best float64
+		for _, t := range textTerms {
+			if s := termSimilarity(q, t); s > best {
+				best = s
+			}
+		}
+		total += best
+	}
+	return total / float64(len(queryTerms))
+}
+
+// Rank orders matches: prefix matches first, then by word similarity
+func Rank(prefixMatch bool, similarity float64) float64 {
+	if prefixMatch {
+		return 1 + similarity
+	}
+	return similarity
+}
+
+// Highlight returns text HTML-escaped, with the words matching the query
+// wrapped in <mark> tags
+func Highlight(text, query string) string {
+	queryTerms := Terms(query)
+
+	var b strings.Builder
+	last := 0
+	for _, token := range Tokenize(text) {
+		if !matchesTerm(token.Text, queryTerms) {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[last:token.Start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[token.Start:token.End]))
+		b.WriteString("</mark>")
+		last = token.End
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+func matchesTerm(word string, queryTerms []string) bool {
+	for _, q := range queryTerms {
+		if strings.HasPrefix(word, q) || termSimilarity(q, word) >= SimilarityThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefixTerm(terms []string, prefix string) bool {
+	for _, t := range terms {
+		if strings.HasPrefix(t, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// termSimilarity is the share of the query term's trigrams found in the word
+func termSimilarity(query, word string) float64 {
+	queryTrigrams := Trigrams(query)
+	if len(queryTrigrams) == 0 {
+		return 0
+	}
+	wordTrigrams := make(map[string]bool)
+	for _, t := range Trigrams(word) {
+		wordTrigrams[t] = true
+	}
+	common := 0
+	for _, t := range queryTrigrams {
+		if wordTrigrams[t] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(queryTrigrams))
+}
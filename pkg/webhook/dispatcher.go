@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crud-without-db/internal/domain"
+	"crud-without-db/pkg/logger"
+	"fmt"
+	"github.com/rs/zerolog"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store is the durable delivery queue
+type Store interface {
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookTask, error)
+	RecordAttempt(ctx context.Context, id int64, status domain.DeliveryStatus, responseStatus int, attemptErr string, nextAttempt time.Time) error
+}
+
+type Config struct {
+	PollInterval   time.Duration
+	BatchSize      int
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+}
+
+// Dispatcher sends due deliveries, retrying failures with exponential
+// backoff and dead-lettering them after MaxAttempts
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	config Config
+	logger zerolog.Logger
+}
+
+// NewDispatcher creates a dispatcher. The client must not follow redirects
+// to keep deliveries on the subscribed URL; nil uses such a client with the
+// configured timeout.
+func NewDispatcher(store Store, client *http.Client, config Config) *Dispatcher {
+	if client == nil {
+		client = &http.Client{
+			Timeout: config.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	return &Dispatcher{
+		store:  store,
+		client: client,
+		config: config,
+		logger: logger.GetLogger("webhooks"),
+	}
+}
+
+// Run dispatches deliveries until the context is canceled. Full batches are
+// followed immediately by the next one to drain backlogs quickly.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			if d.dispatch(ctx) < d.config.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch sends one batch concurrently and returns its size
+func (d *Dispatcher) dispatch(ctx context.Context) int {
+	// The lease covers the request and recording the result
+	tasks, err := d.store.ClaimDeliveries(ctx, d.config.BatchSize, 2*d.config.Timeout+time.Minute)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.logger.Error().Err(err).Msg("Failed to claim webhook deliveries")
+		}
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task domain.WebhookTask) {
+			defer wg.Done()
+			d.deliver(ctx, task)
+		}(task)
+	}
+	wg.Wait()
+
+	return len(tasks)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, task domain.WebhookTask) {
+	delivery := task.Delivery
+	attempt := delivery.Attempts + 1
+
+	responseStatus, err := d.send(ctx, task)
+	status := domain.DeliveryDelivered
+	var nextAttempt time.Time
+	attemptErr := ""
+	if err != nil {
+		attemptErr = err.Error()
+		status = domain.DeliveryPending
+		nextAttempt = time.Now().Add(d.backoff(attempt))
+		if attempt >= d.config.MaxAttempts {
+			status = domain.DeliveryDead
+		}
+	}
+
+	// Record the outcome even when shutting down, the request already happened
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := d.store.RecordAttempt(recordCtx, delivery.ID, status, responseStatus, attemptErr, nextAttempt); err != nil {
+		d.logger.Error().Err(err).Int64("delivery_id", delivery.ID).Msg("Failed to record webhook delivery attempt")
+		return
+	}
+
+	event := d.logger.Info()
+	switch status {
+	case domain.DeliveryPending:
+		event = d.logger.Warn().Err(err).Time("next_attempt_at", nextAttempt)
+	case domain.DeliveryDead:
+		event = d.logger.Error().Err(err)
+	}
+	event.
+		Int64("delivery_id", delivery.ID).
+		Int64("subscription_id", delivery.SubscriptionID).
+		Int("attempt", attempt).
+		Int("response_status", responseStatus).
+		Str("status", string(status)).
+		Msg("Webhook delivery attempted")
+}
+
+// send posts the signed payload, any 2xx response counts as delivered
+func (d *Dispatcher) send(ctx context.Context, task domain.WebhookTask) (int, error) {
+	body := []byte(task.Delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, task.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "crud-without-db-webhooks/1.0")
+	req.Header.Set(HeaderDeliveryID, strconv.FormatInt(task.Delivery.ID, 10))
+	req.Header.Set(HeaderEvent, string(task.Delivery.EventType))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(task.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff doubles the delay with every attempt, with up to 20% jitter so
+// that retries of a failing receiver are spread out
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := float64(d.config.InitialBackoff) * math.Pow(2, float64(attempt-1))
+	if delay > float64(d.config.MaxBackoff) {
+		delay = float64(d.config.MaxBackoff)
+	}
+	return time.Duration(delay * (1 - 0.2*rand.Float64()))
+}
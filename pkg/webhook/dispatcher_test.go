@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"context"
+	"crud-without-db/internal/domain"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef"
+
+// attempt is an attempt recorded by testStore
+type attempt struct {
+	status         domain.DeliveryStatus
+	responseStatus int
+	err            string
+	delay          time.Duration
+}
+
+// testStore is a queue of a single delivery, claimable while pending
+type testStore struct {
+	mu       sync.Mutex
+	task     domain.WebhookTask
+	attempts []attempt
+}
+
+func newTestStore(url string) *testStore {
+	return &testStore{task: domain.WebhookTask{
+		Delivery: domain.WebhookDelivery{
+			ID:             7,
+			SubscriptionID: 3,
+			EventType:      domain.EventUserCreated,
+			Payload:        `{"type":"created","user":{"id":1}}`,
+			Status:         domain.DeliveryPending,
+		},
+		URL:    url,
+		Secret: testSecret,
+	}}
+}
+
+func (s *testStore) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.task.Delivery.Status != domain.DeliveryPending {
+		return nil, nil
+	}
+	return []domain.WebhookTask{s.task}, nil
+}
+
+func (s *testStore) RecordAttempt(ctx context.Context, id int64, status domain.DeliveryStatus, responseStatus int, attemptErr string, nextAttempt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var delay time.Duration
+	if !nextAttempt.IsZero() {
+		delay = time.Until(nextAttempt)
+	}
+	s.attempts = append(s.attempts, attempt{status: status, responseStatus: responseStatus, err: attemptErr, delay: delay})
+	s.task.Delivery.Status = status
+	s.task.Delivery.Attempts++
+	return nil
+}
+
+// receivedRequest is a delivery as seen by the receiver
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver starts a test server answering with the given statuses in turn,
+// repeating the last one
+func receiver(t *testing.T, statuses ...int) (*httptest.Server, func() []receivedRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var received []receivedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		received = append(received, receivedRequest{header: r.Header.Clone(), body: body})
+		status := statuses[min(len(received), len(statuses))-1]
+		mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedRequest(nil), received...)
+	}
+}
+
+func testConfig() Config {
+	return Config{
+		PollInterval:   time.Second,
+		BatchSize:      10,
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     3 * time.Second,
+		Timeout:        5 * time.Second,
+	}
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	server, received := receiver(t, http.StatusNoContent)
+	store := newTestStore(server.URL)
+	dispatcher := NewDispatcher(store, nil, testConfig())
+
+	if n := dispatcher.dispatch(context.Background()); n != 1 {
+		t.Fatalf("dispatched %d deliveries, want 1", n)
+	}
+
+	requests := received()
+	if len(requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+	if string(req.body) != store.task.Delivery.Payload {
+		t.Errorf("body = %s, want %s", req.body, store.task.Delivery.Payload)
+	}
+	if got := req.header.Get(HeaderDeliveryID); got != "7" {
+		t.Errorf("%s = %q, want 7", HeaderDeliveryID, got)
+	}
+	if got := req.header.Get(HeaderEvent); got != string(domain.EventUserCreated) {
+		t.Errorf("%s = %q, want %s", HeaderEvent, got, domain.EventUserCreated)
+	}
+
+	signature, timestamp := req.header.Get(HeaderSignature), req.header.Get(HeaderTimestamp)
+	if !Verify(testSecret, signature, timestamp, req.body, time.Minute) {
+		t.Errorf("signature %q of timestamp %q does not verify", signature, timestamp)
+	}
+	if Verify("another secret of 16", signature, timestamp, req.body, time.Minute) {
+		t.Error("signature verifies with another secret")
+	}
+	if Verify(testSecret, signature, timestamp, append(req.body, ' '), time.Minute) {
+		t.Error("signature verifies a modified body")
+	}
+	ts, _ := strconv.ParseInt(timestamp, 10, 64)
+	if Verify(testSecret, Sign(testSecret, ts-600, req.body), strconv.FormatInt(ts-600, 10), req.body, time.Minute) {
+		t.Error("signature verifies outside the tolerance")
+	}
+
+	want := []attempt{{status: domain.DeliveryDelivered, responseStatus: http.StatusNoContent}}
+	if len(store.attempts) != 1 || store.attempts[0] != want[0] {
+		t.Errorf("attempts = %+v, want %+v", store.attempts, want)
+	}
+}
+
+func TestDispatcherRetriesWithBackoffUntilDead(t *testing.T) {
+	server, received := receiver(t, http.StatusInternalServerError)
+	store := newTestStore(server.URL)
+	config := testConfig()
+	dispatcher := NewDispatcher(store, nil, config)
+
+	for i := 0; i < config.MaxAttempts+1; i++ {
+		dispatcher.dispatch(context.Background())
+	}
+
+	if n := len(received()); n != config.MaxAttempts {
+		t.Fatalf("receiver got %d requests, want %d", n, config.MaxAttempts)
+	}
+	if len(store.attempts) != config.MaxAttempts {
+		t.Fatalf("recorded %d attempts, want %d", len(store.attempts), config.MaxAttempts)
+	}
+
+	// Doubling from InitialBackoff up to MaxBackoff, minus up to 20% jitter
+	maxDelays := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	for i, a := range store.attempts {
+		wantStatus := domain.DeliveryPending
+		if i == config.MaxAttempts-1 {
+			wantStatus = domain.DeliveryDead
+		}
+		if a.status != wantStatus {
+			t.Errorf("attempt %d status = %s, want %s", i+1, a.status, wantStatus)
+		}
+		if a.responseStatus != http.StatusInternalServerError || a.err == "" {
+			t.Errorf("attempt %d = %+v, want a recorded 500 error", i+1, a)
+		}
+		// Allow for the time between computing and recording the delay
+		if lo, hi := maxDelays[i]*8/10-time.Second/10, maxDelays[i]; a.delay < lo || a.delay > hi {
+			t.Errorf("attempt %d retry delay = %s, want between %s and %s", i+1, a.delay, lo, hi)
+		}
+	}
+}
+
+func TestDispatcherDeliversOnRetry(t *testing.T) {
+	server, received := receiver(t, http.StatusServiceUnavailable, http.StatusOK)
+	store := newTestStore(server.URL)
+	dispatcher := NewDispatcher(store, nil, testConfig())
+
+	dispatcher.dispatch(context.Background())
+	dispatcher.dispatch(context.Background())
+
+	if n := len(received()); n != 2 {
+		t.Fatalf("receiver got %d requests, want 2", n)
+	}
+	if store.task.Delivery.Status != domain.DeliveryDelivered {
+		t.Errorf("status = %s, want %s", store.task.Delivery.Status, domain.DeliveryDelivered)
+	}
+	if got := store.attempts[0]; got.status != domain.DeliveryPending || got.responseStatus != http.StatusServiceUnavailable {
+		t.Errorf("first attempt = %+v, want pending after 503", got)
+	}
+}